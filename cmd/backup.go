@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/linlanniao/soss/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// backupPrefixDefault is the default prefix of the backup repository
+const backupPrefixDefault = "backup"
+
+var (
+	backupEncryptKey string
+	backupPrefix     string
+	backupXattrs     bool
+
+	// backupCmd represents the backup command
+	backupCmd = &cobra.Command{
+		Use:   "backup files [files ...]",
+		Short: "Backup files as a deduplicated, encrypted snapshot",
+		Run: func(cmd *cobra.Command, paths []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(backupEncryptKey) == 0 {
+					logger.Error("encrypt_key is required")
+					os.Exit(1)
+				}
+				k = backupEncryptKey
+			}
+
+			opts := controller.BackupOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       backupPrefix,
+				EncryptKey:   k,
+				Paths:        utils.RemoveDuplicates(paths),
+				Xattrs:       backupXattrs,
+			}
+
+			snapshot, err := ctrl.Backup(cmd.Context(), opts)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			if outputFormat != "" {
+				printRecords(snapshotRecords([]*controller.Snapshot{snapshot}))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.Flags().StringVarP(&backupEncryptKey, "encrypt_key", "k", "", "encryption key (required)")
+	backupCmd.Flags().StringVarP(&backupPrefix, "prefix", "p", backupPrefixDefault, "prefix of the backup repository")
+	backupCmd.Flags().BoolVar(&backupXattrs, "xattrs", false, "store extended attributes with the file metadata")
+}
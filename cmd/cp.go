@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/linlanniao/soss/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpRecursive   bool
+	cpDstEndpoint string
+	cpDstCType    string
+	cpDecryptKey  string
+	cpEncryptKey  string
+	cpDryRun      bool
+
+	// cpCmd represents the cp command
+	cpCmd = &cobra.Command{
+		Use:   "cp key|prefix [key|prefix ...] [bucket:]destination",
+		Short: "Copy objects to another key, prefix or bucket",
+		Long: `Copy objects to another key, prefix or bucket.
+Objects are copied on the server when the destination shares the endpoint and
+the encryption key, otherwise they are downloaded, re-encrypted and uploaded.`,
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runCopy(cmd.Context(), args, false)
+		},
+	}
+
+	// mvCmd represents the mv command
+	mvCmd = &cobra.Command{
+		Use:     "mv key|prefix [key|prefix ...] [bucket:]destination",
+		Short:   "Move objects to another key, prefix or bucket",
+		Long:    `Move objects to another key, prefix or bucket, the sources are deleted once copied.`,
+		Aliases: []string{"move"},
+		Args:    cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runCopy(cmd.Context(), args, true)
+		},
+	}
+)
+
+// parseBucketKey splits "bucket:key", a key without bucket uses the current one
+func parseBucketKey(s string) (bucketName, key string) {
+	if b, k, ok := strings.Cut(s, ":"); ok {
+		return b, k
+	}
+	return "", s
+}
+
+func runCopy(ctx context.Context, args []string, move bool) {
+	cType := controller.S3ClientType(s3ClientType)
+	if err := cType.Validate(); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	dstCType := cType
+	if cpDstCType != "" {
+		dstCType = controller.S3ClientType(cpDstCType)
+		if err := dstCType.Validate(); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// keys are only needed to re-encrypt
+	initSecretKey()
+	decryptKey := cpDecryptKey
+	if useSecretFile && len(secretKey) > 0 {
+		decryptKey = secretKey
+	}
+
+	dstBucket, dstKey := parseBucketKey(args[len(args)-1])
+	opts := controller.CopyOptions{
+		S3ClientType:  cType,
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		S3keys:        utils.RemoveDuplicates(args[:len(args)-1]),
+		Recursive:     cpRecursive,
+		DstClientType: dstCType,
+		DstEndpoint:   cpDstEndpoint,
+		DstBucket:     dstBucket,
+		DstKey:        dstKey,
+		DecryptKey:    decryptKey,
+		EncryptKey:    cpEncryptKey,
+		Move:          move,
+		DryRun:        cpDryRun,
+	}
+
+	items, err := ctrl.Copy(ctx, opts)
+	switch {
+	case outputFormat != "":
+		printRecords(copyRecords(items, move))
+	case cpDryRun:
+		printCopyPlan(items)
+	}
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd, mvCmd)
+	for _, cmd := range []*cobra.Command{cpCmd, mvCmd} {
+		cmd.Flags().BoolVarP(&cpRecursive, "recursive", "r", false, "copy every object below the given prefixes")
+		cmd.Flags().StringVar(&cpDstEndpoint, "to_endpoint", "", "destination endpoint, defaults to --endpoint")
+		cmd.Flags().StringVar(&cpDstCType, "to_client_type", "", "destination client type, defaults to --client_type")
+		cmd.Flags().StringVarP(&cpDecryptKey, "decrypt_key", "k", "", "decryption key of the sources, needed with --encrypt_key")
+		cmd.Flags().StringVar(&cpEncryptKey, "encrypt_key", "", "re-encrypt the copies with this key")
+		cmd.Flags().BoolVar(&cpDryRun, "dry_run", false, "print the objects to copy without copying")
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffDecryptKey string
+	diffPrefix     string
+
+	// diffCmd represents the diff command
+	diffCmd = &cobra.Command{
+		Use:   "diff snapshot1 snapshot2",
+		Short: "Show the files added (+), removed (-) or modified (M) between two snapshots",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(diffDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = diffDecryptKey
+			}
+
+			opts := controller.DiffSnapshotsOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       diffPrefix,
+				DecryptKey:   k,
+				From:         args[0],
+				To:           args[1],
+			}
+
+			diffs, err := ctrl.DiffSnapshots(cmd.Context(), opts)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			if outputFormat != "" {
+				printRecords(diffRecords(diffs))
+				return
+			}
+			printSnapshotDiffs(diffs)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVarP(&diffDecryptKey, "decrypt_key", "k", "", "decryption key")
+	diffCmd.Flags().StringVarP(&diffPrefix, "prefix", "p", backupPrefixDefault, "prefix of the backup repository")
+}
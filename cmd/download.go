@@ -12,6 +12,8 @@ import (
 var (
 	downloadDecryptKey string
 	downloadOutputDir  string
+	downloadNoOwner    bool
+	downloadNoXattrs   bool
 
 	// downloadCmd represents the download command
 	downloadCmd = &cobra.Command{
@@ -46,11 +48,17 @@ var (
 				OutputDir:    downloadOutputDir,
 				DecryptKey:   k,
 				S3keys:       utils.RemoveDuplicates(keys),
+				NoOwner:      downloadNoOwner,
+				NoXattrs:     downloadNoXattrs,
 			}
 
-			if err := ctrl.Download(opts); err != nil {
+			report, err := ctrl.Download(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(transferRecords(report))
+			}
+			if err != nil {
 				//logger.Error(err.Error())
-				os.Exit(1)
+				os.Exit(exitCode(err))
 			}
 		},
 	}
@@ -60,4 +68,6 @@ func init() {
 	rootCmd.AddCommand(downloadCmd)
 	downloadCmd.Flags().StringVarP(&downloadDecryptKey, "decrypt_key", "k", "", "decryption key")
 	downloadCmd.Flags().StringVarP(&downloadOutputDir, "output_dir", "o", "./download", `output directory`)
+	downloadCmd.Flags().BoolVar(&downloadNoOwner, "no_owner", false, "do not restore file ownership (uid / gid), required when not running as root")
+	downloadCmd.Flags().BoolVar(&downloadNoXattrs, "no_xattrs", false, "do not restore extended attributes")
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/linlanniao/soss/internal/controller"
@@ -26,8 +27,16 @@ var listCmd = &cobra.Command{
 			Prefix:       listPrefix,
 		}
 
-		if err := ctrl.List(opts); err != nil {
-			os.Exit(1)
+		objs, err := ctrl.List(cmd.Context(), opts)
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+		if outputFormat != "" {
+			printRecords(objectRecords(objs))
+			return
+		}
+		for _, obj := range objs {
+			fmt.Println(obj.Key)
 		}
 	},
 }
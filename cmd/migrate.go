@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFrom         string
+	migrateTo           string
+	migrateFromEndpoint string
+	migrateToEndpoint   string
+	migrateDecryptKey   string
+	migrateEncryptKey   string
+	migrateRecompress   bool
+	migrateCheckpoint   string
+	migrateNoVerify     bool
+	migrateDryRun       bool
+
+	// migrateCmd represents the migrate command
+	migrateCmd = &cobra.Command{
+		Use:   "migrate --from type://bucket/prefix --to type://bucket/prefix",
+		Short: "Migrate objects between backends, buckets or prefixes",
+		Long: `Migrate every object below a prefix to another backend, bucket or prefix,
+e.g. soss migrate --from oss://bucket/data --to s3://bucket/data --to_endpoint http://minio:9000
+
+Objects are re-encrypted with --encrypt_key or re-compressed with --recompress when asked.
+Migrated objects are recorded in a checkpoint, running the same migration again resumes it.
+The checksums of the migrated objects are compared with the source ones at the end.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			from, err := controller.ParseLocation(migrateFrom)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			to, err := controller.ParseLocation(migrateTo)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			from.Endpoint = locationEndpoint(from, migrateFromEndpoint)
+			to.Endpoint = locationEndpoint(to, migrateToEndpoint)
+
+			// keys are only needed to re-encrypt, re-compress and verify the plaintext
+			initSecretKey()
+			decryptKey := migrateDecryptKey
+			if useSecretFile && len(secretKey) > 0 {
+				decryptKey = secretKey
+			}
+
+			opts := controller.MigrateOptions{
+				From:           from,
+				To:             to,
+				DecryptKey:     decryptKey,
+				EncryptKey:     migrateEncryptKey,
+				Recompress:     migrateRecompress,
+				CheckpointPath: migrateCheckpoint,
+				Jobs:           jobs,
+				NoVerify:       migrateNoVerify,
+				DryRun:         migrateDryRun,
+			}
+
+			items, err := ctrl.Migrate(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(migrateRecords(items))
+			case migrateDryRun:
+				printMigratePlan(items)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+// locationEndpoint returns the endpoint of a location, the global one is used
+// when the location has the configured client type
+func locationEndpoint(loc controller.MigrateLocation, flagEndpoint string) string {
+	if flagEndpoint != "" {
+		return flagEndpoint
+	}
+	if string(loc.ClientType) == s3ClientType {
+		return endpoint
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVar(&migrateFrom, "from", "", "source, type://bucket/prefix")
+	migrateCmd.Flags().StringVar(&migrateTo, "to", "", "destination, type://bucket/prefix")
+	migrateCmd.Flags().StringVar(&migrateFromEndpoint, "from_endpoint", "", "source endpoint, defaults to --endpoint for the configured client type")
+	migrateCmd.Flags().StringVar(&migrateToEndpoint, "to_endpoint", "", "destination endpoint, defaults to --endpoint for the configured client type")
+	migrateCmd.Flags().StringVarP(&migrateDecryptKey, "decrypt_key", "k", "", "decryption key, needed to re-encrypt, re-compress and verify the plaintext")
+	migrateCmd.Flags().StringVar(&migrateEncryptKey, "encrypt_key", "", "re-encrypt the objects with this key")
+	migrateCmd.Flags().BoolVar(&migrateRecompress, "recompress", false, "decompress and compress the content again")
+	migrateCmd.Flags().StringVar(&migrateCheckpoint, "checkpoint", "", "checkpoint file, defaults to ~/.soss/migrate/<hash>.json")
+	migrateCmd.Flags().BoolVar(&migrateNoVerify, "no_verify", false, "skip the final checksum comparison")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry_run", false, "print the objects to migrate without migrating")
+	_ = migrateCmd.MarkFlagRequired("from")
+	_ = migrateCmd.MarkFlagRequired("to")
+}
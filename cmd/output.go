@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/internal/controller"
+	"gopkg.in/yaml.v3"
+)
+
+// output formats of --output, without it commands keep their plain output
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+func validateOutputFormat() error {
+	switch outputFormat {
+	case "", outputJSON, outputYAML, outputTable:
+		return nil
+	default:
+		return fmt.Errorf("invalid output %q, expected json, yaml or table", outputFormat)
+	}
+}
+
+// record is a line of structured output, an object, the result of a file
+// transfer or an item of a plan, the fields a command doesn't know are left out
+type record struct {
+	Action       string `json:"action,omitempty" yaml:"action,omitempty"` // planned or done, e.g. upload, remove, keep
+	Reason       string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Name         string `json:"name,omitempty" yaml:"name,omitempty"` // backup set, trash batch or snapshot
+	Time         string `json:"time,omitempty" yaml:"time,omitempty"`
+	Host         string `json:"host,omitempty" yaml:"host,omitempty"`
+	Key          string `json:"key,omitempty" yaml:"key,omitempty"`
+	Dest         string `json:"dest,omitempty" yaml:"dest,omitempty"`   // where a copy, move or migration goes
+	Count        int    `json:"count,omitempty" yaml:"count,omitempty"` // objects of a set or batch, files of a snapshot
+	Size         int64  `json:"size" yaml:"size"`
+	AddedSize    int64  `json:"added_size,omitempty" yaml:"added_size,omitempty"`
+	ETag         string `json:"etag,omitempty" yaml:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	LocalPath    string `json:"local_path,omitempty" yaml:"local_path,omitempty"`
+	Status       string `json:"status,omitempty" yaml:"status,omitempty"`
+	Error        string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// status of a file transfer
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func objectRecords(objs []*internal.S3Object) []record {
+	records := make([]record, 0, len(objs))
+	for _, obj := range objs {
+		records = append(records, record{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: formatTime(obj.LastModified),
+		})
+	}
+	return records
+}
+
+func transferRecords(report *controller.TransferReport) []record {
+	results := report.Results()
+	records := make([]record, 0, len(results))
+	for _, result := range results {
+		rec := record{
+			Key:          result.Key,
+			Size:         result.Size,
+			ETag:         result.ETag,
+			LastModified: formatTime(result.LastModified),
+			LocalPath:    result.Path,
+			Status:       statusOK,
+		}
+		if result.Err != nil {
+			rec.Status, rec.Error = statusFailed, result.Err.Error()
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func verifyRecords(results []*controller.VerifyResult) []record {
+	records := make([]record, 0, len(results))
+	for _, result := range results {
+		records = append(records, record{
+			Key:    result.Key,
+			Size:   result.Size,
+			Status: string(result.Status),
+			Error:  result.Error,
+		})
+	}
+	return records
+}
+
+// deleteRecords are the objects deleted, or that would be, verb is e.g. "remove"
+func deleteRecords(verb string, objs []*internal.S3Object) []record {
+	records := objectRecords(objs)
+	for i := range records {
+		records[i].Action = verb
+	}
+	return records
+}
+
+func syncRecords(items []*controller.SyncItem) []record {
+	records := make([]record, 0, len(items))
+	for _, item := range items {
+		records = append(records, record{
+			Action:    string(item.Action),
+			Reason:    item.Reason,
+			Key:       item.Key,
+			Size:      item.Size,
+			LocalPath: item.Path,
+		})
+	}
+	return records
+}
+
+// copyRecords are the objects copied, destinations are bucket:key
+func copyRecords(items []*controller.CopyItem, move bool) []record {
+	action := "copy"
+	if move {
+		action = "move"
+	}
+	records := make([]record, 0, len(items))
+	for _, item := range items {
+		records = append(records, record{
+			Action: action,
+			Key:    item.Src,
+			Dest:   item.DstBucket + ":" + item.Dst,
+			Size:   item.Size,
+		})
+	}
+	return records
+}
+
+func migrateRecords(items []*controller.MigrateItem) []record {
+	records := make([]record, 0, len(items))
+	for _, item := range items {
+		records = append(records, record{Action: "migrate", Key: item.Src, Dest: item.Dst, Size: item.Size})
+	}
+	return records
+}
+
+// pruneRecords are the backup sets kept or removed, then the unreferenced chunks
+func pruneRecords(plan *controller.PrunePlan) []record {
+	if plan == nil {
+		return nil
+	}
+	records := make([]record, 0, len(plan.Sets)+len(plan.Chunks))
+	for _, set := range plan.Sets {
+		rec := record{
+			Action: "remove",
+			Name:   set.Name,
+			Time:   formatTime(set.Time),
+			Count:  len(set.Keys),
+			Size:   set.Size,
+		}
+		if set.Keep {
+			rec.Action, rec.Reason = "keep", strings.Join(set.Reasons, ",")
+		}
+		records = append(records, rec)
+	}
+	for _, chunk := range plan.Chunks {
+		records = append(records, record{Action: "remove", Reason: "unreferenced chunk", Key: chunk})
+	}
+	return records
+}
+
+func trashRecords(batches []*controller.TrashBatch) []record {
+	records := make([]record, 0, len(batches))
+	for _, b := range batches {
+		records = append(records, record{Name: b.Name, Time: formatTime(b.Time), Count: len(b.Objs), Size: b.Size})
+	}
+	return records
+}
+
+// restoreRecords are the original keys restored from the trash
+func restoreRecords(keys []string) []record {
+	records := make([]record, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, record{Action: "restore", Key: key})
+	}
+	return records
+}
+
+// scrubRecords are the objects of a scrub that failed verification
+func scrubRecords(report *controller.ScrubReport) []record {
+	if report == nil {
+		return nil
+	}
+	return verifyRecords(report.Failures)
+}
+
+func snapshotRecords(snapshots []*controller.Snapshot) []record {
+	records := make([]record, 0, len(snapshots))
+	for _, s := range snapshots {
+		records = append(records, record{
+			Name:      s.ID,
+			Time:      formatTime(s.Time),
+			Host:      s.Hostname,
+			Count:     len(s.Files),
+			Size:      s.Size,
+			AddedSize: s.AddedSize,
+			LocalPath: strings.Join(s.Paths, ","),
+		})
+	}
+	return records
+}
+
+// changeActions spell out the changes of a snapshot diff
+var changeActions = map[controller.SnapshotChange]string{
+	controller.SnapshotChangeAdded:    "added",
+	controller.SnapshotChangeRemoved:  "removed",
+	controller.SnapshotChangeModified: "modified",
+}
+
+func diffRecords(diffs []*controller.SnapshotDiff) []record {
+	records := make([]record, 0, len(diffs))
+	for _, d := range diffs {
+		records = append(records, record{Action: changeActions[d.Change], LocalPath: d.Path})
+	}
+	return records
+}
+
+// printRecords writes the records to stdout in the --output format
+func printRecords(records []record) {
+	if err := writeRecords(os.Stdout, outputFormat, records); err != nil {
+		logger.Error("failed to print output", "err", err.Error())
+	}
+}
+
+func writeRecords(w io.Writer, format string, records []record) error {
+	if records == nil {
+		records = []record{}
+	}
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(records); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputTable:
+		return writeTable(w, records)
+	default:
+		return fmt.Errorf("invalid output %q", format)
+	}
+}
+
+// tableColumns are the columns of the table output, a column that is empty
+// in every record is left out
+var tableColumns = []struct {
+	header string
+	value  func(r record) string
+}{
+	{"STATUS", func(r record) string { return r.Status }},
+	{"ACTION", func(r record) string { return r.Action }},
+	{"REASON", func(r record) string { return r.Reason }},
+	{"NAME", func(r record) string { return r.Name }},
+	{"TIME", func(r record) string { return r.Time }},
+	{"HOST", func(r record) string { return r.Host }},
+	{"KEY", func(r record) string { return r.Key }},
+	{"DEST", func(r record) string { return r.Dest }},
+	{"COUNT", func(r record) string { return formatCount(r.Count) }},
+	{"SIZE", func(r record) string { return strconv.FormatInt(r.Size, 10) }},
+	{"ADDED", func(r record) string { return formatCount(r.AddedSize) }},
+	{"ETAG", func(r record) string { return r.ETag }},
+	{"LAST_MODIFIED", func(r record) string { return r.LastModified }},
+	{"LOCAL_PATH", func(r record) string { return r.LocalPath }},
+	{"ERROR", func(r record) string { return r.Error }},
+}
+
+// formatCount leaves a zero count empty, its column is left out when no record has one
+func formatCount[T int | int64](n T) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(n), 10)
+}
+
+func writeTable(w io.Writer, records []record) error {
+	columns := make([]int, 0, len(tableColumns))
+	for i, col := range tableColumns {
+		for _, r := range records {
+			if col.value(r) != "" {
+				columns = append(columns, i)
+				break
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = tableColumns[col].header
+	}
+	fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	for _, r := range records {
+		for i, col := range columns {
+			cells[i] = tableColumns[col].value(r)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
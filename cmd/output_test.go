@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRecords(t *testing.T) {
+	records := []record{
+		{Key: "data/a.txt", Size: 4, ETag: "e1", LocalPath: "/src/a.txt", Status: statusOK},
+		{Key: "data/b.txt", LocalPath: "/src/b.txt", Status: statusFailed, Error: "boom"},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		records []record
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			format:  outputJSON,
+			records: records,
+			want: `[
+  {
+    "key": "data/a.txt",
+    "size": 4,
+    "etag": "e1",
+    "local_path": "/src/a.txt",
+    "status": "ok"
+  },
+  {
+    "key": "data/b.txt",
+    "size": 0,
+    "local_path": "/src/b.txt",
+    "status": "failed",
+    "error": "boom"
+  }
+]
+`,
+		},
+		{
+			name:   "json without records",
+			format: outputJSON,
+			want:   "[]\n",
+		},
+		{
+			name:    "yaml",
+			format:  outputYAML,
+			records: records,
+			want: `- key: data/a.txt
+  size: 4
+  etag: e1
+  local_path: /src/a.txt
+  status: ok
+- key: data/b.txt
+  size: 0
+  local_path: /src/b.txt
+  status: failed
+  error: boom
+`,
+		},
+		{
+			name:   "yaml without records",
+			format: outputYAML,
+			want:   "[]\n",
+		},
+		{
+			name:    "table leaves out empty columns",
+			format:  outputTable,
+			records: records,
+			want: `STATUS  KEY         SIZE  ETAG  LOCAL_PATH  ERROR
+ok      data/a.txt  4     e1    /src/a.txt  
+failed  data/b.txt  0           /src/b.txt  boom
+`,
+		},
+		{
+			name:    "table of objects",
+			format:  outputTable,
+			records: []record{{Key: "data/a.txt", Size: 4, LastModified: "2024-01-02T03:04:05Z"}},
+			want: `KEY         SIZE  LAST_MODIFIED
+data/a.txt  4     2024-01-02T03:04:05Z
+`,
+		},
+		{
+			name:   "table without records",
+			format: outputTable,
+			want:   "",
+		},
+		{
+			name:    "invalid format",
+			format:  "xml",
+			records: records,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeRecords(&buf, tt.format, tt.records)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestPlanRecords(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		records []record
+		want    string
+	}{
+		{
+			name: "sync",
+			records: syncRecords([]*controller.SyncItem{
+				{Action: controller.SyncActionUpload, Reason: "new", Key: "data/a.txt", Path: "/src/a.txt"},
+				{Action: controller.SyncActionDelete, Reason: "deleted locally", Key: "data/b.txt", Size: 4},
+			}),
+			want: `ACTION  REASON           KEY         SIZE  LOCAL_PATH
+upload  new              data/a.txt  0     /src/a.txt
+delete  deleted locally  data/b.txt  4     
+`,
+		},
+		{
+			name: "pull",
+			records: syncRecords([]*controller.SyncItem{
+				{Action: controller.SyncActionDownload, Reason: "changed", Key: "conf/a.conf", Path: "/etc/app/a.conf", Size: 8},
+				{Action: controller.SyncActionRemove, Reason: "deleted remotely", Path: "/etc/app/b.conf"},
+			}),
+			want: `ACTION    REASON            KEY          SIZE  LOCAL_PATH
+download  changed           conf/a.conf  8     /etc/app/a.conf
+remove    deleted remotely               0     /etc/app/b.conf
+`,
+		},
+		{
+			name:    "rm",
+			records: deleteRecords("remove", []*internal.S3Object{{Key: "data/a.txt", Size: 4}}),
+			want: `ACTION  KEY         SIZE
+remove  data/a.txt  4
+`,
+		},
+		{
+			name: "mv",
+			records: copyRecords([]*controller.CopyItem{
+				{SrcBucket: "a", Src: "old/a.txt", DstBucket: "b", Dst: "new/a.txt", Size: 4},
+			}, true),
+			want: `ACTION  KEY        DEST         SIZE
+move    old/a.txt  b:new/a.txt  4
+`,
+		},
+		{
+			name:    "migrate",
+			records: migrateRecords([]*controller.MigrateItem{{Src: "old/a.txt", Dst: "new/a.txt", Size: 4}}),
+			want: `ACTION   KEY        DEST       SIZE
+migrate  old/a.txt  new/a.txt  4
+`,
+		},
+		{
+			name: "prune",
+			records: pruneRecords(&controller.PrunePlan{
+				Sets: []*controller.BackupSet{
+					{Name: "2024-03-02", Time: ts.AddDate(0, 0, 1), Keys: []string{"k1", "k2"}, Size: 8, Keep: true, Reasons: []string{"daily", "weekly"}},
+					{Name: "2024-03-01", Time: ts, Keys: []string{"k3"}, Size: 4},
+				},
+				Chunks: []string{"repo/chunks/ab/abcd"},
+			}),
+			want: `ACTION  REASON              NAME        TIME                  KEY                  COUNT  SIZE
+keep    daily,weekly        2024-03-02  2024-03-02T12:00:00Z                       2      8
+remove                      2024-03-01  2024-03-01T12:00:00Z                       1      4
+remove  unreferenced chunk                                    repo/chunks/ab/abcd         0
+`,
+		},
+		{
+			name:    "trash list",
+			records: trashRecords([]*controller.TrashBatch{{Name: "20240301T120000Z", Time: ts, Objs: make([]*internal.S3Object, 2), Size: 8}}),
+			want: `NAME              TIME                  COUNT  SIZE
+20240301T120000Z  2024-03-01T12:00:00Z  2      8
+`,
+		},
+		{
+			name:    "trash restore",
+			records: restoreRecords([]string{"data/a.txt"}),
+			want: `ACTION   KEY         SIZE
+restore  data/a.txt  0
+`,
+		},
+		{
+			name: "scrub",
+			records: scrubRecords(&controller.ScrubReport{Total: 10, Checked: 5, Failed: 1, Failures: []*controller.VerifyResult{
+				{Key: "data/a.txt", Size: 4, Status: controller.VerifyStatusCorrupt, Error: "checksum mismatch"},
+			}}),
+			want: `STATUS   KEY         SIZE  ERROR
+corrupt  data/a.txt  4     checksum mismatch
+`,
+		},
+		{
+			name: "snapshots",
+			records: snapshotRecords([]*controller.Snapshot{
+				{ID: "20240301T120000Z-1a2b3c4d", Time: ts, Hostname: "web1", Paths: []string{"/etc", "/home"}, Size: 8, AddedSize: 4, Files: make([]*controller.SnapshotFile, 3)},
+			}),
+			want: `NAME                       TIME                  HOST  COUNT  SIZE  ADDED  LOCAL_PATH
+20240301T120000Z-1a2b3c4d  2024-03-01T12:00:00Z  web1  3      8     4      /etc,/home
+`,
+		},
+		{
+			name: "diff",
+			records: diffRecords([]*controller.SnapshotDiff{
+				{Change: controller.SnapshotChangeModified, Path: "/etc/b"},
+				{Change: controller.SnapshotChangeAdded, Path: "/etc/d"},
+			}),
+			want: `ACTION    SIZE  LOCAL_PATH
+modified  0     /etc/b
+added     0     /etc/d
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, writeRecords(&buf, outputTable, tt.records))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+
+	// plans of a failed command are printed empty
+	for _, records := range [][]record{pruneRecords(nil), scrubRecords(nil), syncRecords(nil)} {
+		var buf bytes.Buffer
+		assert.NoError(t, writeRecords(&buf, outputJSON, records))
+		assert.Equal(t, "[]\n", buf.String())
+	}
+}
+
+func TestPlanRecords_JSON(t *testing.T) {
+	records := syncRecords([]*controller.SyncItem{
+		{Action: controller.SyncActionUpload, Reason: "changed", Key: "data/a.txt", Path: "/src/a.txt", Size: 4},
+	})
+	var buf bytes.Buffer
+	assert.NoError(t, writeRecords(&buf, outputJSON, records))
+	assert.JSONEq(t, `[{"action": "upload", "reason": "changed", "key": "data/a.txt", "size": 4, "local_path": "/src/a.txt"}]`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeRecords(&buf, outputYAML, records))
+	assert.Equal(t, `- action: upload
+  reason: changed
+  key: data/a.txt
+  size: 4
+  local_path: /src/a.txt
+`, buf.String())
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/internal/controller"
+)
+
+// the plain output of the commands, the controller returns the results and
+// the commands print them
+
+func printSyncPlan(items []*controller.SyncItem, bidirectional bool) {
+	for _, item := range items {
+		if bidirectional {
+			fmt.Printf("%-8s %-33s %s\n", item.Action, item.Reason, item.Key)
+		} else {
+			fmt.Printf("%-6s %-15s %s\n", item.Action, item.Reason, item.Key)
+		}
+	}
+}
+
+func printPullPlan(items []*controller.SyncItem) {
+	for _, item := range items {
+		fmt.Printf("%-8s %-21s %s\n", item.Action, item.Reason, item.Path)
+	}
+}
+
+func printCopyPlan(items []*controller.CopyItem) {
+	for _, item := range items {
+		fmt.Printf("copy %s:%s -> %s:%s  %d bytes\n", item.SrcBucket, item.Src, item.DstBucket, item.Dst, item.Size)
+	}
+}
+
+func printMigratePlan(items []*controller.MigrateItem) {
+	for _, item := range items {
+		fmt.Printf("migrate %s -> %s  %d bytes\n", item.Src, item.Dst, item.Size)
+	}
+}
+
+// printDeletePlan prints the objects that would be deleted, verb is e.g. "remove"
+func printDeletePlan(verb string, objs []*internal.S3Object) {
+	for _, obj := range objs {
+		fmt.Printf("%s %s  %d bytes\n", verb, obj.Key, obj.Size)
+	}
+}
+
+func printPrunePlan(plan *controller.PrunePlan) {
+	for _, set := range plan.Sets {
+		if set.Keep {
+			fmt.Printf("keep   %s  %s  %s\n", set.Time.Format(time.DateTime), set.Name, strings.Join(set.Reasons, ","))
+			continue
+		}
+		fmt.Printf("remove %s  %s  %d objects, %d bytes\n", set.Time.Format(time.DateTime), set.Name, len(set.Keys), set.Size)
+	}
+	if len(plan.Chunks) > 0 {
+		fmt.Printf("remove %d unreferenced chunks\n", len(plan.Chunks))
+	}
+}
+
+func printTrashBatches(batches []*controller.TrashBatch) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BATCH\tDELETED AT\tOBJECTS\tSIZE")
+	for _, b := range batches {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", b.Name, b.Time.Local().Format(time.DateTime), len(b.Objs), b.Size)
+	}
+	return w.Flush()
+}
+
+func printSnapshots(snapshots []*controller.Snapshot) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tHOST\tFILES\tSIZE\tADDED\tPATHS")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			s.ID, s.Time.Format(time.DateTime), s.Hostname, len(s.Files), s.Size, s.AddedSize, strings.Join(s.Paths, ","))
+	}
+	return w.Flush()
+}
+
+func printSnapshotDiffs(diffs []*controller.SnapshotDiff) {
+	for _, d := range diffs {
+		fmt.Println(d.Change, d.Path)
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDecryptKey  string
+	prunePrefix      string
+	pruneKeepDaily   int
+	pruneKeepWeekly  int
+	pruneKeepMonthly int
+	pruneSnapshots   bool
+	pruneDryRun      bool
+
+	// pruneCmd represents the prune command
+	pruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the dated backups under a prefix, or the snapshots, not kept by the retention policy",
+		Long: `Delete the dated backups under a prefix, or the snapshots, not kept by the retention policy.
+
+Each first level directory below the prefix is one backup, dated by its name (e.g. 2024-03-01)
+or by its newest object. With --snapshots the snapshots of the backup repository are pruned
+and the chunks no longer used are deleted, do not run it while a backup is in progress.`,
+		Run: func(cmd *cobra.Command, _ []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if pruneSnapshots && len(pruneDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = pruneDecryptKey
+			}
+
+			opts := controller.PruneOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       prunePrefix,
+				Policy: controller.RetentionPolicy{
+					KeepDaily:   pruneKeepDaily,
+					KeepWeekly:  pruneKeepWeekly,
+					KeepMonthly: pruneKeepMonthly,
+				},
+				Snapshots:  pruneSnapshots,
+				DecryptKey: k,
+				DryRun:     pruneDryRun,
+			}
+
+			plan, err := ctrl.Prune(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(pruneRecords(plan))
+			case pruneDryRun && plan != nil:
+				printPrunePlan(plan)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().StringVarP(&pruneDecryptKey, "decrypt_key", "k", "", "decryption key, required with --snapshots")
+	pruneCmd.Flags().StringVarP(&prunePrefix, "prefix", "p", "", `prefix of the backups, or of the backup repository with --snapshots (default "")`)
+	pruneCmd.Flags().IntVar(&pruneKeepDaily, "keep_daily", 0, "keep the newest backup of each of the last n days")
+	pruneCmd.Flags().IntVar(&pruneKeepWeekly, "keep_weekly", 0, "keep the newest backup of each of the last n weeks")
+	pruneCmd.Flags().IntVar(&pruneKeepMonthly, "keep_monthly", 0, "keep the newest backup of each of the last n months")
+	pruneCmd.Flags().BoolVar(&pruneSnapshots, "snapshots", false, "prune the snapshots of the backup repository")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry_run", false, "print the plan without deleting")
+}
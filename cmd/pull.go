@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pullDecryptKey string
+	pullPrefix     string
+	pullTo         string
+	pullConflict   string
+	pullDelete     bool
+	pullDryRun     bool
+	pullNoOwner    bool
+	pullNoXattrs   bool
+
+	// pullCmd represents the pull command
+	pullCmd = &cobra.Command{
+		Use:   "pull",
+		Short: "Download and decrypt the objects of a prefix that differ from a local directory",
+		Run: func(cmd *cobra.Command, _ []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(pullDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = pullDecryptKey
+			}
+
+			opts := controller.PullOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       pullPrefix,
+				DecryptKey:   k,
+				Dir:          pullTo,
+				Conflict:     controller.ConflictPolicy(pullConflict),
+				Delete:       pullDelete,
+				DryRun:       pullDryRun,
+				NoOwner:      pullNoOwner,
+				NoXattrs:     pullNoXattrs,
+			}
+
+			items, err := ctrl.Pull(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(syncRecords(items))
+			case pullDryRun:
+				printPullPlan(items)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+	pullCmd.Flags().StringVarP(&pullDecryptKey, "decrypt_key", "k", "", "decryption key")
+	pullCmd.Flags().StringVarP(&pullPrefix, "prefix", "p", "", `object prefix to pull (default "")`)
+	pullCmd.Flags().StringVarP(&pullTo, "to", "o", "./download", "local directory to mirror the prefix to")
+	pullCmd.Flags().StringVar(&pullConflict, "conflict", string(controller.ConflictPolicyOverwrite),
+		"what to do with local files that differ from the object: skip, overwrite, keep-both or newer-wins")
+	pullCmd.Flags().BoolVar(&pullDelete, "delete", false, "delete local files whose object no longer exists, the copies kept by keep-both are left alone")
+	pullCmd.Flags().BoolVar(&pullDryRun, "dry_run", false, "print the plan without downloading or deleting")
+	pullCmd.Flags().BoolVar(&pullNoOwner, "no_owner", false, "do not restore file ownership (uid / gid), required when not running as root")
+	pullCmd.Flags().BoolVar(&pullNoXattrs, "no_xattrs", false, "do not restore extended attributes")
+}
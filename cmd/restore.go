@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreDecryptKey string
+	restorePrefix     string
+	restoreTo         string
+	restoreNoOwner    bool
+	restoreNoXattrs   bool
+
+	// restoreCmd represents the restore command
+	restoreCmd = &cobra.Command{
+		Use:   "restore snapshot [path]",
+		Short: `Restore the files of a snapshot, "latest" is the most recent one`,
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(restoreDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = restoreDecryptKey
+			}
+
+			opts := controller.RestoreOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       restorePrefix,
+				DecryptKey:   k,
+				Snapshot:     args[0],
+				Dir:          restoreTo,
+				NoOwner:      restoreNoOwner,
+				NoXattrs:     restoreNoXattrs,
+			}
+			if len(args) > 1 {
+				opts.Path = args[1]
+			}
+
+			report, err := ctrl.Restore(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(transferRecords(report))
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVarP(&restoreDecryptKey, "decrypt_key", "k", "", "decryption key")
+	restoreCmd.Flags().StringVarP(&restorePrefix, "prefix", "p", backupPrefixDefault, "prefix of the backup repository")
+	restoreCmd.Flags().StringVarP(&restoreTo, "to", "o", "./restore", "directory to restore the files to, under their absolute path")
+	restoreCmd.Flags().BoolVar(&restoreNoOwner, "no_owner", false, "do not restore file ownership (uid / gid), required when not running as root")
+	restoreCmd.Flags().BoolVar(&restoreNoXattrs, "no_xattrs", false, "do not restore extended attributes")
+}
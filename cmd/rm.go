@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/linlanniao/soss/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rmRecursive bool
+	rmOlderThan string
+	rmDryRun    bool
+	rmYes       bool
+	rmTrash     bool
+
+	// rmCmd represents the rm command
+	rmCmd = &cobra.Command{
+		Use:     "rm key|prefix [key|prefix ...]",
+		Short:   "Remove objects from s3Service",
+		Aliases: []string{"remove", "delete"},
+		Args:    cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, keys []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			var olderThan time.Duration
+			if rmOlderThan != "" {
+				var err error
+				if olderThan, err = utils.ParseDuration(rmOlderThan); err != nil {
+					logger.Error("invalid older_than", "err", err.Error())
+					os.Exit(1)
+				}
+			}
+
+			opts := controller.RemoveOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				S3keys:       utils.RemoveDuplicates(keys),
+				Recursive:    rmRecursive,
+				OlderThan:    olderThan,
+				DryRun:       rmDryRun,
+				Trash:        rmTrash,
+			}
+			if !rmYes {
+				opts.Confirm = confirmRemove
+			}
+
+			objs, err := ctrl.Remove(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(deleteRecords("remove", objs))
+			case rmDryRun:
+				printDeletePlan("remove", objs)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+// confirmRemove asks on the terminal before objects are deleted
+func confirmRemove(count int, size int64) bool {
+	fmt.Printf("remove %d objects (%d bytes) from %s? [y/N] ", count, size, bucket)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "remove every object below the given prefixes")
+	rmCmd.Flags().StringVar(&rmOlderThan, "older_than", "", "only remove objects last modified before this long ago, e.g. 30d or 12h")
+	rmCmd.Flags().BoolVar(&rmDryRun, "dry_run", false, "print the objects to remove without deleting")
+	rmCmd.Flags().BoolVarP(&rmYes, "yes", "y", false, "do not ask for confirmation")
+	rmCmd.Flags().BoolVar(&rmTrash, "trash", false, "move the objects to the trash instead of deleting them, always on when trash is enabled in the config")
+}
@@ -1,15 +1,26 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/linlanniao/soss/internal"
 	"github.com/linlanniao/soss/internal/controller"
 	"github.com/linlanniao/soss/internal/filehandler"
+	"github.com/linlanniao/soss/internal/s3clients/localclient"
 	"github.com/linlanniao/soss/internal/s3clients/ossclient"
+	"github.com/linlanniao/soss/internal/s3clients/retryclient"
+	"github.com/linlanniao/soss/internal/s3clients/s3client"
 	"github.com/linlanniao/soss/internal/secret"
+	"github.com/linlanniao/soss/pkg/bandwidth"
 	"github.com/linlanniao/soss/pkg/log"
+	"github.com/linlanniao/soss/pkg/progress"
+	"github.com/linlanniao/soss/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -21,15 +32,48 @@ var rootCmd = &cobra.Command{
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The first Ctrl-C (or SIGTERM) cancels the running command, which stops
+// scheduling new transfers and lets in-flight ones unwind; a second one
+// kills the process.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// restore the default behavior so a second signal terminates at once
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// Exit codes, cron jobs can tell a partly failed batch from one where
+// nothing was transferred
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitPartialFailure = 2
+)
+
+// exitCode maps the error returned by a controller method to the process
+// exit status
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case controller.IsPartialFailure(err):
+		return exitPartialFailure
+	default:
+		return exitFailure
+	}
+}
+
 var (
 	config        *controller.Config
+	configErr     error // reported once a command runs, the package loads without credentials
 	endpoint      string
 	bucket        string
 	ctrl          *controller.Controller
@@ -37,6 +81,11 @@ var (
 	s3ClientType  string
 	useSecretFile bool
 	secretKey     string
+	jobs          int
+	maxBandwidth  string
+	maxMemory     string
+	progressMode  string
+	outputFormat  string
 )
 
 const s3ClientTypeDefault = "oss"
@@ -44,7 +93,8 @@ const s3ClientTypeDefault = "oss"
 func init() {
 	initLogger()
 	initConfig()
-	initController()
+	// the controller depends on global flags, build it once they are parsed
+	cobra.OnInitialize(initController)
 
 	//rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringVarP(&endpoint, "endpoint", "e", config.Endpoint, "endpoint")
@@ -55,21 +105,28 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&s3ClientType, "client_type", "c", config.ClientType, "client type")
 
 	rootCmd.PersistentFlags().BoolVarP(&useSecretFile, "use_secret_file", "a", false, "using secret file to encryption")
+	rootCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", 0, "files transferred in parallel, defaults to 2 * cpus")
+	rootCmd.PersistentFlags().StringVar(&maxBandwidth, "max_bandwidth", "",
+		"total transfer rate in bytes per second, e.g. 10M, overrides the bandwidth config")
+	rootCmd.PersistentFlags().StringVar(&maxMemory, "max_memory", "512M",
+		"memory of the files in flight, each file takes about 3 times its size while it's compressed and encrypted")
+	rootCmd.PersistentFlags().StringVar(&progressMode, "progress", "",
+		"report transfer progress on stderr, \"bar\" for a terminal or \"json\" for json lines")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "O", "",
+		"print the plan or results on stdout as json, yaml or table")
 
 }
 
 func initConfig() {
-	var err error
-	config, err = controller.NewConfig()
-	if err != nil {
-		logger.Error(
-			"failed to init config", "err", err.Error())
-		os.Exit(1)
+	config, configErr = controller.NewConfig()
+	if configErr != nil {
+		// the flags take their defaults from an empty config
+		config = &controller.Config{}
 	}
 
 	// set default clientType
 	if config.ClientType == "" {
-		config.ClientType = s3ClientType
+		config.ClientType = s3ClientTypeDefault
 	}
 }
 
@@ -77,17 +134,153 @@ func initLogger() {
 	logger = log.DefaultConsoleLogger()
 }
 
+// newS3Client returns a new client of the type, clients keep per endpoint state
+// so every replica gets its own
+func newS3Client(cType controller.S3ClientType, endpoint string) internal.IS3Client {
+	ak, sk := config.Credentials(string(cType))
+	var client internal.IS3Client
+	switch cType {
+	case controller.S3ClientTypeS3:
+		client = s3client.NewClient(endpoint, ak, sk)
+	case controller.S3ClientTypeLocal:
+		client = localclient.NewClient()
+	default:
+		client = ossclient.NewClient(endpoint, ak, sk)
+	}
+	return retryclient.NewClient(client, retryPolicy(), retryclient.WithLogger(logger))
+}
+
+// retryPolicy is the default policy with the limits set in the config file
+func retryPolicy() retryclient.Policy {
+	policy := retryclient.DefaultPolicy()
+	if config.Retry.MaxAttempts > 0 {
+		policy.MaxAttempts = config.Retry.MaxAttempts
+	}
+	if config.Retry.BaseDelay > 0 {
+		policy.BaseDelay = config.Retry.BaseDelay
+	}
+	if config.Retry.MaxDelay > 0 {
+		policy.MaxDelay = config.Retry.MaxDelay
+	}
+	return policy
+}
+
+func newReplicas(targets []controller.ReplicaConfig) []*controller.Replica {
+	replicas := make([]*controller.Replica, 0, len(targets))
+	for _, target := range targets {
+		cType := controller.S3ClientType(target.ClientType)
+		replicas = append(replicas, &controller.Replica{
+			ClientType: cType,
+			Endpoint:   target.Endpoint,
+			Bucket:     target.Bucket,
+			Client:     newS3Client(cType, target.Endpoint),
+		})
+	}
+	return replicas
+}
+
 func initController() {
-	ossClient := ossclient.NewClient(config.Endpoint, config.AccessKey, config.SecretKey)
+	if configErr != nil {
+		logger.Error(
+			"failed to init config", "err", configErr.Error())
+		os.Exit(1)
+	}
+	if err := config.Validate(); err != nil {
+		logger.Error("invalid config", "err", err.Error())
+		os.Exit(1)
+	}
+	if err := validateOutputFormat(); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	sink := newProgressSink()
+
+	clientEndpoint := func(cType controller.S3ClientType) string {
+		if string(cType) == config.ClientType {
+			return config.Endpoint
+		}
+		return ""
+	}
 	fileHandler := filehandler.NewFileHandler()
-	ctrl = controller.NewController(
+	opts := []controller.Option{
 		controller.WithBucket(config.Bucket),
 		controller.WithEndpoint(config.Endpoint),
-		controller.WithS3Client(controller.S3ClientTypeOSS, ossClient),
 		controller.WithFileHandler(fileHandler),
 		controller.WithLogger(logger),
 		controller.WithCompression(),
-	)
+	}
+	for _, cType := range []controller.S3ClientType{
+		controller.S3ClientTypeOSS, controller.S3ClientTypeS3, controller.S3ClientTypeLocal,
+	} {
+		opts = append(opts, controller.WithS3Client(cType, newS3Client(cType, clientEndpoint(cType))))
+	}
+	if config.Trash {
+		opts = append(opts, controller.WithTrash())
+	}
+	if len(config.Replicas.Targets) > 0 {
+		mode := controller.ReplicaMode(config.Replicas.Mode)
+		if mode == "" {
+			mode = controller.ReplicaModeQuorum
+		}
+		opts = append(opts, controller.WithReplicas(mode, newReplicas(config.Replicas.Targets)...))
+	}
+	if len(config.Erasure.Targets) > 0 {
+		opts = append(opts, controller.WithErasure(&controller.ErasureSet{
+			DataShards:   config.Erasure.DataShards,
+			ParityShards: config.Erasure.ParityShards,
+			Targets:      newReplicas(config.Erasure.Targets),
+		}))
+	}
+	memoryLimit, err := utils.ParseBytes(maxMemory)
+	if err != nil {
+		logger.Error("invalid max_memory", "err", err.Error())
+		os.Exit(1)
+	}
+	opts = append(opts, controller.WithJobs(jobs), controller.WithMemoryLimit(memoryLimit))
+	if limiter := newBandwidthLimiter(); limiter != nil {
+		opts = append(opts, controller.WithBandwidth(limiter))
+	}
+	if sink != nil {
+		opts = append(opts, controller.WithProgress(sink))
+	}
+	ctrl = controller.NewController(opts...)
+}
+
+// newProgressSink returns the renderer of --progress, nil when progress is
+// not reported. The bar is redrawn in place, info logs between two draws
+// would be overwritten, so only warnings and errors are logged along with it.
+func newProgressSink() progress.Sink {
+	switch progressMode {
+	case "":
+		return nil
+	case "bar":
+		logger = log.ConsoleLogger(slog.LevelWarn)
+		return progress.NewTerminal(os.Stderr, 100*time.Millisecond)
+	case "json":
+		return progress.NewJSONLines(os.Stderr, time.Second)
+	default:
+		logger.Error("invalid progress, expected bar or json", "progress", progressMode)
+		os.Exit(1)
+		return nil
+	}
+}
+
+// newBandwidthLimiter returns the limiter of --max_bandwidth, or of the config
+// when the flag is not set, nil for unlimited
+func newBandwidthLimiter() *bandwidth.Limiter {
+	schedule, err := config.Bandwidth.Schedule()
+	if maxBandwidth != "" {
+		schedule = bandwidth.Schedule{}
+		schedule.Default, err = bandwidth.ParseRate(maxBandwidth)
+	}
+	if err != nil {
+		logger.Error("invalid bandwidth", "err", err.Error())
+		os.Exit(1)
+	}
+	if schedule.IsUnlimited() {
+		return nil
+	}
+	return bandwidth.NewLimiter(schedule)
 }
 
 func initSecretKey() {
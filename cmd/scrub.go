@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubDecryptKey string
+	scrubPrefix     string
+	scrubSample     float64
+	scrubCycleDays  int
+	scrubCursor     string
+	scrubReport     string
+
+	// scrubCmd represents the scrub command
+	scrubCmd = &cobra.Command{
+		Use:   "scrub",
+		Short: "Verify a random sample of objects of s3Service, or all of them over several days, and report failures",
+		Run: func(cmd *cobra.Command, _ []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(scrubDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = scrubDecryptKey
+			}
+
+			opts := controller.ScrubOptions{
+				S3ClientType:  cType,
+				Endpoint:      endpoint,
+				Bucket:        bucket,
+				Prefix:        scrubPrefix,
+				DecryptKey:    k,
+				SamplePercent: scrubSample,
+				CycleDays:     scrubCycleDays,
+				CursorPath:    scrubCursor,
+				ReportPath:    scrubReport,
+			}
+
+			report, err := ctrl.Scrub(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(scrubRecords(report))
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(scrubCmd)
+	scrubCmd.Flags().StringVarP(&scrubDecryptKey, "decrypt_key", "k", "", "decryption key")
+	scrubCmd.Flags().StringVarP(&scrubPrefix, "prefix", "p", "", `object prefix to scrub (default "")`)
+	scrubCmd.Flags().Float64Var(&scrubSample, "sample", 10, "percent of objects to verify randomly")
+	scrubCmd.Flags().IntVar(&scrubCycleDays, "cycle_days", 0, "verify all objects over this many days, instead of random sampling")
+	scrubCmd.Flags().StringVar(&scrubCursor, "cursor", "", `cursor file of --cycle_days (default "$HOME/.soss/scrub/<hash>.json")`)
+	scrubCmd.Flags().StringVarP(&scrubReport, "report", "r", "", "write the json report to this file")
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotsDecryptKey string
+	snapshotsPrefix     string
+
+	// snapshotsCmd represents the snapshots command
+	snapshotsCmd = &cobra.Command{
+		Use:   "snapshots",
+		Short: "List the snapshots of the backup repository",
+		Run: func(cmd *cobra.Command, _ []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(snapshotsDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = snapshotsDecryptKey
+			}
+
+			opts := controller.SnapshotsOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       snapshotsPrefix,
+				DecryptKey:   k,
+			}
+
+			snapshots, err := ctrl.Snapshots(cmd.Context(), opts)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			if outputFormat != "" {
+				printRecords(snapshotRecords(snapshots))
+				return
+			}
+			if err := printSnapshots(snapshots); err != nil {
+				os.Exit(exitFailure)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(snapshotsCmd)
+	snapshotsCmd.Flags().StringVarP(&snapshotsDecryptKey, "decrypt_key", "k", "", "decryption key")
+	snapshotsCmd.Flags().StringVarP(&snapshotsPrefix, "prefix", "p", backupPrefixDefault, "prefix of the backup repository")
+}
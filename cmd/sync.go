@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncEncryptKey string
+	syncPrefix     string
+	syncDelete     bool
+	syncDryRun     bool
+	syncXattrs     bool
+	syncBidir      bool
+	syncState      string
+	syncReport     string
+	syncNoOwner    bool
+	syncYes        bool
+
+	// syncCmd represents the sync command
+	syncCmd = &cobra.Command{
+		Use:   "sync dir",
+		Short: "Encrypt and upload new or changed files of a directory to s3service, or sync both ways",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(syncEncryptKey) == 0 {
+					logger.Error("encrypt_key is required")
+					os.Exit(1)
+				}
+				k = syncEncryptKey
+			}
+
+			opts := controller.SyncOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       syncPrefix,
+				EncryptKey:   k,
+				Path:         args[0],
+				Delete:       syncDelete,
+				DryRun:       syncDryRun,
+				Xattrs:       syncXattrs,
+
+				Bidirectional: syncBidir,
+				StatePath:     syncState,
+				ReportPath:    syncReport,
+				NoOwner:       syncNoOwner,
+			}
+			if syncYes {
+				opts.Confirm = func(int, int64) bool { return true }
+			} else {
+				opts.Confirm = confirmRemove
+			}
+
+			items, err := ctrl.Sync(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(syncRecords(items))
+			case syncDryRun:
+				printSyncPlan(items, syncBidir)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVarP(&syncEncryptKey, "encrypt_key", "k", "", "encryption key (required)")
+	syncCmd.Flags().StringVarP(&syncPrefix, "prefix", "p", "", `prefix path to add to the file key (default "")`)
+	syncCmd.Flags().BoolVar(&syncDelete, "delete", false, "delete objects whose local file no longer exists")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry_run", false, "print the plan without uploading or deleting")
+	syncCmd.Flags().BoolVar(&syncXattrs, "xattrs", false, "upload extended attributes with the file metadata")
+	syncCmd.Flags().BoolVar(&syncBidir, "bidirectional", false, "apply changes in both directions, conflicts are kept as renamed copies")
+	syncCmd.Flags().StringVar(&syncState, "state", "", `state database of --bidirectional (default "$HOME/.soss/sync/<hash>.json")`)
+	syncCmd.Flags().StringVarP(&syncReport, "report", "r", "", "write the json report of --bidirectional to this file")
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "do not ask for confirmation before --delete without a prefix removes objects of the whole bucket")
+	syncCmd.Flags().BoolVar(&syncNoOwner, "no_owner", false, "do not restore file ownership (uid / gid) on download")
+}
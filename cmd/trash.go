@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/linlanniao/soss/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trashOlderThan string
+	trashDryRun    bool
+	trashYes       bool
+	trashForce     bool
+
+	// trashCmd represents the trash command
+	trashCmd = &cobra.Command{
+		Use:   "trash",
+		Short: "Manage the objects removed with trash enabled",
+	}
+
+	// trashListCmd represents the trash list command
+	trashListCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "List the batches of removed objects in the trash",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			opts := controller.TrashOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+			}
+			batches, err := ctrl.TrashList(cmd.Context(), opts)
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+			if outputFormat != "" {
+				printRecords(trashRecords(batches))
+				return
+			}
+			if err := printTrashBatches(batches); err != nil {
+				os.Exit(exitFailure)
+			}
+		},
+	}
+
+	// trashRestoreCmd represents the trash restore command
+	trashRestoreCmd = &cobra.Command{
+		Use:   "restore batch [key|prefix ...]",
+		Short: "Restore the objects of a trash batch to their original keys",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			opts := controller.TrashRestoreOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Batch:        args[0],
+				S3keys:       utils.RemoveDuplicates(args[1:]),
+				Force:        trashForce,
+			}
+			restored, err := ctrl.TrashRestore(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(restoreRecords(restored))
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+
+	// trashEmptyCmd represents the trash empty command
+	trashEmptyCmd = &cobra.Command{
+		Use:   "empty",
+		Short: "Permanently delete the objects in the trash",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			var olderThan time.Duration
+			if trashOlderThan != "" {
+				var err error
+				if olderThan, err = utils.ParseDuration(trashOlderThan); err != nil {
+					logger.Error("invalid older_than", "err", err.Error())
+					os.Exit(1)
+				}
+			}
+
+			opts := controller.TrashEmptyOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				OlderThan:    olderThan,
+				DryRun:       trashDryRun,
+			}
+			if !trashYes {
+				opts.Confirm = confirmRemove
+			}
+
+			objs, err := ctrl.TrashEmpty(cmd.Context(), opts)
+			switch {
+			case outputFormat != "":
+				printRecords(deleteRecords("delete", objs))
+			case trashDryRun:
+				printDeletePlan("delete", objs)
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+	trashRestoreCmd.Flags().BoolVar(&trashForce, "force", false, "overwrite objects stored again at the original key")
+	trashEmptyCmd.Flags().StringVar(&trashOlderThan, "older_than", "", "only delete batches removed before this long ago, e.g. 30d")
+	trashEmptyCmd.Flags().BoolVar(&trashDryRun, "dry_run", false, "print the objects to delete without deleting")
+	trashEmptyCmd.Flags().BoolVarP(&trashYes, "yes", "y", false, "do not ask for confirmation")
+}
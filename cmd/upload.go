@@ -12,6 +12,7 @@ import (
 var (
 	uploadEncryptKey string
 	uploadPrefix     string
+	uploadXattrs     bool
 	uploadCmd        = &cobra.Command{
 		Use:     "upload files [files ...]",
 		Short:   "Encrypt and upload files to s3service",
@@ -42,10 +43,15 @@ var (
 				Prefix:       uploadPrefix,
 				EncryptKey:   k,
 				Paths:        utils.RemoveDuplicates(paths),
+				Xattrs:       uploadXattrs,
 			}
 
-			if err := ctrl.Upload(opts); err != nil {
-				os.Exit(1)
+			report, err := ctrl.Upload(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(transferRecords(report))
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
 			}
 		},
 	}
@@ -55,4 +61,5 @@ func init() {
 	rootCmd.AddCommand(uploadCmd)
 	uploadCmd.Flags().StringVarP(&uploadEncryptKey, "encrypt_key", "k", "", "encryption key (required)")
 	uploadCmd.Flags().StringVarP(&uploadPrefix, "prefix", "p", "", `prefix path to add to the file key (default "")`)
+	uploadCmd.Flags().BoolVar(&uploadXattrs, "xattrs", false, "upload extended attributes with the file metadata")
 }
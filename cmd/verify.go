@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyDecryptKey string
+	verifyPrefix     string
+
+	// verifyCmd represents the verify command
+	verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Verify objects of s3Service can be decrypted and match their checksum, without writing files",
+		Run: func(cmd *cobra.Command, _ []string) {
+			cType := controller.S3ClientType(s3ClientType)
+			if err := cType.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			initSecretKey()
+			var k string
+			if useSecretFile && len(secretKey) > 0 {
+				k = secretKey
+			} else {
+				if len(verifyDecryptKey) == 0 {
+					logger.Error("decrypt_key is required")
+					os.Exit(1)
+				}
+				k = verifyDecryptKey
+			}
+
+			opts := controller.VerifyOptions{
+				S3ClientType: cType,
+				Endpoint:     endpoint,
+				Bucket:       bucket,
+				Prefix:       verifyPrefix,
+				DecryptKey:   k,
+			}
+
+			results, err := ctrl.Verify(cmd.Context(), opts)
+			if outputFormat != "" {
+				printRecords(verifyRecords(results))
+			}
+			if err != nil {
+				os.Exit(exitCode(err))
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVarP(&verifyDecryptKey, "decrypt_key", "k", "", "decryption key")
+	verifyCmd.Flags().StringVarP(&verifyPrefix, "prefix", "p", "", `object prefix to verify (default "")`)
+}
@@ -0,0 +1,569 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/chunker"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+// a backup repository under a prefix looks like:
+//
+//	<prefix>/chunks/<id[:2]>/<id>   encrypted chunk, id is the keyed hash of its plaintext
+//	<prefix>/snapshots/<id>         encrypted snapshot manifest, one per backup run
+const (
+	backupChunksDir    = "chunks"
+	backupSnapshotsDir = "snapshots"
+
+	// SnapshotLatest resolves to the most recent snapshot
+	SnapshotLatest = "latest"
+)
+
+type Snapshot struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Hostname  string          `json:"hostname"`
+	Paths     []string        `json:"paths"`
+	Size      int64           `json:"size"`       // total plaintext size of the files
+	AddedSize int64           `json:"added_size"` // plaintext size of the chunks stored by this run
+	Files     []*SnapshotFile `json:"files"`
+}
+
+type SnapshotFile struct {
+	Path   string             `json:"path"` // absolute, slash separated
+	Meta   *internal.FileMeta `json:"meta"`
+	Chunks []string           `json:"chunks"`
+}
+
+func chunkKey(prefix, id string) string {
+	return path.Join(prefix, backupChunksDir, id[:2], id)
+}
+
+func snapshotKey(prefix, id string) string {
+	return path.Join(prefix, backupSnapshotsDir, id)
+}
+
+// newSnapshotID returns a time ordered unique id, e.g. 20240301T120000Z-1a2b3c4d
+func newSnapshotID(t time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// chunkHasher returns the keyed hash of chunk ids, keys of the chunks then leak
+// nothing about their content to anyone without the key
+func chunkHasher(key string) func(chunk []byte) string {
+	k := sha256.Sum256([]byte("soss chunk id\n" + key))
+	return func(chunk []byte) string {
+		mac := hmac.New(sha256.New, k[:])
+		mac.Write(chunk)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+// putBlob compresses, encrypts and uploads content as the object key
+func (c *Controller) putBlob(ctx context.Context, endpoint, bucket, key string, content []byte, encryptKey string, client internal.IS3Client) error {
+	file := &internal.File{Path: path.Base(key), Content: content}
+	if c.isCompress {
+		if err := c.fileHandler.Compress(file); err != nil {
+			return err
+		}
+	}
+	if err := c.fileHandler.Encrypt(file, encryptKey); err != nil {
+		return err
+	}
+	_, err := client.Upload(ctx, endpoint, bucket, path.Dir(key), file)
+	return err
+}
+
+// getBlob downloads, decrypts and decompresses the object key
+func (c *Controller) getBlob(ctx context.Context, endpoint, bucket, key, decryptKey string, client internal.IS3Client) ([]byte, error) {
+	file, err := client.Download(ctx, &internal.S3Object{Endpoint: endpoint, Bucket: bucket, Key: key}, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fileHandler.Decrypt(file, decryptKey); err != nil {
+		return nil, err
+	}
+	if c.isCompress {
+		if err := c.fileHandler.Decompress(file); err != nil {
+			return nil, err
+		}
+	}
+	return file.Content, nil
+}
+
+func (c *Controller) listSnapshotIDs(ctx context.Context, endpoint, bucket, prefix string, client internal.IS3Client) ([]string, error) {
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(path.Join(prefix, backupSnapshotsDir)))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		ids = append(ids, path.Base(obj.Key))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// resolveSnapshotID accepts "latest", a full id or a unique prefix of an id
+func resolveSnapshotID(ids []string, id string) (string, error) {
+	if len(ids) == 0 {
+		return "", errors.New("no snapshots found")
+	}
+	if id == SnapshotLatest {
+		return ids[len(ids)-1], nil
+	}
+
+	matched := make([]string, 0, 1)
+	for _, x := range ids {
+		if x == id {
+			return x, nil
+		}
+		if strings.HasPrefix(x, id) {
+			matched = append(matched, x)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("snapshot %s not found", id)
+	case 1:
+		return matched[0], nil
+	default:
+		return "", fmt.Errorf("snapshot %s is ambiguous, %d snapshots match", id, len(matched))
+	}
+}
+
+func (c *Controller) loadSnapshot(ctx context.Context, endpoint, bucket, prefix, id, decryptKey string, client internal.IS3Client) (*Snapshot, error) {
+	b, err := c.getBlob(ctx, endpoint, bucket, snapshotKey(prefix, id), decryptKey, client)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot %s: %w", id, err)
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(b, snapshot); err != nil {
+		return nil, fmt.Errorf("load snapshot %s: %w", id, err)
+	}
+	return snapshot, nil
+}
+
+// chunkStore uploads each unique chunk once, shared by all files of a backup run
+type chunkStore struct {
+	mu    sync.Mutex
+	known map[string]struct{}
+	added int64
+}
+
+// claim reports whether the chunk is new and must be uploaded by the caller
+func (s *chunkStore) claim(id string, size int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.known[id]; ok {
+		return false
+	}
+	s.known[id] = struct{}{}
+	s.added += int64(size)
+	return true
+}
+
+func (c *Controller) backupSingleFile(
+	ctx context.Context, endpoint, bucket, prefix, filePath, encryptKey string, metaOpts internal.MetaOptions,
+	store *chunkStore, splitter *chunker.Chunker, hash func([]byte) string, client internal.IS3Client) (*SnapshotFile, error) {
+	file, err := c.fileHandler.Read(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := c.fileHandler.ReadMeta(ctx, filePath, metaOpts)
+	if err != nil {
+		return nil, err
+	}
+	meta.Checksum = utils.Sha256Hex(file.Content)
+
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	sf := &SnapshotFile{Path: filepath.ToSlash(abs), Meta: meta, Chunks: make([]string, 0)}
+
+	for _, chunk := range splitter.Split(file.Content) {
+		id := hash(chunk)
+		sf.Chunks = append(sf.Chunks, id)
+		if !store.claim(id, len(chunk)) {
+			continue
+		}
+		if err := c.putBlob(ctx, endpoint, bucket, chunkKey(prefix, id), chunk, encryptKey, client); err != nil {
+			return nil, err
+		}
+	}
+	return sf, nil
+}
+
+type BackupOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string // prefix of the backup repository
+	EncryptKey   string
+	Paths        []string
+	Xattrs       bool // if true, extended attributes are stored with the file metadata
+}
+
+// Backup splits the files into content-defined chunks, uploads the chunks not stored yet
+// and writes a snapshot manifest listing the chunks of every file, which is returned.
+func (c *Controller) Backup(ctx context.Context, opts BackupOptions) (*Snapshot, error) {
+	if err := c.requireBucket("backup"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Paths) == 0 {
+		err := errors.New("no files to backup")
+		c.logger.Error("backup failed", "err", err.Error())
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, p := range opts.Paths {
+		found, err := c.fileHandler.SearchFiles(ctx, p)
+		if err != nil {
+			c.logger.Error("backup failed", "path", p, "err", err.Error())
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(path.Join(opts.Prefix, backupChunksDir)))
+	if err != nil {
+		c.logger.Error("backup failed", "err", err.Error())
+		return nil, err
+	}
+	store := &chunkStore{known: make(map[string]struct{}, len(objs))}
+	for _, obj := range objs {
+		store.known[path.Base(obj.Key)] = struct{}{}
+	}
+
+	now := time.Now()
+	hostname, _ := os.Hostname()
+	snapshot := &Snapshot{
+		ID:       newSnapshotID(now),
+		Time:     now,
+		Hostname: hostname,
+		Paths:    make([]string, 0, len(opts.Paths)),
+		Files:    make([]*SnapshotFile, len(files)),
+	}
+	for _, p := range opts.Paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Paths = append(snapshot.Paths, filepath.ToSlash(abs))
+	}
+
+	splitter := chunker.NewDefaultChunker()
+	hash := chunkHasher(opts.EncryptKey)
+	metaOpts := internal.MetaOptions{Owner: true, Xattrs: opts.Xattrs}
+	errs := make([]error, len(files))
+
+	tasks := make([]transferTask, len(files))
+	for i, file := range files {
+		tasks[i] = transferTask{size: fileSize(file), run: func() {
+			sf, err := c.backupSingleFile(
+				ctx, endpoint, bucket, opts.Prefix, file, opts.EncryptKey, metaOpts, store, splitter, hash, client)
+			if err != nil {
+				c.logger.Error("backup file failed", "file", file, "err", err.Error())
+				errs[i] = fmt.Errorf("backup %s: %w", file, err)
+				return
+			}
+			snapshot.Files[i] = sf
+		}}
+	}
+	c.newScheduler().run(ctx, tasks)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// a snapshot is only written when every file is stored
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshot.Files, func(i, j int) bool { return snapshot.Files[i].Path < snapshot.Files[j].Path })
+	for _, sf := range snapshot.Files {
+		snapshot.Size += sf.Meta.Size
+	}
+	snapshot.AddedSize = store.added
+
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.putBlob(ctx, endpoint, bucket, snapshotKey(opts.Prefix, snapshot.ID), b, opts.EncryptKey, client); err != nil {
+		c.logger.Error("save snapshot failed", "err", err.Error())
+		return nil, err
+	}
+
+	c.logger.Info("snapshot saved",
+		"id", snapshot.ID,
+		"files", len(snapshot.Files),
+		"size(bytes)", snapshot.Size,
+		"added(bytes)", snapshot.AddedSize,
+	)
+	return snapshot, nil
+}
+
+type SnapshotsOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string // prefix of the backup repository
+	DecryptKey   string
+}
+
+// Snapshots returns the snapshots of the backup repository, oldest first.
+func (c *Controller) Snapshots(ctx context.Context, opts SnapshotsOptions) ([]*Snapshot, error) {
+	if err := c.requireBucket("snapshots"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := c.listSnapshotIDs(ctx, endpoint, bucket, opts.Prefix, client)
+	if err != nil {
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		s, err := c.loadSnapshot(ctx, endpoint, bucket, opts.Prefix, id, opts.DecryptKey, client)
+		if err != nil {
+			c.logger.Error(err.Error())
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// matchPath reports whether p is the filter path or below it, an empty filter matches everything
+func matchPath(p, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	filter = strings.TrimSuffix(filepath.ToSlash(filter), "/")
+	return p == filter || strings.HasPrefix(p, filter+"/")
+}
+
+func (c *Controller) restoreSingleFile(
+	ctx context.Context, endpoint, bucket, prefix, dir, decryptKey string, sf *SnapshotFile, metaOpts internal.MetaOptions,
+	hash func([]byte) string, client internal.IS3Client) error {
+	content := make([]byte, 0, sf.Meta.Size)
+	for _, id := range sf.Chunks {
+		chunk, err := c.getBlob(ctx, endpoint, bucket, chunkKey(prefix, id), decryptKey, client)
+		if err != nil {
+			return fmt.Errorf("chunk %s: %w", id, err)
+		}
+		if hash(chunk) != id {
+			return fmt.Errorf("chunk %s: %w: content does not match its id", id, internal.ErrIntegrity)
+		}
+		content = append(content, chunk...)
+	}
+	if sum := utils.Sha256Hex(content); sf.Meta.Checksum != "" && sum != sf.Meta.Checksum {
+		return fmt.Errorf("%w: checksum mismatch, expected %s, got %s", internal.ErrIntegrity, sf.Meta.Checksum, sum)
+	}
+
+	file := &internal.File{Path: filepath.Join(dir, filepath.FromSlash(sf.Path)), Content: content}
+	if err := c.fileHandler.Write(ctx, file); err != nil {
+		return err
+	}
+	return c.fileHandler.WriteMeta(ctx, file.Path, sf.Meta, metaOpts)
+}
+
+type RestoreOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string // prefix of the backup repository
+	DecryptKey   string
+	Snapshot     string // snapshot id, a unique prefix of it or "latest"
+	Path         string // if set, only this file or directory is restored
+	Dir          string // files are restored to Dir/<absolute path>
+	NoOwner      bool   // if true, uid / gid are not restored
+	NoXattrs     bool   // if true, extended attributes are not restored
+}
+
+// Restore writes the files of a snapshot, or the ones below Path, under Dir.
+// The report holds a result per file and is returned along with the error of
+// a partly failed restore.
+func (c *Controller) Restore(ctx context.Context, opts RestoreOptions) (*TransferReport, error) {
+	if err := c.requireBucket("restore"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := c.listSnapshotIDs(ctx, endpoint, bucket, opts.Prefix, client)
+	if err != nil {
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+	id, err := resolveSnapshotID(ids, opts.Snapshot)
+	if err != nil {
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+	snapshot, err := c.loadSnapshot(ctx, endpoint, bucket, opts.Prefix, id, opts.DecryptKey, client)
+	if err != nil {
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+
+	hash := chunkHasher(opts.DecryptKey)
+	metaOpts := internal.MetaOptions{Owner: !opts.NoOwner, Xattrs: !opts.NoXattrs}
+
+	matched := make([]*SnapshotFile, 0, len(snapshot.Files))
+	for _, sf := range snapshot.Files {
+		if matchPath(sf.Path, opts.Path) {
+			matched = append(matched, sf)
+		}
+	}
+	if len(matched) == 0 {
+		err := fmt.Errorf("no files in snapshot %s match %s", id, opts.Path)
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+
+	report := newTransferReport("restore", c.retries)
+	report.plan(len(matched))
+	c.logger.Info("restoring snapshot", "snapshot", id, "files", len(matched))
+
+	tasks := make([]transferTask, 0, len(matched))
+	for _, sf := range matched {
+		tasks = append(tasks, transferTask{size: sf.Meta.Size, run: func() {
+			err := c.restoreSingleFile(ctx, endpoint, bucket, opts.Prefix, opts.Dir, opts.DecryptKey, sf, metaOpts, hash, client)
+			result := &TransferResult{Path: filepath.Join(opts.Dir, filepath.FromSlash(sf.Path)), Size: sf.Meta.Size, Err: err}
+			if err != nil {
+				c.logger.Error("restore file failed", "path", sf.Path, "err", err.Error())
+			} else {
+				c.logger.Info("restored", "path", sf.Path, "size(bytes)", sf.Meta.Size)
+			}
+			report.add(result)
+		}})
+	}
+	c.newScheduler().run(ctx, tasks)
+
+	return report, report.finish(ctx, c.logger)
+}
+
+type SnapshotChange string
+
+const (
+	SnapshotChangeAdded    SnapshotChange = "+"
+	SnapshotChangeRemoved  SnapshotChange = "-"
+	SnapshotChangeModified SnapshotChange = "M"
+)
+
+type SnapshotDiff struct {
+	Change SnapshotChange
+	Path   string
+}
+
+// diffSnapshots returns the files added, removed or modified from a to b, ordered by path
+func diffSnapshots(a, b *Snapshot) []*SnapshotDiff {
+	before := make(map[string]*SnapshotFile, len(a.Files))
+	for _, sf := range a.Files {
+		before[sf.Path] = sf
+	}
+
+	diffs := make([]*SnapshotDiff, 0)
+	for _, sf := range b.Files {
+		old, ok := before[sf.Path]
+		delete(before, sf.Path)
+		switch {
+		case !ok:
+			diffs = append(diffs, &SnapshotDiff{Change: SnapshotChangeAdded, Path: sf.Path})
+		case old.Meta.Checksum != sf.Meta.Checksum || old.Meta.Mode != sf.Meta.Mode ||
+			old.Meta.Uid != sf.Meta.Uid || old.Meta.Gid != sf.Meta.Gid:
+			diffs = append(diffs, &SnapshotDiff{Change: SnapshotChangeModified, Path: sf.Path})
+		}
+	}
+	for p := range before {
+		diffs = append(diffs, &SnapshotDiff{Change: SnapshotChangeRemoved, Path: p})
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+type DiffSnapshotsOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string // prefix of the backup repository
+	DecryptKey   string
+	From         string // older snapshot
+	To           string // newer snapshot
+}
+
+// DiffSnapshots returns the files added, removed or modified between two snapshots, ordered by path.
+func (c *Controller) DiffSnapshots(ctx context.Context, opts DiffSnapshotsOptions) ([]*SnapshotDiff, error) {
+	if err := c.requireBucket("diff"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := c.listSnapshotIDs(ctx, endpoint, bucket, opts.Prefix, client)
+	if err != nil {
+		c.logger.Error("diff failed", "err", err.Error())
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, 2)
+	for _, x := range []string{opts.From, opts.To} {
+		id, err := resolveSnapshotID(ids, x)
+		if err != nil {
+			c.logger.Error("diff failed", "err", err.Error())
+			return nil, err
+		}
+		s, err := c.loadSnapshot(ctx, endpoint, bucket, opts.Prefix, id, opts.DecryptKey, client)
+		if err != nil {
+			c.logger.Error("diff failed", "err", err.Error())
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return diffSnapshots(snapshots[0], snapshots[1]), nil
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSnapshotID(t *testing.T) {
+	ids := []string{"20240301T120000Z-1a2b3c4d", "20240302T120000Z-5e6f7a8b", "20240302T130000Z-9c0d1e2f"}
+
+	id, err := resolveSnapshotID(ids, SnapshotLatest)
+	assert.NoError(t, err)
+	assert.Equal(t, "20240302T130000Z-9c0d1e2f", id)
+
+	id, err = resolveSnapshotID(ids, "20240301")
+	assert.NoError(t, err)
+	assert.Equal(t, "20240301T120000Z-1a2b3c4d", id)
+
+	_, err = resolveSnapshotID(ids, "20240302")
+	assert.Error(t, err)
+	_, err = resolveSnapshotID(ids, "2023")
+	assert.Error(t, err)
+	_, err = resolveSnapshotID(nil, SnapshotLatest)
+	assert.Error(t, err)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	file := func(p, sum string) *SnapshotFile {
+		return &SnapshotFile{Path: p, Meta: &internal.FileMeta{Mode: 0644, Checksum: sum}}
+	}
+	a := &Snapshot{Files: []*SnapshotFile{file("/etc/a", "1"), file("/etc/b", "2"), file("/etc/c", "3")}}
+	b := &Snapshot{Files: []*SnapshotFile{file("/etc/a", "1"), file("/etc/b", "22"), file("/etc/d", "4")}}
+
+	diffs := diffSnapshots(a, b)
+	assert.Equal(t, []*SnapshotDiff{
+		{Change: SnapshotChangeModified, Path: "/etc/b"},
+		{Change: SnapshotChangeRemoved, Path: "/etc/c"},
+		{Change: SnapshotChangeAdded, Path: "/etc/d"},
+	}, diffs)
+}
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/etc/nginx/nginx.conf", ""))
+	assert.True(t, matchPath("/etc/nginx/nginx.conf", "/etc/nginx"))
+	assert.True(t, matchPath("/etc/nginx/nginx.conf", "/etc/nginx/"))
+	assert.True(t, matchPath("/etc/nginx/nginx.conf", "/etc/nginx/nginx.conf"))
+	assert.False(t, matchPath("/etc/nginx2/nginx.conf", "/etc/nginx"))
+}
+
+func TestChunkHasher(t *testing.T) {
+	h1, h2 := chunkHasher("p@ssW0rd"), chunkHasher("another")
+	assert.Equal(t, h1([]byte("chunk")), h1([]byte("chunk")))
+	assert.NotEqual(t, h1([]byte("chunk")), h2([]byte("chunk")))
+	assert.Len(t, h1([]byte("chunk")), 64)
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("unchanged content"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("first version"), 0644))
+	backup := BackupOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "repo", EncryptKey: "k", Paths: []string{dir}}
+
+	first, err := c.Backup(ctx, backup)
+	assert.NoError(t, err)
+	assert.Len(t, first.Files, 2)
+	assert.Equal(t, first.Size, first.AddedSize)
+
+	// only the chunk of the changed file is stored again
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("second version"), 0644))
+	second, err := c.Backup(ctx, backup)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("second version")), second.AddedSize)
+	chunks, err := mem.List(ctx, "ep", "bucket", path.Join("repo", backupChunksDir)+"/")
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 3)
+
+	snapshots, err := c.Snapshots(ctx, SnapshotsOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "repo", DecryptKey: "k"})
+	assert.NoError(t, err)
+	ids := make([]string, len(snapshots))
+	for i, s := range snapshots {
+		ids[i] = s.ID
+	}
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, ids)
+
+	restore := func(id string) string {
+		out := t.TempDir()
+		report, err := c.Restore(ctx, RestoreOptions{
+			S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "repo", DecryptKey: "k", Snapshot: id, Dir: out,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, report.Results(), 2)
+		return out
+	}
+	read := func(root, name string) string {
+		abs, err := filepath.Abs(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(root, abs))
+		assert.NoError(t, err)
+		return string(content)
+	}
+
+	out := restore(first.ID)
+	assert.Equal(t, "unchanged content", read(out, "a.txt"))
+	assert.Equal(t, "first version", read(out, "b.txt"))
+	out = restore(second.ID)
+	assert.Equal(t, "unchanged content", read(out, "a.txt"))
+	assert.Equal(t, "second version", read(out, "b.txt"))
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"runtime"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/bandwidth"
+)
+
+// WithJobs sets the number of files transferred at once, twice the CPUs
+// when n is 0
+func WithJobs(n int) Option {
+	return func(c *Controller) {
+		c.jobs = n
+	}
+}
+
+// WithBandwidth limits the total rate of all transfers, replicas and erasure
+// targets included
+func WithBandwidth(limiter *bandwidth.Limiter) Option {
+	return func(c *Controller) {
+		c.bandwidth = limiter
+	}
+}
+
+// parallelism returns the number of concurrent transfers
+func (c *Controller) parallelism() int {
+	if c.jobs > 0 {
+		return c.jobs
+	}
+	return runtime.NumCPU() * 2
+}
+
+// throttleClients passes the content streams of every client through the
+// bandwidth limiter
+func (c *Controller) throttleClients() {
+	if c.bandwidth == nil {
+		return
+	}
+	for cType, client := range c.clients {
+		c.clients[cType] = &throttledClient{IS3Client: client, limiter: c.bandwidth}
+	}
+	for _, replica := range c.replicas {
+		replica.Client = &throttledClient{IS3Client: replica.Client, limiter: c.bandwidth}
+	}
+	if c.erasure != nil {
+		for _, target := range c.erasure.Targets {
+			target.Client = &throttledClient{IS3Client: target.Client, limiter: c.bandwidth}
+		}
+	}
+}
+
+// throttledClient limits the bandwidth of the requests that move content
+type throttledClient struct {
+	internal.IS3Client
+	limiter *bandwidth.Limiter
+}
+
+func (t *throttledClient) limit(ctx context.Context) context.Context {
+	return internal.WithStreamWrapper(ctx, func(r io.Reader) io.Reader {
+		return t.limiter.Reader(ctx, r)
+	})
+}
+
+func (t *throttledClient) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (*internal.S3Object, error) {
+	return t.IS3Client.Upload(t.limit(ctx), endpoint, bucket, prefix, file)
+}
+
+func (t *throttledClient) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (*internal.File, error) {
+	return t.IS3Client.Download(t.limit(ctx), obj, outputDir)
+}
+
+// Retries passes on the retry count of the wrapped client
+func (t *throttledClient) Retries() int64 {
+	if counter, ok := t.IS3Client.(internal.IRetryCounter); ok {
+		return counter.Retries()
+	}
+	return 0
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/bandwidth"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamClient reads uploads through the stream wrappers like the real clients
+type streamClient struct {
+	*memClient
+	wrapped bool
+}
+
+func (s *streamClient) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (*internal.S3Object, error) {
+	r := bytes.NewReader(file.Content)
+	wrapped := internal.WrapStream(ctx, r)
+	s.wrapped = wrapped != io.Reader(r)
+	if _, err := io.ReadAll(wrapped); err != nil {
+		return nil, err
+	}
+	return s.memClient.Upload(ctx, endpoint, bucket, prefix, file)
+}
+
+func TestWithBandwidth(t *testing.T) {
+	client := &streamClient{memClient: newMemClient()}
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: client})
+	assert.Equal(t, runtime.NumCPU()*2, c.parallelism())
+
+	_, err := c.putObject(context.Background(), "ep", "bucket", "", &internal.File{Path: "a.txt", Content: []byte("a")}, client)
+	assert.NoError(t, err)
+	assert.False(t, client.wrapped)
+
+	limited := NewController(
+		WithFileHandler(c.fileHandler),
+		WithS3Client(S3ClientTypeOSS, client),
+		WithJobs(3),
+		WithBandwidth(bandwidth.NewLimiter(bandwidth.Schedule{Default: 1 << 20})),
+	)
+	assert.Equal(t, 3, limited.parallelism())
+	throttled, err := limited.getClient(S3ClientTypeOSS)
+	assert.NoError(t, err)
+	_, err = throttled.Upload(context.Background(), "ep", "bucket", "", &internal.File{Path: "a.txt", Content: []byte("a")})
+	assert.NoError(t, err)
+	assert.True(t, client.wrapped)
+}
@@ -0,0 +1,497 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+const (
+	SyncActionConflict SyncAction = "conflict" // both sides changed, keep local and save remote as a copy
+)
+
+const syncReasonUnchanged = "unchanged"
+
+// syncStateEntry is the state of a file when it was last synced in both directions
+type syncStateEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Checksum string    `json:"sha256"`
+	ETag     string    `json:"etag"`
+}
+
+// syncState is the local database of a bidirectional sync, keyed by object key
+type syncState struct {
+	Endpoint  string                     `json:"endpoint"`
+	Bucket    string                     `json:"bucket"`
+	Prefix    string                     `json:"prefix"`
+	Dir       string                     `json:"dir"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Files     map[string]*syncStateEntry `json:"files"`
+}
+
+func defaultSyncStatePath(endpoint, bucket, prefix, dir string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(endpoint + "\n" + bucket + "\n" + prefix + "\n" + abs))
+	return filepath.Join(home, ".soss", "sync", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadSyncState(path string) (*syncState, error) {
+	state := &syncState{Files: make(map[string]*syncStateEntry)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*syncStateEntry)
+	}
+	return state, nil
+}
+
+func saveSyncState(path string, state *syncState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename, a crash must not leave a truncated database
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// localChanged reports whether the local file changed since the state entry was recorded
+func localChanged(path string, info os.FileInfo, entry *syncStateEntry) (bool, error) {
+	if entry == nil {
+		return true, nil
+	}
+	if info.Size() == entry.Size && info.ModTime().Equal(entry.ModTime) {
+		return false, nil
+	}
+	if info.Size() != entry.Size {
+		return true, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return utils.Sha256Hex(content) != entry.Checksum, nil
+}
+
+// bisyncDecide returns the action of a path from what exists on each side and what changed since the last sync
+func bisyncDecide(localExists, remoteExists, hasState, localChanged, remoteChanged bool) (SyncAction, string) {
+	switch {
+	case localExists && !remoteExists:
+		switch {
+		case !hasState:
+			return SyncActionUpload, "new locally"
+		case !localChanged:
+			return SyncActionRemove, "deleted remotely"
+		default:
+			return SyncActionUpload, "changed locally, deleted remotely"
+		}
+	case !localExists && remoteExists:
+		switch {
+		case !hasState:
+			return SyncActionDownload, "new remotely"
+		case !remoteChanged:
+			return SyncActionDelete, "deleted locally"
+		default:
+			return SyncActionDownload, "changed remotely, deleted locally"
+		}
+	case localExists && remoteExists:
+		switch {
+		case !localChanged && !remoteChanged:
+			return SyncActionSkip, syncReasonUnchanged
+		case localChanged && !remoteChanged:
+			return SyncActionUpload, "changed locally"
+		case !localChanged && remoteChanged:
+			return SyncActionDownload, "changed remotely"
+		default:
+			return SyncActionConflict, "changed on both sides"
+		}
+	default:
+		return SyncActionSkip, "deleted on both sides"
+	}
+}
+
+func (c *Controller) bisyncPlan(
+	ctx context.Context, endpoint, bucket, prefix, dir, key string, state *syncState, client internal.IS3Client) ([]*SyncItem, error) {
+	files, err := c.fileHandler.SearchFiles(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	objs = withoutTrash(objs)
+
+	type side struct {
+		path   string
+		info   os.FileInfo
+		remote *internal.S3Object
+	}
+	sides := make(map[string]*side)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		k := filepath.Join(uploadPrefix(prefix, dir, file), filepath.Base(file))
+		sides[k] = &side{path: file, info: info}
+	}
+	for _, obj := range objs {
+		// skip directory placeholders
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		s, ok := sides[obj.Key]
+		if !ok {
+			path, err := localPath(dir, prefix, obj.Key)
+			if err != nil {
+				return nil, err
+			}
+			s = &side{path: path}
+			sides[obj.Key] = s
+		}
+		s.remote = obj
+	}
+	for k := range state.Files {
+		if _, ok := sides[k]; !ok {
+			path, err := localPath(dir, prefix, k)
+			if err != nil {
+				return nil, err
+			}
+			sides[k] = &side{path: path}
+		}
+	}
+
+	items := make([]*SyncItem, 0, len(sides))
+	errs := make([]error, 0)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	limiter := make(chan struct{}, c.parallelism())
+
+	for k, s := range sides {
+		item := &SyncItem{Key: k, Path: s.path, Prefix: filepath.Dir(k)}
+		if s.remote != nil {
+			item.Size = s.remote.Size
+		}
+		items = append(items, item)
+
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(item *SyncItem, s *side) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+
+			err := func() error {
+				entry := state.Files[item.Key]
+				lChanged, rChanged := false, false
+				if s.info != nil {
+					changed, err := localChanged(s.path, s.info, entry)
+					if err != nil {
+						return err
+					}
+					lChanged = changed
+				}
+				if s.remote != nil {
+					rChanged = entry == nil || entry.ETag != s.remote.ETag
+				}
+
+				item.Action, item.Reason = bisyncDecide(s.info != nil, s.remote != nil, entry != nil, lChanged, rChanged)
+
+				// both sides changed the same way, nothing to transfer
+				if item.Action == SyncActionConflict {
+					changed, _, err := c.remoteChanged(ctx, endpoint, bucket, key, s.path, item.Key, client)
+					if err != nil {
+						return err
+					}
+					if !changed {
+						item.Action, item.Reason = SyncActionSkip, "same change on both sides"
+					}
+				}
+				return nil
+			}()
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("compare %s: %w", item.Key, err))
+				mu.Unlock()
+			}
+		}(item, s)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+// snapshotEntry records the current state of a synced file on both sides
+func (c *Controller) snapshotEntry(ctx context.Context, endpoint, bucket string, item *SyncItem, client internal.IS3Client) (*syncStateEntry, error) {
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := client.Stat(ctx, &internal.S3Object{Endpoint: endpoint, Bucket: bucket, Key: item.Key})
+	if err != nil {
+		return nil, err
+	}
+	return &syncStateEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Checksum: utils.Sha256Hex(content),
+		ETag:     remote.ETag,
+	}, nil
+}
+
+type SyncReport struct {
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Uploaded   int         `json:"uploaded"`
+	Downloaded int         `json:"downloaded"`
+	Deleted    int         `json:"deleted"`
+	Removed    int         `json:"removed"`
+	Conflicts  []*SyncItem `json:"conflicts"`
+	Failures   []*SyncItem `json:"failures"`
+}
+
+func (c *Controller) syncBidirectional(ctx context.Context, endpoint, bucket string, opts SyncOptions, client internal.IS3Client) ([]*SyncItem, error) {
+	report := &SyncReport{
+		StartedAt: time.Now(),
+		Conflicts: make([]*SyncItem, 0),
+		Failures:  make([]*SyncItem, 0),
+	}
+
+	if !utils.IsDir(opts.Path) {
+		err := errors.New("bidirectional sync requires a directory")
+		c.logger.Error("sync failed", "path", opts.Path, "err", err.Error())
+		return nil, err
+	}
+
+	statePath := opts.StatePath
+	if statePath == "" {
+		var err error
+		if statePath, err = defaultSyncStatePath(endpoint, bucket, opts.Prefix, opts.Path); err != nil {
+			return nil, err
+		}
+	}
+	state, err := loadSyncState(statePath)
+	if err != nil {
+		c.logger.Error("load sync state failed", "path", statePath, "err", err.Error())
+		return nil, err
+	}
+
+	items, err := c.bisyncPlan(ctx, endpoint, bucket, opts.Prefix, opts.Path, opts.EncryptKey, state, client)
+	if err != nil {
+		c.logger.Error("sync failed", "path", opts.Path, "err", err.Error())
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return items, nil
+	}
+
+	var mu sync.Mutex
+	metaOpts := internal.MetaOptions{Owner: !opts.NoOwner, Xattrs: opts.Xattrs}
+	now := time.Now()
+
+	var firstErr error // the first failure, the error of the batch
+	tasks := make([]transferTask, 0)
+	toDelete := make([]*SyncItem, 0)
+	for _, item := range items {
+		switch item.Action {
+		case SyncActionSkip:
+			// a path deleted on both sides is forgotten, otherwise the state is refreshed below.
+			// The transfers only start after this loop, nothing else uses the state yet.
+			gone := !utils.IsFile(item.Path)
+			_, known := state.Files[item.Key]
+			if gone {
+				delete(state.Files, item.Key)
+			}
+			if gone || known && item.Reason == syncReasonUnchanged {
+				continue
+			}
+		case SyncActionDelete:
+			toDelete = append(toDelete, item)
+			continue
+		}
+
+		// the local file or the object, whichever is larger
+		size := max(fileSize(item.Path), item.Size)
+		tasks = append(tasks, transferTask{size: size, run: func() {
+			err := func() error {
+				switch item.Action {
+				case SyncActionUpload:
+					_, err := c.uploadSingleFile(ctx, endpoint, bucket, item.Prefix, item.Path, opts.EncryptKey, metaOpts, client)
+					return err
+				case SyncActionDownload:
+					return c.downloadSingleFileTo(ctx, endpoint, bucket, item.Key, item.Path, opts.EncryptKey, metaOpts, client)
+				case SyncActionRemove:
+					return os.Remove(item.Path)
+				case SyncActionConflict:
+					// keep local in place, save the remote version as a renamed copy, then push local
+					copyPath := conflictPath(item.Path, "conflict", now)
+					if err := c.downloadSingleFileTo(
+						ctx, endpoint, bucket, item.Key, copyPath, opts.EncryptKey, metaOpts, client); err != nil {
+						return err
+					}
+					c.logger.Warn("conflict, remote version saved as a copy", "key", item.Key, "copy", copyPath)
+					_, err := c.uploadSingleFile(ctx, endpoint, bucket, item.Prefix, item.Path, opts.EncryptKey, metaOpts, client)
+					return err
+				}
+				return nil
+			}()
+
+			var entry *syncStateEntry
+			if err == nil && item.Action != SyncActionRemove {
+				entry, err = c.snapshotEntry(ctx, endpoint, bucket, item, client)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.logger.Error("sync failed", "key", item.Key, "action", item.Action, "err", err.Error())
+				item.Reason = err.Error()
+				report.Failures = append(report.Failures, item)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			switch item.Action {
+			case SyncActionUpload:
+				report.Uploaded++
+			case SyncActionDownload:
+				report.Downloaded++
+			case SyncActionRemove:
+				report.Removed++
+				c.logger.Info("removed", "path", item.Path)
+			case SyncActionConflict:
+				report.Conflicts = append(report.Conflicts, item)
+				report.Uploaded++
+			}
+			if entry == nil {
+				delete(state.Files, item.Key)
+			} else {
+				state.Files[item.Key] = entry
+			}
+		}})
+	}
+	c.newScheduler().run(ctx, tasks)
+	if err := ctx.Err(); err != nil {
+		return items, err
+	}
+
+	if len(toDelete) > 0 {
+		keys := make([]string, len(toDelete))
+		for i, item := range toDelete {
+			keys[i] = item.Key
+		}
+		deleted, err := c.deleteObjects(ctx, endpoint, bucket, keys, c.trash, client)
+		done := make(map[string]struct{}, len(deleted))
+		for _, key := range deleted {
+			c.logger.Info("deleted", "key", bucket+":"+key)
+			delete(state.Files, key)
+			done[key] = struct{}{}
+			report.Deleted++
+		}
+		if err != nil {
+			// the keys not deleted stay in the state and are deleted by the next sync
+			c.logger.Error("delete failed", "err", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			for _, item := range toDelete {
+				if _, ok := done[item.Key]; !ok {
+					item.Reason = err.Error()
+					report.Failures = append(report.Failures, item)
+				}
+			}
+		}
+	}
+
+	state.Endpoint = endpoint
+	state.Bucket = bucket
+	state.Prefix = opts.Prefix
+	state.Dir = opts.Path
+	state.UpdatedAt = time.Now()
+	if err := saveSyncState(statePath, state); err != nil {
+		c.logger.Error("save sync state failed", "path", statePath, "err", err.Error())
+		return items, err
+	}
+
+	report.FinishedAt = time.Now()
+	if opts.ReportPath != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return items, err
+		}
+		if err := os.WriteFile(opts.ReportPath, b, 0644); err != nil {
+			c.logger.Error("write sync report failed", "path", opts.ReportPath, "err", err.Error())
+			return items, err
+		}
+	}
+
+	c.logger.Info("sync finished",
+		"uploaded", report.Uploaded,
+		"downloaded", report.Downloaded,
+		"deleted", report.Deleted,
+		"removed", report.Removed,
+		"conflicts", len(report.Conflicts),
+		"failed", len(report.Failures),
+	)
+	if failed := len(report.Failures); failed > 0 {
+		done := report.Uploaded + report.Downloaded + report.Deleted + report.Removed
+		return items, &BatchError{Op: "sync", Total: done + failed, Failed: failed, Err: firstErr}
+	}
+	return items, nil
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisyncDecide(t *testing.T) {
+	cases := []struct {
+		name                                string
+		localExists, remoteExists, hasState bool
+		localChanged, remoteChanged         bool
+		want                                SyncAction
+	}{
+		{"new locally", true, false, false, true, false, SyncActionUpload},
+		{"new remotely", false, true, false, false, true, SyncActionDownload},
+		{"deleted remotely", true, false, true, false, false, SyncActionRemove},
+		{"deleted locally", false, true, true, false, false, SyncActionDelete},
+		{"changed locally, deleted remotely", true, false, true, true, false, SyncActionUpload},
+		{"changed remotely, deleted locally", false, true, true, false, true, SyncActionDownload},
+		{"unchanged", true, true, true, false, false, SyncActionSkip},
+		{"changed locally", true, true, true, true, false, SyncActionUpload},
+		{"changed remotely", true, true, true, false, true, SyncActionDownload},
+		{"changed on both sides", true, true, true, true, true, SyncActionConflict},
+		{"new on both sides", true, true, false, true, true, SyncActionConflict},
+		{"deleted on both sides", false, false, true, false, false, SyncActionSkip},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := bisyncDecide(tt.localExists, tt.remoteExists, tt.hasState, tt.localChanged, tt.remoteChanged)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// failingDeleteClient can't delete anything
+type failingDeleteClient struct {
+	*memClient
+}
+
+func (f failingDeleteClient) Delete(ctx context.Context, endpoint, bucket string, keys []string) ([]string, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestSyncBidirectional(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem, S3ClientTypeS3: failingDeleteClient{mem}})
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.txt", i)), []byte(fmt.Sprint(i)), 0644))
+	}
+	opts := SyncOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", EncryptKey: "k", Path: dir,
+		Bidirectional: true, StatePath: filepath.Join(t.TempDir(), "state.json"),
+	}
+	_, err := c.Sync(ctx, opts)
+	assert.NoError(t, err)
+
+	// skipped and uploaded files update the state at the same time
+	for i := 0; i < 20; i += 2 {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.txt", i)), []byte("changed"), 0644))
+	}
+	_, err = c.Sync(ctx, opts)
+	assert.NoError(t, err)
+
+	// a delete that fails is a failure, and is tried again by the next sync
+	assert.NoError(t, os.Remove(filepath.Join(dir, "01.txt")))
+	failing := opts
+	failing.S3ClientType = S3ClientTypeS3
+	_, err = c.Sync(ctx, failing)
+	var batchErr *BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, 1, batchErr.Failed)
+	}
+
+	items, err := c.Sync(ctx, opts)
+	assert.NoError(t, err)
+	deleted := make([]string, 0)
+	for _, item := range items {
+		if item.Action == SyncActionDelete {
+			deleted = append(deleted, item.Key)
+		}
+	}
+	assert.Equal(t, []string{"data/01.txt"}, deleted)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// cancelClient cancels the run during its second download, like a Ctrl-C
+// arriving in the middle of a transfer
+type cancelClient struct {
+	*memClient
+	cancel    context.CancelFunc
+	downloads *atomic.Int32
+}
+
+func (c cancelClient) Download(ctx context.Context, obj *internal.S3Object, bucket string) (*internal.File, error) {
+	if c.downloads.Add(1) == 2 {
+		defer c.cancel()
+	}
+	return c.memClient.Download(ctx, obj, bucket)
+}
+
+func TestDownload_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: cancelClient{mem, cancel, &atomic.Int32{}}})
+	// one download at a time, the first is written before the second starts
+	WithJobs(1)(c)
+	for _, key := range []string{"data/a.txt", "data/b.txt", "data/c.txt"} {
+		putEncrypted(t, c, mem, "ep", "bucket", key, "content of "+key, "")
+	}
+
+	dir := t.TempDir()
+	_, err := c.Download(ctx, DownloadOptions{
+		S3ClientType: S3ClientTypeOSS,
+		Endpoint:     "ep",
+		Bucket:       "bucket",
+		OutputDir:    dir,
+		S3keys:       []string{"data/"},
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the first download completed, whatever was written is complete and
+	// nothing is left half-written
+	entries, err := os.ReadDir(filepath.Join(dir, "data"))
+	assert.NoError(t, err)
+	intact := 0
+	for _, e := range entries {
+		assert.NotContains(t, e.Name(), ".soss-tmp")
+		content, err := os.ReadFile(filepath.Join(dir, "data", e.Name()))
+		assert.NoError(t, err)
+		assert.Equal(t, "content of data/"+e.Name(), string(content))
+		intact++
+	}
+	assert.Positive(t, intact)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/linlanniao/soss/pkg/bandwidth"
 	"github.com/linlanniao/soss/pkg/utils"
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +18,71 @@ type Config struct {
 	ClientType string `yaml:"client_type" json:"client_type"`
 	Endpoint   string `yaml:"endpoint" json:"endpoint"`
 	Bucket     string `yaml:"bucket" json:"bucket"`
+	Trash      bool   `yaml:"trash" json:"trash"`
+
+	Replicas  ReplicasConfig  `yaml:"replicas" json:"replicas"`
+	Erasure   ErasureConfig   `yaml:"erasure" json:"erasure"`
+	Retry     RetryConfig     `yaml:"retry" json:"retry"`
+	Bandwidth BandwidthConfig `yaml:"bandwidth" json:"bandwidth"`
+}
+
+// BandwidthConfig limits the total transfer rate, rates are bytes per second
+// like "10M", empty for unlimited
+type BandwidthConfig struct {
+	Max       string                  `yaml:"max" json:"max"`
+	Schedules []BandwidthWindowConfig `yaml:"schedules" json:"schedules"` // the first window containing the time wins
+}
+
+// BandwidthWindowConfig is the limit between two times of day, e.g. "08:00" to "19:00"
+type BandwidthWindowConfig struct {
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+	Max  string `yaml:"max" json:"max"`
+}
+
+// Schedule parses the config into a bandwidth schedule
+func (c BandwidthConfig) Schedule() (bandwidth.Schedule, error) {
+	var schedule bandwidth.Schedule
+	var err error
+	if schedule.Default, err = bandwidth.ParseRate(c.Max); err != nil {
+		return schedule, err
+	}
+	for _, w := range c.Schedules {
+		window, err := bandwidth.ParseWindow(w.From, w.To, w.Max)
+		if err != nil {
+			return schedule, err
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	return schedule, nil
+}
+
+// RetryConfig limits the retries of requests failing with a network,
+// throttling or server error, zero values keep the defaults
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" json:"max_attempts"` // 1 disables retries
+	BaseDelay   time.Duration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay" json:"max_delay"`
+}
+
+// ReplicasConfig is the replica set every upload is written to besides the primary bucket
+type ReplicasConfig struct {
+	Mode    string          `yaml:"mode" json:"mode"` // quorum or all, defaults to quorum
+	Targets []ReplicaConfig `yaml:"targets" json:"targets"`
+}
+
+// ErasureConfig stores every upload as data + parity shards, one per target,
+// instead of storing it in the bucket
+type ErasureConfig struct {
+	DataShards   int             `yaml:"data_shards" json:"data_shards"`
+	ParityShards int             `yaml:"parity_shards" json:"parity_shards"`
+	Targets      []ReplicaConfig `yaml:"targets" json:"targets"`
+}
+
+type ReplicaConfig struct {
+	ClientType string `yaml:"client_type" json:"client_type"`
+	Endpoint   string `yaml:"endpoint" json:"endpoint"` // the root directory for the local client type
+	Bucket     string `yaml:"bucket" json:"bucket"`
 }
 
 const (
@@ -23,6 +90,24 @@ const (
 	environmentKeyOssSk = "S3_ACCESS_KEY_SECRET"
 )
 
+// credentials of a single client type, they override the ones above
+// when several backends are used at once, e.g. by migrate
+var environmentKeysByClientType = map[string][2]string{
+	"oss": {"OSS_ACCESS_KEY_ID", "OSS_ACCESS_KEY_SECRET"},
+	"s3":  {"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+}
+
+// Credentials returns the access key and secret key of a client type
+func (c *Config) Credentials(clientType string) (accessKey, secretKey string) {
+	if keys, ok := environmentKeysByClientType[clientType]; ok {
+		ak, sk := os.Getenv(keys[0]), os.Getenv(keys[1])
+		if ak != "" && sk != "" {
+			return ak, sk
+		}
+	}
+	return c.AccessKey, c.SecretKey
+}
+
 func NewConfig() (*Config, error) {
 	c := &Config{}
 
@@ -48,6 +133,11 @@ func NewConfig() (*Config, error) {
 		configToUpdate.Bucket = fileCfg.Bucket
 		configToUpdate.Endpoint = fileCfg.Endpoint
 		configToUpdate.ClientType = fileCfg.ClientType
+		configToUpdate.Trash = fileCfg.Trash
+		configToUpdate.Replicas = fileCfg.Replicas
+		configToUpdate.Erasure = fileCfg.Erasure
+		configToUpdate.Retry = fileCfg.Retry
+		configToUpdate.Bandwidth = fileCfg.Bandwidth
 
 		return configToUpdate, nil
 	}
@@ -84,9 +174,42 @@ const (
 
 func (c *Config) Validate() error {
 	switch c.ClientType {
-	case "oss":
-		return nil
+	case "oss", "s3", "local":
 	default:
 		return errors.New("invalid client type")
 	}
+
+	if c.Replicas.Mode != "" {
+		if err := ReplicaMode(c.Replicas.Mode).Validate(); err != nil {
+			return err
+		}
+	}
+	for _, target := range append(c.Replicas.Targets, c.Erasure.Targets...) {
+		if err := S3ClientType(target.ClientType).Validate(); err != nil {
+			return fmt.Errorf("replica %s: %w", target.Endpoint, err)
+		}
+		if target.Endpoint == "" || target.Bucket == "" {
+			return errors.New("replica endpoint and bucket cannot be empty")
+		}
+	}
+
+	if c.Retry.MaxAttempts < 0 || c.Retry.BaseDelay < 0 || c.Retry.MaxDelay < 0 {
+		return errors.New("retry limits cannot be negative")
+	}
+
+	if _, err := c.Bandwidth.Schedule(); err != nil {
+		return fmt.Errorf("bandwidth: %w", err)
+	}
+
+	if len(c.Erasure.Targets) > 0 {
+		if len(c.Replicas.Targets) > 0 {
+			return errors.New("replicas and erasure can not be used together")
+		}
+		e := c.Erasure
+		if e.DataShards <= 0 || e.ParityShards <= 0 || e.DataShards+e.ParityShards != len(e.Targets) {
+			return fmt.Errorf("erasure needs data_shards + parity_shards targets, got %d+%d shards and %d targets",
+				e.DataShards, e.ParityShards, len(e.Targets))
+		}
+	}
+	return nil
 }
@@ -1,27 +1,44 @@
 package controller
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/bandwidth"
+	"github.com/linlanniao/soss/pkg/bufpool"
+	"github.com/linlanniao/soss/pkg/progress"
+	"github.com/linlanniao/soss/pkg/utils"
 	"github.com/lmittmann/tint"
 )
 
+// Controller runs the operations of the commands. Its settings are fixed once
+// it's built, the methods only read them, so a Controller is safe for
+// concurrent use, e.g. by uploads to different buckets.
 type Controller struct {
 	clients     S3Clients
 	fileHandler internal.IFileHandler
-	endpoint    string
-	bucket      string
+	endpoint    string // default endpoint of the calls, see target
+	bucket      string // default bucket of the calls, see target
 	logger      *slog.Logger
 	isCompress  bool
+	trash       bool
+
+	replicas    []*Replica
+	replicaMode ReplicaMode
+	erasure     *ErasureSet
+
+	jobs        int                // concurrent transfers, see parallelism
+	bandwidth   *bandwidth.Limiter // nil for unlimited
+	memoryLimit int64              // bytes of files in flight, see newScheduler
+	progress    progress.Sink      // nil when progress is not reported
+	observer    *Observer          // nil when nobody observes the transfers
 }
 
 type Option func(c *Controller)
@@ -62,12 +79,31 @@ func WithBucket(bucket string) Option {
 	}
 }
 
+// target returns the endpoint and bucket of a call, those of its options or
+// the defaults. The defaults are never changed by a call.
+func (c *Controller) target(endpoint, bucket string) (string, string) {
+	if endpoint == "" {
+		endpoint = c.endpoint
+	}
+	if bucket == "" {
+		bucket = c.bucket
+	}
+	return endpoint, bucket
+}
+
 func WithCompression() Option {
 	return func(c *Controller) {
 		c.isCompress = true
 	}
 }
 
+// WithTrash moves deleted objects to the trash prefix instead of deleting them
+func WithTrash() Option {
+	return func(c *Controller) {
+		c.trash = true
+	}
+}
+
 func WithS3Client(key S3ClientType, client internal.IS3Client) Option {
 	return func(c *Controller) {
 		if len(c.clients) == 0 {
@@ -85,12 +121,14 @@ func WithFileHandler(handler internal.IFileHandler) Option {
 type S3ClientType string
 
 const (
-	S3ClientTypeOSS S3ClientType = "oss"
+	S3ClientTypeOSS   S3ClientType = "oss"
+	S3ClientTypeS3    S3ClientType = "s3"    // S3 compatible services, e.g. MinIO
+	S3ClientTypeLocal S3ClientType = "local" // a local directory, e.g. a NAS mount
 )
 
 func (t S3ClientType) Validate() error {
 	switch t {
-	case S3ClientTypeOSS:
+	case S3ClientTypeOSS, S3ClientTypeS3, S3ClientTypeLocal:
 		return nil
 	default:
 		return errors.New("invalid client type")
@@ -129,6 +167,16 @@ func NewController(opts ...Option) *Controller {
 	if len(c.clients) == 0 {
 		panic("clients is empty")
 	}
+	if c.erasure != nil {
+		if err := c.erasure.Validate(); err != nil {
+			panic("erasure: " + err.Error())
+		}
+		if len(c.replicas) > 0 {
+			panic("replicas and erasure can not be used together")
+		}
+	}
+
+	c.throttleClients()
 
 	return c
 }
@@ -140,31 +188,25 @@ type ListOptions struct {
 	Prefix       string
 }
 
-func (c *Controller) List(opts ListOptions) error {
+// List returns the objects below the prefix
+func (c *Controller) List(ctx context.Context, opts ListOptions) ([]*internal.S3Object, error) {
 
-	if opts.Endpoint != "" {
-		c.endpoint = opts.Endpoint
-	}
-	if opts.Bucket != "" {
-		c.bucket = opts.Bucket
-	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
 
 	client, err := c.getClient(opts.S3ClientType)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	objs, err := client.List(c.endpoint, c.bucket, opts.Prefix)
+	c.observer.listStart("list", opts.Prefix)
+	objs, err := c.listObjects(ctx, endpoint, bucket, opts.Prefix, client)
 
 	if err != nil {
 		c.logger.Error(err.Error())
-		return err
+		c.observer.fail("list", "", opts.Prefix, err)
+		return nil, err
 	}
-
-	for _, obj := range objs {
-		fmt.Println(obj.Key)
-	}
-	return nil
+	return objs, nil
 }
 
 func trimDirectory(path, file string) string {
@@ -189,31 +231,66 @@ func trimDirectory(path, file string) string {
 	return trimmedPath
 }
 
-func (c *Controller) uploadSingleFile(endpoint, bucket, prefix, path, encryptKey string, client internal.IS3Client) error {
-	file, err := c.fileHandler.Read(path)
+// sameBuffer reports whether a and b share their backing array
+func sameBuffer(a, b []byte) bool {
+	return cap(a) > 0 && cap(b) > 0 && &a[:cap(a)][cap(a)-1] == &b[:cap(b)][cap(b)-1]
+}
+
+// uploadPrefix returns the prefix a file found under root is uploaded to,
+// the directory structure below root is kept
+func uploadPrefix(prefix, root, file string) string {
+	if filepath.Clean(root) == filepath.Clean(file) {
+		return prefix
+	}
+	return filepath.Join(prefix, filepath.Dir(trimDirectory(root, file)))
+}
+
+func (c *Controller) uploadSingleFile(
+	ctx context.Context, endpoint, bucket, prefix, path, encryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client) (obj *internal.S3Object, err error) {
+	ctx, done := c.observeUpload(ctx, prefix, path)
+	defer func() { done(obj, err) }()
+
+	file, err := c.fileHandler.Read(ctx, path)
 	if err != nil {
 		c.logger.Error("upload failed", "err", err.Error())
-		return err
+		return nil, err
+	}
+	// the plain content goes back to the pool once it has been compressed and
+	// encrypted into new buffers, the clients only see the encrypted copy
+	raw := file.Content
+	defer func() {
+		if !sameBuffer(raw, file.Content) {
+			bufpool.Put(raw)
+		}
+	}()
+
+	// capture file metadata, it's encrypted along with the content
+	file.Meta, err = c.fileHandler.ReadMeta(ctx, path, metaOpts)
+	if err != nil {
+		c.logger.Error("read file metadata failed", "err", err.Error())
+		return nil, err
 	}
+	file.Meta.Checksum = utils.Sha256Hex(file.Content)
 
 	// compress file content
 	if c.isCompress {
 		if err := c.fileHandler.Compress(file); err != nil {
 			c.logger.Error("compress file failed", "err", err.Error())
-			return err
+			return nil, err
 		}
 	}
 
 	// encrypt file content
 	if err := c.fileHandler.Encrypt(file, encryptKey); err != nil {
 		c.logger.Error("encrypt file failed", "err", err.Error())
-		return err
+		return nil, err
 	}
 
-	obj, err := client.Upload(endpoint, bucket, prefix, file)
+	setUploadSize(ctx, int64(len(raw)), c.wireSize(int64(len(file.Content))))
+	obj, err = c.putObject(ctx, endpoint, bucket, prefix, file, client)
 	if err != nil {
 		c.logger.Error("upload failed", "err", err.Error())
-		return err
+		return nil, err
 	}
 	//c.logger.Info(fmt.Sprintf("uploading %s to %s", file, ossFileKey))
 
@@ -225,16 +302,27 @@ func (c *Controller) uploadSingleFile(endpoint, bucket, prefix, path, encryptKey
 		"to", obj.Bucket+":"+obj.Key,
 		"size(bytes)", obj.Size,
 	)
-	return nil
+	return obj, nil
 }
 
-const (
-	uploadParallelism   = 10
-	downloadParallelism = 10
-)
-
+// UploadDirectoryOrFile uploads a file, or every file below a directory
 func (c *Controller) UploadDirectoryOrFile(
-	endpoint, bucket, prefix, path, encryptKey string, client internal.IS3Client) error {
+	ctx context.Context, endpoint, bucket, prefix, path, encryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client, report *TransferReport) {
+	tasks := c.uploadTasks(ctx, endpoint, bucket, prefix, path, encryptKey, metaOpts, client, report)
+	c.runTransfers(ctx, "upload", tasks)
+}
+
+// uploadTasks plans the upload of a file, or of every file below a directory.
+// A path that can't be read is reported as failed right away.
+func (c *Controller) uploadTasks(
+	ctx context.Context, endpoint, bucket, prefix, path, encryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client, report *TransferReport) []transferTask {
+	fail := func(path string, err error) []transferTask {
+		c.observer.fail("upload", path, "", err)
+		report.plan(1)
+		report.add(&TransferResult{Path: path, Err: err})
+		return nil
+	}
+
 	fileInfo, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -242,45 +330,48 @@ func (c *Controller) UploadDirectoryOrFile(
 		} else {
 			c.logger.Error(err.Error())
 		}
-		return err
+		return fail(path, err)
 	}
 
-	if fileInfo.IsDir() {
-		files, err := c.fileHandler.SearchFiles(path)
+	upload := func(prefix, file string, size int64) {
+		ctx := c.startFile(ctx, "upload", file, "", size)
+		obj, err := c.uploadSingleFile(ctx, endpoint, bucket, prefix, file, encryptKey, metaOpts, client)
 		if err != nil {
-			c.logger.Error(err.Error())
-			return err
+			c.logger.Error("error uploading file", "file", file, "error", err.Error())
+			key := filepath.Join(prefix, filepath.Base(file))
+			c.finishFile("upload", file, key, size, err)
+			report.add(&TransferResult{Path: file, Key: key, Err: err})
+			return
 		}
+		c.finishFile("upload", file, obj.Key, size, nil)
+		report.add(&TransferResult{Path: file, Key: obj.Key, Size: obj.Size, ETag: obj.ETag, LastModified: obj.LastModified})
+	}
 
-		var wg sync.WaitGroup
-		//limiter := make(chan struct{}, uploadParallelism)
-		limiter := make(chan struct{}, runtime.NumCPU()*2)
-
-		for _, file := range files {
-			wg.Add(1)
-			limiter <- struct{}{} // Take up a concurrent signal
-
-			go func(file string) {
-				defer func() {
-					<-limiter // Release a concurrent signal
-					wg.Done()
-				}()
-
-				subPrefix := filepath.Join(prefix, filepath.Dir(trimDirectory(path, file)))
-				if err := c.uploadSingleFile(endpoint, bucket, subPrefix, file, encryptKey, client); err != nil {
-					c.logger.Error("error uploading file", "file", file, "error", err.Error())
-				}
-			}(file)
-		}
+	if !fileInfo.IsDir() {
+		report.plan(1)
+		return []transferTask{{size: fileInfo.Size(), run: func() { upload(prefix, path, fileInfo.Size()) }}}
+	}
 
-		wg.Wait()
-	} else {
-		if err := c.uploadSingleFile(endpoint, bucket, prefix, path, encryptKey, client); err != nil {
-			return err
-		}
+	c.observer.listStart("upload", path)
+	files, err := c.fileHandler.SearchFiles(ctx, path)
+	if err != nil {
+		c.logger.Error(err.Error())
+		return fail(path, err)
 	}
 
-	return nil
+	tasks := make([]transferTask, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			c.logger.Error("error uploading file", "file", file, "error", err.Error())
+			fail(file, err)
+			continue
+		}
+		subPrefix := uploadPrefix(prefix, path, file)
+		tasks = append(tasks, transferTask{size: info.Size(), run: func() { upload(subPrefix, file, info.Size()) }})
+	}
+	report.plan(len(tasks))
+	return tasks
 }
 
 type UploadOptions struct {
@@ -290,51 +381,72 @@ type UploadOptions struct {
 	Prefix       string
 	EncryptKey   string
 	Paths        []string
+	Xattrs       bool // if true, extended attributes are uploaded with the file metadata
 }
 
-func (c *Controller) Upload(opts UploadOptions) error {
-	if opts.Endpoint != "" {
-		c.endpoint = opts.Endpoint
-	}
-	if opts.Bucket != "" {
-		c.bucket = opts.Bucket
-	}
+// Upload uploads the paths, the report holds a result per file and is
+// returned along with the error of a partly failed batch
+func (c *Controller) Upload(ctx context.Context, opts UploadOptions) (*TransferReport, error) {
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
 
 	client, err := c.getClient(opts.S3ClientType)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(opts.Paths) == 0 {
 		err := errors.New("no files to upload")
 		c.logger.Error("upload failed", "err", err.Error())
-		return err
+		return nil, err
+	}
+
+	if len(c.replicas) > 0 || c.erasure != nil {
+		// per upload, concurrent uploads of the controller count their own writes
+		stats := newReplicaStats()
+		ctx = withReplicaStats(ctx, stats)
+		defer c.logReplicaStats(stats)
 	}
 
+	metaOpts := internal.MetaOptions{Owner: true, Xattrs: opts.Xattrs}
+	report := newTransferReport("upload", c.retries)
+	// one scheduler for all paths, it bounds the workers and memory of the whole upload
+	tasks := make([]transferTask, 0)
 	for _, path := range opts.Paths {
-		if err := c.UploadDirectoryOrFile(c.endpoint, c.bucket, opts.Prefix, path, opts.EncryptKey, client); err != nil {
-			c.logger.Error("upload failed", "err", err.Error())
-			return err
-		}
+		tasks = append(tasks, c.uploadTasks(ctx, endpoint, bucket, opts.Prefix, path, opts.EncryptKey, metaOpts, client, report)...)
 	}
+	c.runTransfers(ctx, "upload", tasks)
 
-	return nil
+	err = report.finish(ctx, c.logger)
+	c.observer.batchDone("upload", report, err)
+	return report, err
 }
 
 func (c *Controller) downloadSingleFile(
-	endpoint, bucket, s3key, outputDir, decryptKey string, client internal.IS3Client) error {
-	file, err := client.Download(
-		&internal.S3Object{
+	ctx context.Context, endpoint, bucket, s3key, outputDir, decryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client) error {
+	return c.downloadSingleFileTo(ctx, endpoint, bucket, s3key, filepath.Join(outputDir, s3key), decryptKey, metaOpts, client)
+}
+
+// downloadSingleFileTo downloads the object and saves it to savePath
+func (c *Controller) downloadSingleFileTo(
+	ctx context.Context, endpoint, bucket, s3key, savePath, decryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client) (err error) {
+	var size int64
+	ctx, done := c.observeDownload(ctx, s3key, savePath)
+	defer func() { done(size, err) }()
+
+	file, err := c.getObject(
+		ctx, &internal.S3Object{
 			Endpoint: endpoint,
 			Bucket:   bucket,
 			Key:      s3key,
 		},
-		outputDir,
+		client,
 	)
 	if err != nil {
 		c.logger.Error("download failed", "key", s3key, "err", err.Error())
 		return err
 	}
+	size = int64(len(file.Content))
+	file.Path = savePath
 
 	// decrypt file content
 	if err := c.fileHandler.Decrypt(file, decryptKey); err != nil {
@@ -350,11 +462,19 @@ func (c *Controller) downloadSingleFile(
 		}
 	}
 
-	if err := c.fileHandler.Write(file); err != nil {
+	if err := c.fileHandler.Write(ctx, file); err != nil {
 		c.logger.Error("decrypt file failed", "err", err.Error())
 		return err
 	}
 
+	// restore file metadata, objects uploaded by older versions have none
+	if file.Meta != nil {
+		if err := c.fileHandler.WriteMeta(ctx, file.Path, file.Meta, metaOpts); err != nil {
+			c.logger.Error("restore file metadata failed", "key", s3key, "err", err.Error())
+			return err
+		}
+	}
+
 	//if !filepath.IsAbs(file.Path) {
 	//	file.Path = "./" + file.Path
 	//}
@@ -367,37 +487,45 @@ func (c *Controller) downloadSingleFile(
 	return nil
 }
 
-func (c *Controller) downloadDirectoryOrFile(
-	endpoint, bucket, s3key, outputDir, decryptKey string, client internal.IS3Client) error {
-	objs, err := client.List(endpoint, bucket, s3key)
-	if err != nil {
-		c.logger.Error("download directory or file failed", "key", s3key, "err", err.Error())
-		return err
-	}
-	if len(objs) == 0 {
+// downloadTasks plans the download of an object, or of every object below a
+// prefix. A key that can't be listed or matches nothing is reported as failed
+// right away.
+func (c *Controller) downloadTasks(
+	ctx context.Context, endpoint, bucket, s3key, outputDir, decryptKey string, metaOpts internal.MetaOptions, client internal.IS3Client, report *TransferReport) []transferTask {
+	c.observer.listStart("download", s3key)
+	objs, err := c.listObjects(ctx, endpoint, bucket, s3key, client)
+	if err == nil && len(objs) == 0 {
 		err = errors.New("directory or file not found")
+	}
+	if err != nil {
 		c.logger.Error("download directory or file failed", "key", s3key, "err", err.Error())
+		c.observer.fail("download", "", s3key, err)
+		report.plan(1)
+		report.add(&TransferResult{Key: s3key, Err: err})
+		return nil
 	}
-	var wg sync.WaitGroup
-	//limiter := make(chan struct{}, downloadParallelism)
-	limiter := make(chan struct{}, runtime.NumCPU()*2)
 
+	tasks := make([]transferTask, 0, len(objs))
 	for _, obj := range objs {
-		wg.Add(1)
-		limiter <- struct{}{} // Take up a concurrent signal
-
-		go func(obj *internal.S3Object) {
-			defer func() {
-				<-limiter // Release a concurrent signal
-				wg.Done()
-			}()
-			if err := c.downloadSingleFile(endpoint, bucket, obj.Key, outputDir, decryptKey, client); err != nil {
+		tasks = append(tasks, transferTask{size: obj.Size, run: func() {
+			result := &TransferResult{
+				Path:         filepath.Join(outputDir, obj.Key),
+				Key:          obj.Key,
+				Size:         obj.Size,
+				ETag:         obj.ETag,
+				LastModified: obj.LastModified,
+			}
+			ctx := c.startFile(ctx, "download", result.Path, obj.Key, obj.Size)
+			if err := c.downloadSingleFile(ctx, endpoint, bucket, obj.Key, outputDir, decryptKey, metaOpts, client); err != nil {
 				c.logger.Error("download directory or file failed", "key", obj.Key, "err", err.Error())
+				result.Err = err
 			}
-		}(obj)
+			c.finishFile("download", result.Path, obj.Key, obj.Size, result.Err)
+			report.add(result)
+		}})
 	}
-	wg.Wait()
-	return nil
+	report.plan(len(tasks))
+	return tasks
 }
 
 type DownloadOptions struct {
@@ -407,31 +535,36 @@ type DownloadOptions struct {
 	OutputDir    string
 	DecryptKey   string
 	S3keys       []string
+	NoOwner      bool // if true, uid / gid are not restored
+	NoXattrs     bool // if true, extended attributes are not restored
 }
 
-func (c *Controller) Download(opts DownloadOptions) error {
-	if opts.Endpoint != "" {
-		c.endpoint = opts.Endpoint
-	}
-	if opts.Bucket != "" {
-		c.bucket = opts.Bucket
-	}
+// Download downloads the keys, the report holds a result per file and is
+// returned along with the error of a partly failed batch
+func (c *Controller) Download(ctx context.Context, opts DownloadOptions) (*TransferReport, error) {
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
 
 	client, err := c.getClient(opts.S3ClientType)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(opts.S3keys) == 0 {
 		err := errors.New("no files to download")
 		c.logger.Error(err.Error())
-		return err
+		return nil, err
 	}
 
+	metaOpts := internal.MetaOptions{Owner: !opts.NoOwner, Xattrs: !opts.NoXattrs}
+	report := newTransferReport("download", c.retries)
+	// one scheduler for all keys, it bounds the workers and memory of the whole download
+	tasks := make([]transferTask, 0)
 	for _, s3key := range opts.S3keys {
-		if err := c.downloadDirectoryOrFile(c.endpoint, c.bucket, s3key, opts.OutputDir, opts.DecryptKey, client); err != nil {
-			return err
-		}
+		tasks = append(tasks, c.downloadTasks(ctx, endpoint, bucket, s3key, opts.OutputDir, opts.DecryptKey, metaOpts, client, report)...)
 	}
-	return nil
+	c.runTransfers(ctx, "download", tasks)
+
+	err = report.finish(ctx, c.logger)
+	c.observer.batchDone("download", report, err)
+	return report, err
 }
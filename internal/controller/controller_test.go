@@ -1,6 +1,7 @@
 package controller_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -38,7 +39,7 @@ func newTestCtrl() *controller.Controller {
 
 func TestController_List(t *testing.T) {
 	c := newTestCtrl()
-	err := c.List(controller.ListOptions{
+	_, err := c.List(context.Background(), controller.ListOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 	})
 	assert.NoError(t, err)
@@ -48,7 +49,7 @@ func TestController_UploadDir(t *testing.T) {
 	c := newTestCtrl()
 	homeDir, _ := os.UserHomeDir()
 	p := filepath.Join(homeDir, "Downloads/tester")
-	err := c.Upload(controller.UploadOptions{
+	_, err := c.Upload(context.Background(), controller.UploadOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 		Prefix:       "tester3",
 		EncryptKey:   secretKey,
@@ -60,7 +61,7 @@ func TestController_UploadSingleFile(t *testing.T) {
 	c := newTestCtrl()
 	homeDir, _ := os.UserHomeDir()
 	p := filepath.Join(homeDir, "Downloads/README.md")
-	err := c.Upload(controller.UploadOptions{
+	_, err := c.Upload(context.Background(), controller.UploadOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 		Prefix:       "tester3",
 		EncryptKey:   secretKey,
@@ -71,7 +72,7 @@ func TestController_UploadSingleFile(t *testing.T) {
 
 func TestController_Download(t *testing.T) {
 	c := newTestCtrl()
-	err := c.Download(controller.DownloadOptions{
+	_, err := c.Download(context.Background(), controller.DownloadOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 		OutputDir:    "../../tmpdir",
 		DecryptKey:   secretKey,
@@ -131,7 +132,7 @@ func TestController_UploadDownload(t *testing.T) {
 	}
 
 	c := newTestCtrl()
-	err := c.Upload(controller.UploadOptions{
+	_, err := c.Upload(context.Background(), controller.UploadOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 		Prefix:       prefix,
 		EncryptKey:   secretKey,
@@ -139,7 +140,7 @@ func TestController_UploadDownload(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	err = c.Download(controller.DownloadOptions{
+	_, err = c.Download(context.Background(), controller.DownloadOptions{
 		S3ClientType: controller.S3ClientTypeOSS,
 		OutputDir:    downloadDir,
 		DecryptKey:   secretKey,
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+type CopyOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	S3keys       []string // source keys, or prefixes with Recursive
+	Recursive    bool     // if true, everything below each source key is copied
+
+	// destination, empty values default to the source ones
+	DstClientType S3ClientType
+	DstEndpoint   string
+	DstBucket     string
+	DstKey        string // key, or prefix with several sources, Recursive or a trailing "/"
+
+	DecryptKey string // needed only to re-encrypt with EncryptKey
+	EncryptKey string // if set and different from DecryptKey, the objects are re-encrypted with it
+	Move       bool   // if true, the sources are deleted once copied, moved to the trash with WithTrash
+	DryRun     bool   // if true, only return what would be copied
+}
+
+// CopyItem is an object copied, or to be copied, to its destination
+type CopyItem struct {
+	SrcBucket string
+	Src       string
+	DstBucket string
+	Dst       string
+	Size      int64
+}
+
+// copyDestination maps a source object key to its destination key
+func copyDestination(srcKey, source, dstKey string, recursive, toPrefix bool) string {
+	if recursive {
+		// "mv -r old new" moves old/a.txt to new/a.txt
+		rel := strings.TrimPrefix(srcKey, listPrefix(source))
+		if srcKey == source {
+			rel = path.Base(srcKey)
+		}
+		return path.Join(dstKey, rel)
+	}
+	if toPrefix {
+		return path.Join(dstKey, path.Base(srcKey))
+	}
+	return dstKey
+}
+
+// reseal re-encrypts downloaded content and metadata from decryptKey to encryptKey
+func (c *Controller) reseal(file *internal.File, decryptKey, encryptKey string) error {
+	if err := c.fileHandler.Decrypt(file, decryptKey); err != nil {
+		return err
+	}
+	return c.fileHandler.Encrypt(file, encryptKey)
+}
+
+// copyObject copies one object through the local machine, used when the
+// destination is another backend or the content has to be re-encrypted
+func (c *Controller) copyObject(
+	ctx context.Context, src, dst *internal.S3Object, decryptKey, encryptKey string, srcClient, dstClient internal.IS3Client) error {
+	file, err := srcClient.Download(ctx, src, "")
+	if err != nil {
+		return err
+	}
+
+	// the compressed content is kept as is, only the encryption changes
+	if encryptKey != "" && encryptKey != decryptKey {
+		if err := c.reseal(file, decryptKey, encryptKey); err != nil {
+			return err
+		}
+	}
+
+	prefix := path.Dir(dst.Key)
+	if prefix == "." {
+		prefix = ""
+	}
+	file.Path = path.Base(dst.Key)
+	_, err = dstClient.Upload(ctx, dst.Endpoint, dst.Bucket, prefix, file)
+	return err
+}
+
+// Copy copies objects to another key, prefix or bucket. Objects are copied on
+// the server when the source and the destination share the backend and the
+// encryption key, otherwise they are downloaded, re-encrypted and uploaded.
+// It returns the objects copied, with DryRun the ones that would be copied.
+func (c *Controller) Copy(ctx context.Context, opts CopyOptions) ([]*CopyItem, error) {
+	if err := c.requireBucket("copy"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+	if opts.DstClientType == "" {
+		opts.DstClientType = opts.S3ClientType
+	}
+	if opts.DstEndpoint == "" {
+		opts.DstEndpoint = endpoint
+	}
+	if opts.DstBucket == "" {
+		opts.DstBucket = bucket
+	}
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+	dstClient, err := c.getClient(opts.DstClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.S3keys) == 0 {
+		err := errors.New("no files to copy")
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+	if opts.EncryptKey != "" && opts.EncryptKey != opts.DecryptKey && opts.DecryptKey == "" {
+		err := errors.New("decrypt key is required to re-encrypt")
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+
+	toPrefix := len(opts.S3keys) > 1 || opts.DstKey == "" || strings.HasSuffix(opts.DstKey, "/")
+	serverSide := opts.DstClientType == opts.S3ClientType && opts.DstEndpoint == endpoint &&
+		(opts.EncryptKey == "" || opts.EncryptKey == opts.DecryptKey)
+
+	seen := make(map[string]struct{})
+	items := make([]*CopyItem, 0)
+	var size int64
+	for _, s3key := range opts.S3keys {
+		objs, err := c.matchObjects(ctx, endpoint, bucket, s3key, opts.Recursive, client)
+		if err != nil {
+			c.logger.Error("copy failed", "err", err.Error())
+			return nil, err
+		}
+		for _, obj := range objs {
+			dst := copyDestination(obj.Key, s3key, opts.DstKey, opts.Recursive, toPrefix)
+			if opts.DstBucket == bucket && opts.DstEndpoint == endpoint && dst == obj.Key {
+				err := fmt.Errorf("%s: source and destination are the same", obj.Key)
+				c.logger.Error("copy failed", "err", err.Error())
+				return nil, err
+			}
+			if _, ok := seen[dst]; ok {
+				err := fmt.Errorf("%s: several sources copy to the same destination", dst)
+				c.logger.Error("copy failed", "err", err.Error())
+				return nil, err
+			}
+			seen[dst] = struct{}{}
+			items = append(items, &CopyItem{SrcBucket: bucket, Src: obj.Key, DstBucket: opts.DstBucket, Dst: dst, Size: obj.Size})
+			size += obj.Size
+		}
+	}
+
+	if len(items) == 0 {
+		c.logger.Info("nothing to copy")
+		return items, nil
+	}
+	if opts.DryRun {
+		c.logger.Info("copy plan", "objects", len(items), "size(bytes)", size, "serverSide", serverSide)
+		return items, nil
+	}
+
+	var mu sync.Mutex
+	copied := make([]*CopyItem, 0, len(items))
+	report := newTransferReport("copy", c.retries)
+	report.plan(len(items))
+	tasks := make([]transferTask, 0, len(items))
+	for _, item := range items {
+		// a server side copy holds nothing in memory
+		size := item.Size
+		if serverSide {
+			size = 0
+		}
+		tasks = append(tasks, transferTask{size: size, run: func() {
+			var err error
+			if serverSide {
+				err = client.Copy(ctx, endpoint, bucket, item.Src, opts.DstBucket, item.Dst)
+			} else {
+				err = c.copyObject(
+					ctx, &internal.S3Object{Endpoint: endpoint, Bucket: bucket, Key: item.Src},
+					&internal.S3Object{Endpoint: opts.DstEndpoint, Bucket: opts.DstBucket, Key: item.Dst},
+					opts.DecryptKey, opts.EncryptKey, client, dstClient)
+			}
+
+			report.add(&TransferResult{Key: item.Src, Size: item.Size, Err: err})
+			if err != nil {
+				c.logger.Error("copy failed", "key", item.Src, "err", err.Error())
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			copied = append(copied, item)
+			c.logger.Info("copied", "from", bucket+":"+item.Src, "to", opts.DstBucket+":"+item.Dst)
+		}})
+	}
+	c.newScheduler().run(ctx, tasks)
+	if err := ctx.Err(); err != nil {
+		return copied, report.finish(ctx, c.logger)
+	}
+
+	// only the sources that have been copied are deleted
+	if opts.Move && len(copied) > 0 {
+		sources := make([]string, 0, len(copied))
+		for _, item := range copied {
+			sources = append(sources, item.Src)
+		}
+		deleted, err := c.deleteObjects(ctx, endpoint, bucket, sources, c.trash, client)
+		c.logger.Info("sources removed", "objects", len(deleted))
+		if err != nil {
+			c.logger.Error("remove sources failed", "err", err.Error())
+			return copied, err
+		}
+	}
+
+	return copied, report.finish(ctx, c.logger)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyDestination(t *testing.T) {
+	// a prefix moves its content
+	assert.Equal(t, "new/a/b.txt", copyDestination("old/a/b.txt", "old", "new", true, false))
+	assert.Equal(t, "new/a/b.txt", copyDestination("old/a/b.txt", "old/", "new/", true, true))
+	assert.Equal(t, "new/old", copyDestination("old", "old", "new", true, false))
+
+	// a single key is renamed, or copied into a prefix
+	assert.Equal(t, "new.txt", copyDestination("data/a.txt", "data/a.txt", "new.txt", false, false))
+	assert.Equal(t, "archive/a.txt", copyDestination("data/a.txt", "data/a.txt", "archive/", false, true))
+	assert.Equal(t, "a.txt", copyDestination("data/a.txt", "data/a.txt", "", false, true))
+}
+
+// readObject downloads and decrypts an object
+func readObject(t *testing.T, c *Controller, mem *memClient, key, decryptKey string) string {
+	file, err := c.getObject(context.Background(), &internal.S3Object{Endpoint: "ep", Bucket: "bucket", Key: key}, mem)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	assert.NoError(t, c.fileHandler.Decrypt(file, decryptKey))
+	assert.NoError(t, c.fileHandler.Decompress(file))
+	return string(file.Content)
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	putEncrypted(t, c, mem, "ep", "bucket", "data/a.txt", "a", "k")
+	putEncrypted(t, c, mem, "ep", "bucket", "data/b.txt", "b", "k")
+	opts := CopyOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", S3keys: []string{"data"}, Recursive: true}
+
+	// server side, the stored bytes are copied as they are
+	opts.DstKey = "copy"
+	copied, err := c.Copy(ctx, opts)
+	assert.NoError(t, err)
+	assert.Len(t, copied, 2)
+	assert.Equal(t, "a", readObject(t, c, mem, "copy/a.txt", "k"))
+
+	// re-encrypted with another key
+	opts.DstKey, opts.DecryptKey, opts.EncryptKey = "rekeyed", "k", "k2"
+	_, err = c.Copy(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", readObject(t, c, mem, "rekeyed/b.txt", "k2"))
+
+	// an object of another key can not be re-encrypted, the others are copied
+	putEncrypted(t, c, mem, "ep", "bucket", "data/c.txt", "c", "other")
+	opts.DstKey = "partial"
+	copied, err = c.Copy(ctx, opts)
+	assert.True(t, IsPartialFailure(err))
+	var batchErr *BatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, 3, batchErr.Total)
+		assert.Equal(t, 1, batchErr.Failed)
+	}
+	assert.Len(t, copied, 2)
+}
+
+func TestCopy_Move(t *testing.T) {
+	ctx := context.Background()
+	for _, trash := range []bool{false, true} {
+		mem := newMemClient()
+		c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+		c.trash = trash
+		putEncrypted(t, c, mem, "ep", "bucket", "data/a.txt", "a", "k")
+
+		_, err := c.Copy(ctx, CopyOptions{
+			S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", S3keys: []string{"data/a.txt"}, DstKey: "moved.txt", Move: true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "a", readObject(t, c, mem, "moved.txt", "k"))
+
+		objs, err := mem.List(ctx, "ep", "bucket", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"moved.txt"}, keysOf(withoutTrash(objs)))
+		// the source goes to the trash when it is enabled
+		if trash {
+			assert.Len(t, objs, 2)
+		} else {
+			assert.Len(t, objs, 1)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/erasure"
+)
+
+// ErasureSet stores every uploaded object as DataShards + ParityShards
+// Reed-Solomon shards, shard i in Targets[i] under the key of the object.
+// Any DataShards intact shards rebuild the object
+type ErasureSet struct {
+	DataShards   int
+	ParityShards int
+	Targets      []*Replica
+}
+
+func (s *ErasureSet) Validate() error {
+	if s.DataShards <= 0 || s.ParityShards <= 0 {
+		return fmt.Errorf("invalid shard count %d+%d", s.DataShards, s.ParityShards)
+	}
+	if len(s.Targets) != s.DataShards+s.ParityShards {
+		return fmt.Errorf("%d+%d shards need %d targets, got %d",
+			s.DataShards, s.ParityShards, s.DataShards+s.ParityShards, len(s.Targets))
+	}
+	return nil
+}
+
+// WithErasure stores uploaded objects as shards in the targets of the set instead
+// of the bucket, and rebuilds them on download. Only upload, download and list
+// read the shards, the other operations of the controller return an error.
+// NewController panics when the set is invalid.
+func WithErasure(set *ErasureSet) Option {
+	return func(c *Controller) {
+		c.erasure = set
+	}
+}
+
+// requireBucket returns an error when op works on a single bucket and the
+// objects are stored as shards in an erasure set
+func (c *Controller) requireBucket(op string) error {
+	if c.erasure == nil {
+		return nil
+	}
+	err := fmt.Errorf("%s is not supported with erasure coding, only upload, download and list are", op)
+	c.logger.Error(op+" failed", "err", err.Error())
+	return err
+}
+
+// putShards encodes the file and uploads one shard to each target, every shard must be written
+func (c *Controller) putShards(ctx context.Context, prefix string, file *internal.File) (*internal.S3Object, error) {
+	set := c.erasure
+	shards, err := erasure.Encode(file.Content, set.DataShards, set.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := make([]*internal.S3Object, len(set.Targets))
+	errs := make([]error, len(set.Targets))
+
+	var wg sync.WaitGroup
+	for i, target := range set.Targets {
+		wg.Add(1)
+		go func(i int, target *Replica) {
+			defer wg.Done()
+			shard := &internal.File{Path: file.Path, Content: shards[i], EncryptedMeta: file.EncryptedMeta}
+			objs[i], errs[i] = target.Client.Upload(ctx, target.Endpoint, target.Bucket, prefix, shard)
+		}(i, target)
+	}
+	wg.Wait()
+
+	stats := replicaStatsFrom(ctx)
+	for i, target := range set.Targets {
+		stats.add(target.String(), errs[i])
+		if errs[i] != nil {
+			c.logger.Error("shard upload failed", "shard", i, "target", target.String(), "file", file.Path, "err", errs[i].Error())
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("not every shard written: %w", err)
+	}
+
+	obj := *objs[0]
+	obj.Size = int64(len(file.Content))
+	return &obj, nil
+}
+
+// getShards downloads the shards of an object and rebuilds it, missing or
+// damaged shards are tolerated up to the parity shard count
+func (c *Controller) getShards(ctx context.Context, key string) (*internal.File, error) {
+	set := c.erasure
+	files := make([]*internal.File, len(set.Targets))
+	errs := make([]error, len(set.Targets))
+
+	var wg sync.WaitGroup
+	for i, target := range set.Targets {
+		wg.Add(1)
+		go func(i int, target *Replica) {
+			defer wg.Done()
+			files[i], errs[i] = target.Client.Download(
+				ctx, &internal.S3Object{Endpoint: target.Endpoint, Bucket: target.Bucket, Key: key}, "")
+		}(i, target)
+	}
+	wg.Wait()
+
+	var file *internal.File
+	shards := make([][]byte, len(set.Targets))
+	for i, target := range set.Targets {
+		if errs[i] != nil {
+			c.logger.Warn("shard unavailable", "key", key, "shard", i, "target", target.String(), "err", errs[i].Error())
+			continue
+		}
+		shards[i] = files[i].Content
+		if file == nil {
+			file = files[i]
+		}
+	}
+	if file == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	content, err := erasure.Decode(shards)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild %s: %w", key, err)
+	}
+	file.Content = content
+	return file, nil
+}
+
+// listShards lists a prefix in every target, an object is listed when any of its shards is.
+// The size listed is the one of the object, read from the header of a shard
+func (c *Controller) listShards(ctx context.Context, prefix string) ([]*internal.S3Object, error) {
+	listedBy := make(map[string][]*Replica)
+	objs := make([]*internal.S3Object, 0)
+	errs := make([]error, 0)
+	for _, target := range c.erasure.Targets {
+		targetObjs, err := target.Client.List(ctx, target.Endpoint, target.Bucket, prefix)
+		if err != nil {
+			c.logger.Warn("list failed", "prefix", prefix, "target", target.String(), "err", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		for _, obj := range targetObjs {
+			if _, ok := listedBy[obj.Key]; !ok {
+				objs = append(objs, obj)
+			}
+			listedBy[obj.Key] = append(listedBy[obj.Key], target)
+		}
+	}
+	if len(errs) == len(c.erasure.Targets) {
+		return nil, errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, c.parallelism())
+	for _, obj := range objs {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(obj *internal.S3Object) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+			size, err := shardContentSize(ctx, obj.Key, listedBy[obj.Key])
+			if err != nil {
+				c.logger.Warn("read shard size failed", "key", obj.Key, "err", err.Error())
+				return
+			}
+			obj.Size = size
+		}(obj)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Key < objs[j].Key })
+	return objs, nil
+}
+
+// shardContentSize returns the object size from the first intact shard of key in the targets
+func shardContentSize(ctx context.Context, key string, targets []*Replica) (int64, error) {
+	errs := make([]error, 0, len(targets))
+	for _, target := range targets {
+		file, err := target.Client.Download(
+			ctx, &internal.S3Object{Endpoint: target.Endpoint, Bucket: target.Bucket, Key: key}, "")
+		if err == nil {
+			var size int64
+			if size, err = erasure.Size(file.Content); err == nil {
+				return size, nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target.String(), err))
+	}
+	return 0, errors.Join(errs...)
+}
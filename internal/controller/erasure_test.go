@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErasureSet_Validate(t *testing.T) {
+	targets := make([]*Replica, 3)
+	assert.NoError(t, (&ErasureSet{DataShards: 2, ParityShards: 1, Targets: targets}).Validate())
+	assert.Error(t, (&ErasureSet{DataShards: 2, ParityShards: 2, Targets: targets}).Validate())
+	assert.Error(t, (&ErasureSet{DataShards: 3, ParityShards: 0, Targets: targets}).Validate())
+}
+
+func TestPutGetShards(t *testing.T) {
+	ctx := context.Background()
+	clients := make([]*memClient, 3)
+	targets := make([]*Replica, 3)
+	for i := range targets {
+		clients[i] = newMemClient()
+		targets[i] = &Replica{
+			ClientType: S3ClientTypeLocal, Endpoint: "/nas", Bucket: fmt.Sprintf("b%d", i), Client: clients[i]}
+	}
+
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: newMemClient()})
+	WithErasure(&ErasureSet{DataShards: 2, ParityShards: 1, Targets: targets})(c)
+
+	content := []byte("iam test file, stored as shards")
+	obj, err := c.putObject(ctx, "ep", "a", "data", &internal.File{Path: "a.txt", Content: content, EncryptedMeta: "meta"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/a.txt", obj.Key)
+	assert.Equal(t, int64(len(content)), obj.Size)
+
+	// one shard lost, one target unavailable to list
+	_, err = clients[0].Delete(ctx, "/nas", "b0", []string{"data/a.txt"})
+	assert.NoError(t, err)
+	targets[0].Client = downClient{clients[0]}
+
+	file, err := c.getObject(ctx, &internal.S3Object{Key: "data/a.txt"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, content, file.Content)
+	assert.Equal(t, "meta", file.EncryptedMeta)
+
+	objs, err := c.listObjects(ctx, "ep", "a", "data/", nil)
+	assert.NoError(t, err)
+	if assert.Len(t, objs, 1) {
+		assert.Equal(t, int64(len(content)), objs[0].Size)
+	}
+
+	// a second damaged shard is too many
+	clients[1].objects[memKey("/nas", "b1", "data/a.txt")].content[60] ^= 0xff
+	_, err = c.getObject(ctx, &internal.S3Object{Key: "data/a.txt"}, nil)
+	assert.Error(t, err)
+
+	// every shard must be written
+	_, err = c.putObject(ctx, "ep", "a", "data", &internal.File{Path: "b.txt", Content: content}, nil)
+	assert.ErrorIs(t, err, errUnavailable)
+}
+
+func TestErasure_Operations(t *testing.T) {
+	ctx := context.Background()
+	targets := make([]*Replica, 3)
+	for i := range targets {
+		targets[i] = &Replica{
+			ClientType: S3ClientTypeLocal, Endpoint: "/nas", Bucket: fmt.Sprintf("b%d", i), Client: newMemClient()}
+	}
+
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: newMemClient()})
+	WithErasure(&ErasureSet{DataShards: 2, ParityShards: 1, Targets: targets})(c)
+	uploadFiles(t, c, S3ClientTypeOSS, "ep", "bucket", "data", "k", map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	// the objects exist as shards only, the bucket is empty
+	objs, err := c.List(ctx, ListOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data/a.txt", "data/b.txt"}, keysOf(objs))
+
+	_, err = c.Remove(ctx, RemoveOptions{S3ClientType: S3ClientTypeOSS, S3keys: []string{"data/a.txt"}})
+	assert.ErrorContains(t, err, "not supported with erasure coding")
+	_, err = c.Verify(ctx, VerifyOptions{S3ClientType: S3ClientTypeOSS, Prefix: "data/", DecryptKey: "k"})
+	assert.ErrorContains(t, err, "not supported with erasure coding")
+
+	assert.Panics(t, func() {
+		NewController(
+			WithFileHandler(c.fileHandler),
+			WithS3Client(S3ClientTypeOSS, newMemClient()),
+			WithErasure(&ErasureSet{DataShards: 2, ParityShards: 2, Targets: targets}),
+		)
+	})
+}
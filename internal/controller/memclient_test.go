@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+type memObject struct {
+	content      []byte
+	meta         string
+	lastModified time.Time
+	version      int
+}
+
+// memClient is an in-memory IS3Client, objects are keyed by endpoint, bucket and key
+type memClient struct {
+	mu      sync.Mutex
+	objects map[string]*memObject
+	version int
+}
+
+var _ internal.IS3Client = (*memClient)(nil)
+
+func newMemClient() *memClient {
+	return &memClient{objects: make(map[string]*memObject)}
+}
+
+func memKey(endpoint, bucket, key string) string {
+	return endpoint + "\n" + bucket + "\n" + key
+}
+
+func (m *memClient) put(endpoint, bucket, key string, content []byte, meta string) {
+	m.version++
+	m.objects[memKey(endpoint, bucket, key)] = &memObject{
+		content:      append([]byte(nil), content...),
+		meta:         meta,
+		lastModified: time.Now(),
+		version:      m.version,
+	}
+}
+
+func (m *memClient) s3Object(endpoint, bucket, key string, obj *memObject) *internal.S3Object {
+	return &internal.S3Object{
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		Key:           key,
+		Size:          int64(len(obj.content)),
+		ETag:          strconv.Itoa(obj.version),
+		LastModified:  obj.lastModified,
+		EncryptedMeta: obj.meta,
+	}
+}
+
+func (m *memClient) List(ctx context.Context, endpoint, bucket, prefix string) ([]*internal.S3Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objs := make([]*internal.S3Object, 0)
+	for k, obj := range m.objects {
+		parts := strings.SplitN(k, "\n", 3)
+		if parts[0] == endpoint && parts[1] == bucket && strings.HasPrefix(parts[2], prefix) {
+			objs = append(objs, m.s3Object(endpoint, bucket, parts[2], obj))
+		}
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Key < objs[j].Key })
+	return objs, nil
+}
+
+func (m *memClient) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (*internal.S3Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := filepath.Join(prefix, filepath.Base(file.Path))
+	m.put(endpoint, bucket, key, file.Content, file.EncryptedMeta)
+	return m.s3Object(endpoint, bucket, key, m.objects[memKey(endpoint, bucket, key)]), nil
+}
+
+func (m *memClient) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (*internal.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.objects[memKey(obj.Endpoint, obj.Bucket, obj.Key)]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return &internal.File{
+		Path:          filepath.Join(outputDir, obj.Key),
+		Content:       append([]byte(nil), o.content...),
+		Encrypted:     true,
+		Compressed:    true,
+		EncryptedMeta: o.meta,
+	}, nil
+}
+
+func (m *memClient) Stat(ctx context.Context, obj *internal.S3Object) (*internal.S3Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.objects[memKey(obj.Endpoint, obj.Bucket, obj.Key)]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return m.s3Object(obj.Endpoint, obj.Bucket, obj.Key, o), nil
+}
+
+func (m *memClient) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.objects[memKey(endpoint, srcBucket, srcKey)]
+	if !ok {
+		return errors.New("no such key")
+	}
+	m.put(endpoint, dstBucket, dstKey, o.content, o.meta)
+	return nil
+}
+
+func (m *memClient) Delete(ctx context.Context, endpoint, bucket string, keys []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := m.objects[memKey(endpoint, bucket, key)]; ok {
+			delete(m.objects, memKey(endpoint, bucket, key))
+			deleted = append(deleted, key)
+		}
+	}
+	return deleted, nil
+}
+
+// corrupt flips the last byte of a stored object
+func (m *memClient) corrupt(endpoint, bucket, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content := m.objects[memKey(endpoint, bucket, key)].content
+	content[len(content)-1] ^= 0xff
+}
+
+// uploadFiles writes the files, relative path to content, to a temporary
+// directory and uploads them below prefix with the controller
+func uploadFiles(t *testing.T, c *Controller, cType S3ClientType, endpoint, bucket, prefix, encryptKey string, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	_, err := c.Upload(context.Background(), UploadOptions{
+		S3ClientType: cType, Endpoint: endpoint, Bucket: bucket, Prefix: prefix, EncryptKey: encryptKey, Paths: []string{dir},
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,395 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+// MigrateLocation is a prefix of a bucket on a backend, written as type://bucket/prefix
+type MigrateLocation struct {
+	ClientType S3ClientType
+	Endpoint   string
+	Bucket     string
+	Prefix     string
+}
+
+// ParseLocation parses "oss://bucket/prefix", the prefix may be empty
+func ParseLocation(s string) (MigrateLocation, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return MigrateLocation{}, fmt.Errorf("invalid location %q, expected type://bucket/prefix", s)
+	}
+	loc := MigrateLocation{ClientType: S3ClientType(scheme)}
+	if err := loc.ClientType.Validate(); err != nil {
+		return MigrateLocation{}, fmt.Errorf("invalid location %q: %w", s, err)
+	}
+	loc.Bucket, loc.Prefix, _ = strings.Cut(rest, "/")
+	if loc.Bucket == "" {
+		return MigrateLocation{}, fmt.Errorf("invalid location %q, bucket is empty", s)
+	}
+	return loc, nil
+}
+
+func (l MigrateLocation) String() string {
+	return fmt.Sprintf("%s://%s/%s", l.ClientType, l.Bucket, l.Prefix)
+}
+
+// migrateEntry is a migrated object in the checkpoint, keyed by source key
+type migrateEntry struct {
+	ETag      string `json:"etag"` // etag of the source when it was migrated
+	Size      int64  `json:"size"`
+	Checksum  string `json:"sha256"`    // sha256 of the plaintext, or of the stored bytes without a decrypt key
+	Plaintext bool   `json:"plaintext"` // whether Checksum is the one of the plaintext
+}
+
+// migrateCheckpoint records the objects already migrated, so an interrupted migration resumes
+type migrateCheckpoint struct {
+	From      string                   `json:"from"`
+	To        string                   `json:"to"`
+	UpdatedAt time.Time                `json:"updated_at"`
+	Objects   map[string]*migrateEntry `json:"objects"`
+}
+
+func defaultMigrateCheckpointPath(from, to MigrateLocation) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(from.Endpoint + "\n" + from.String() + "\n" + to.Endpoint + "\n" + to.String()))
+	return filepath.Join(home, ".soss", "migrate", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadMigrateCheckpoint(path string) (*migrateCheckpoint, error) {
+	cp := &migrateCheckpoint{Objects: make(map[string]*migrateEntry)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	if cp.Objects == nil {
+		cp.Objects = make(map[string]*migrateEntry)
+	}
+	return cp, nil
+}
+
+func saveMigrateCheckpoint(path string, cp *migrateCheckpoint) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename, a crash must not leave a truncated checkpoint
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// migrateKey maps a source key to its destination key
+func migrateKey(srcKey string, from, to MigrateLocation) string {
+	return path.Join(to.Prefix, strings.TrimPrefix(srcKey, listPrefix(from.Prefix)))
+}
+
+// migrateCheckpointInterval is the number of migrated objects between two checkpoint saves
+const migrateCheckpointInterval = 100
+
+type MigrateOptions struct {
+	From MigrateLocation
+	To   MigrateLocation
+
+	DecryptKey     string // needed to re-encrypt, re-compress and verify the plaintext
+	EncryptKey     string // if set and different from DecryptKey, the objects are re-encrypted with it
+	Recompress     bool   // if true, the content is decompressed and compressed again, requires WithCompression
+	CheckpointPath string // defaults to ~/.soss/migrate/<hash>.json
+	Jobs           int    // objects migrated in parallel, defaults to 2 * cpus
+	NoVerify       bool   // if true, skip the final comparison of the checksums
+	DryRun         bool   // if true, only return what would be migrated
+}
+
+// targetKey returns the key the destination objects are encrypted with
+func (o MigrateOptions) targetKey() string {
+	if o.EncryptKey != "" {
+		return o.EncryptKey
+	}
+	return o.DecryptKey
+}
+
+func (c *Controller) migrateSingleObject(
+	ctx context.Context, opts MigrateOptions, obj *internal.S3Object, srcClient, dstClient internal.IS3Client) (*migrateEntry, error) {
+	file, err := srcClient.Download(
+		ctx, &internal.S3Object{Endpoint: opts.From.Endpoint, Bucket: opts.From.Bucket, Key: obj.Key}, "")
+	if err != nil {
+		return nil, err
+	}
+	entry := &migrateEntry{ETag: obj.ETag, Size: obj.Size}
+
+	// without a key the stored bytes are copied as is
+	if opts.DecryptKey == "" {
+		entry.Checksum = utils.Sha256Hex(file.Content)
+	} else {
+		raw, rawMeta := file.Content, file.EncryptedMeta
+		if err := c.fileHandler.Decrypt(file, opts.DecryptKey); err != nil {
+			return nil, err
+		}
+		compressed := file.Content
+		if c.isCompress {
+			if err := c.fileHandler.Decompress(file); err != nil {
+				return nil, err
+			}
+		}
+		entry.Checksum = utils.Sha256Hex(file.Content)
+		entry.Plaintext = true
+
+		switch {
+		case opts.Recompress && c.isCompress:
+			if err := c.fileHandler.Compress(file); err != nil {
+				return nil, err
+			}
+			if err := c.fileHandler.Encrypt(file, opts.targetKey()); err != nil {
+				return nil, err
+			}
+		case opts.targetKey() != opts.DecryptKey:
+			file.Content = compressed
+			if err := c.fileHandler.Encrypt(file, opts.targetKey()); err != nil {
+				return nil, err
+			}
+		default:
+			file.Content, file.EncryptedMeta = raw, rawMeta
+		}
+	}
+
+	dstKey := migrateKey(obj.Key, opts.From, opts.To)
+	prefix := path.Dir(dstKey)
+	if prefix == "." {
+		prefix = ""
+	}
+	file.Path = path.Base(dstKey)
+	if _, err := dstClient.Upload(ctx, opts.To.Endpoint, opts.To.Bucket, prefix, file); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// verifyMigrated downloads a migrated object from the destination and compares its checksum
+func (c *Controller) verifyMigrated(
+	ctx context.Context, opts MigrateOptions, srcKey string, entry *migrateEntry, dstClient internal.IS3Client) error {
+	dstKey := migrateKey(srcKey, opts.From, opts.To)
+	file, err := dstClient.Download(
+		ctx, &internal.S3Object{Endpoint: opts.To.Endpoint, Bucket: opts.To.Bucket, Key: dstKey}, "")
+	if err != nil {
+		return err
+	}
+
+	if entry.Plaintext {
+		if err := c.fileHandler.Decrypt(file, opts.targetKey()); err != nil {
+			return err
+		}
+		if c.isCompress {
+			if err := c.fileHandler.Decompress(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	if sum := utils.Sha256Hex(file.Content); sum != entry.Checksum {
+		return fmt.Errorf("%s: checksum mismatch, expected %s, got %s", dstKey, entry.Checksum, sum)
+	}
+	return nil
+}
+
+// MigrateItem is an object migrated, or to be migrated, to its destination key
+type MigrateItem struct {
+	Src  string
+	Dst  string
+	Size int64
+}
+
+// Migrate copies every object below a prefix to another backend, bucket or prefix,
+// optionally re-encrypting or re-compressing them. Migrated objects are recorded in
+// a checkpoint so an interrupted migration resumes where it stopped, and the
+// checksums of the destination objects are compared with the source ones at the end.
+// It returns the objects migrated by this run, with DryRun the ones that would be.
+func (c *Controller) Migrate(ctx context.Context, opts MigrateOptions) ([]*MigrateItem, error) {
+	srcClient, err := c.getClient(opts.From.ClientType)
+	if err != nil {
+		return nil, err
+	}
+	dstClient, err := c.getClient(opts.To.ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.From.Endpoint == "" || opts.To.Endpoint == "" {
+		err := errors.New("endpoint cannot be empty")
+		c.logger.Error("migrate failed", "err", err.Error())
+		return nil, err
+	}
+	if (opts.Recompress || opts.EncryptKey != "") && opts.DecryptKey == "" {
+		err := errors.New("decrypt key is required to re-encrypt or re-compress")
+		c.logger.Error("migrate failed", "err", err.Error())
+		return nil, err
+	}
+	if opts.Recompress && !c.isCompress {
+		err := errors.New("re-compress requires compression, see WithCompression")
+		c.logger.Error("migrate failed", "err", err.Error())
+		return nil, err
+	}
+	if opts.From == opts.To {
+		err := errors.New("source and destination are the same")
+		c.logger.Error("migrate failed", "err", err.Error())
+		return nil, err
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = c.parallelism()
+	}
+
+	checkpointPath := opts.CheckpointPath
+	if checkpointPath == "" {
+		if checkpointPath, err = defaultMigrateCheckpointPath(opts.From, opts.To); err != nil {
+			c.logger.Error("migrate failed", "err", err.Error())
+			return nil, err
+		}
+	}
+	cp, err := loadMigrateCheckpoint(checkpointPath)
+	if err != nil {
+		c.logger.Error("migrate failed", "checkpoint", checkpointPath, "err", err.Error())
+		return nil, err
+	}
+	cp.From, cp.To = opts.From.String(), opts.To.String()
+
+	objs, err := srcClient.List(ctx, opts.From.Endpoint, opts.From.Bucket, listPrefix(opts.From.Prefix))
+	if err != nil {
+		c.logger.Error("migrate failed", "from", opts.From.String(), "err", err.Error())
+		return nil, err
+	}
+	objs = withoutTrash(objs)
+
+	// objects changed since they were migrated are migrated again
+	pending := make([]*internal.S3Object, 0, len(objs))
+	planned := make([]*MigrateItem, 0, len(objs))
+	var size int64
+	for _, obj := range objs {
+		if entry, ok := cp.Objects[obj.Key]; ok && entry.ETag == obj.ETag && entry.Size == obj.Size {
+			continue
+		}
+		pending = append(pending, obj)
+		planned = append(planned, &MigrateItem{Src: obj.Key, Dst: migrateKey(obj.Key, opts.From, opts.To), Size: obj.Size})
+		size += obj.Size
+	}
+	c.logger.Info("migrate plan",
+		"objects", len(objs), "pending", len(pending), "size(bytes)", size, "checkpoint", checkpointPath)
+	if opts.DryRun {
+		return planned, nil
+	}
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, opts.Jobs)
+
+	var mu sync.Mutex
+	failed, done := 0, 0
+	migrated := make([]*MigrateItem, 0, len(pending))
+	for i, obj := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(obj *internal.S3Object, item *MigrateItem) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+			entry, err := c.migrateSingleObject(ctx, opts, obj, srcClient, dstClient)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.logger.Error("migrate failed", "key", obj.Key, "err", err.Error())
+				failed++
+				return
+			}
+			c.logger.Info("migrated", "key", obj.Key)
+			migrated = append(migrated, item)
+			cp.Objects[obj.Key] = entry
+			if done++; done%migrateCheckpointInterval == 0 {
+				cp.UpdatedAt = time.Now()
+				if err := saveMigrateCheckpoint(checkpointPath, cp); err != nil {
+					c.logger.Warn("save checkpoint failed", "err", err.Error())
+				}
+			}
+		}(obj, planned[i])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return migrated, err
+	}
+
+	cp.UpdatedAt = time.Now()
+	if err := saveMigrateCheckpoint(checkpointPath, cp); err != nil {
+		c.logger.Error("save checkpoint failed", "checkpoint", checkpointPath, "err", err.Error())
+		return migrated, err
+	}
+	c.logger.Info("migrate finished", "migrated", done, "failed", failed)
+
+	if failed > 0 {
+		return migrated, fmt.Errorf("%d of %d objects failed to migrate", failed, len(pending))
+	}
+	if opts.NoVerify {
+		return migrated, nil
+	}
+
+	// compare every object of the source, including the ones migrated by a previous run
+	mismatched := 0
+	for _, obj := range objs {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(key string, entry *migrateEntry) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+			if err := c.verifyMigrated(ctx, opts, key, entry, dstClient); err != nil {
+				c.logger.Error("verify failed", "key", key, "err", err.Error())
+				mu.Lock()
+				mismatched++
+				mu.Unlock()
+			}
+		}(obj.Key, cp.Objects[obj.Key])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return migrated, err
+	}
+
+	c.logger.Info("verify finished", "total", len(objs), "failed", mismatched)
+	if mismatched > 0 {
+		return migrated, fmt.Errorf("%d of %d objects failed verification", mismatched, len(objs))
+	}
+	return migrated, nil
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/internal/filehandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMemCtrl(clients map[S3ClientType]internal.IS3Client) *Controller {
+	opts := []Option{
+		WithFileHandler(filehandler.NewFileHandler()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithCompression(),
+	}
+	for t, client := range clients {
+		opts = append(opts, WithS3Client(t, client))
+	}
+	return NewController(opts...)
+}
+
+// putEncrypted stores content the way the uploader does
+func putEncrypted(t *testing.T, c *Controller, client *memClient, endpoint, bucket, key, content, encryptKey string) {
+	file := &internal.File{Path: key, Content: []byte(content), Meta: &internal.FileMeta{Size: int64(len(content))}}
+	assert.NoError(t, c.fileHandler.Compress(file))
+	assert.NoError(t, c.fileHandler.Encrypt(file, encryptKey))
+	client.put(endpoint, bucket, key, file.Content, file.EncryptedMeta)
+}
+
+func TestParseLocation(t *testing.T) {
+	loc, err := ParseLocation("oss://bucket/data/2024")
+	assert.NoError(t, err)
+	assert.Equal(t, MigrateLocation{ClientType: S3ClientTypeOSS, Bucket: "bucket", Prefix: "data/2024"}, loc)
+
+	loc, err = ParseLocation("s3://bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, MigrateLocation{ClientType: S3ClientTypeS3, Bucket: "bucket"}, loc)
+
+	_, err = ParseLocation("bucket/data")
+	assert.Error(t, err)
+	_, err = ParseLocation("ftp://bucket/data")
+	assert.Error(t, err)
+	_, err = ParseLocation("oss:///data")
+	assert.Error(t, err)
+}
+
+func TestMigrateKey(t *testing.T) {
+	from := MigrateLocation{Prefix: "data"}
+	assert.Equal(t, "archive/a/b.txt", migrateKey("data/a/b.txt", from, MigrateLocation{Prefix: "archive"}))
+	assert.Equal(t, "a/b.txt", migrateKey("data/a/b.txt", from, MigrateLocation{}))
+	assert.Equal(t, "archive/data/a.txt", migrateKey("data/a.txt", MigrateLocation{}, MigrateLocation{Prefix: "archive/"}))
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newMemClient(), newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: src, S3ClientTypeS3: dst})
+
+	putEncrypted(t, c, src, "oss-ep", "a", "data/x.txt", "hello", "old")
+	putEncrypted(t, c, src, "oss-ep", "a", "data/sub/y.txt", "world", "old")
+	putEncrypted(t, c, src, "oss-ep", "a", "other/z.txt", "skipped", "old")
+
+	opts := MigrateOptions{
+		From:           MigrateLocation{ClientType: S3ClientTypeOSS, Endpoint: "oss-ep", Bucket: "a", Prefix: "data"},
+		To:             MigrateLocation{ClientType: S3ClientTypeS3, Endpoint: "s3-ep", Bucket: "b", Prefix: "moved"},
+		DecryptKey:     "old",
+		EncryptKey:     "new",
+		CheckpointPath: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}
+	migrated, err := c.Migrate(ctx, opts)
+	assert.NoError(t, err)
+	moves := make(map[string]string, len(migrated))
+	for _, item := range migrated {
+		moves[item.Src] = item.Dst
+	}
+	assert.Equal(t, map[string]string{"data/x.txt": "moved/x.txt", "data/sub/y.txt": "moved/sub/y.txt"}, moves)
+
+	objs, err := dst.List(ctx, "s3-ep", "b", "")
+	assert.NoError(t, err)
+	assert.Len(t, objs, 2)
+
+	// re-encrypted with the new key
+	file, err := dst.Download(ctx, &internal.S3Object{Endpoint: "s3-ep", Bucket: "b", Key: "moved/sub/y.txt"}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, c.fileHandler.Decrypt(file, "new"))
+	assert.NoError(t, c.fileHandler.Decompress(file))
+	assert.Equal(t, "world", string(file.Content))
+	assert.Equal(t, int64(5), file.Meta.Size)
+
+	// a second run resumes from the checkpoint and uploads nothing
+	version := dst.version
+	migrated, err = c.Migrate(ctx, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, migrated)
+	assert.Equal(t, version, dst.version)
+
+	// a damaged destination fails the verification
+	dst.objects[memKey("s3-ep", "b", "moved/x.txt")].content[0] ^= 0xff
+	_, err = c.Migrate(ctx, opts)
+	assert.Error(t, err)
+}
+
+func TestMigrate_RecompressWithoutCompression(t *testing.T) {
+	src, dst := newMemClient(), newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: src, S3ClientTypeS3: dst})
+	c.isCompress = false
+
+	_, err := c.Migrate(context.Background(), MigrateOptions{
+		From:       MigrateLocation{ClientType: S3ClientTypeOSS, Endpoint: "oss-ep", Bucket: "a"},
+		To:         MigrateLocation{ClientType: S3ClientTypeS3, Endpoint: "s3-ep", Bucket: "b"},
+		DecryptKey: "old",
+		Recompress: true,
+	})
+	assert.ErrorContains(t, err, "compression")
+}
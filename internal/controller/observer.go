@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// Observer is told about the steps of lists, uploads and downloads, e.g. to
+// push a metric per file or write an audit line. The files of sync and pull
+// are reported as uploads and downloads too, without a batch. Every callback
+// is optional. They are called from the transfer workers, so they must be
+// safe for concurrent use and should return quickly.
+type Observer struct {
+	// OnListStart is called before files or objects are looked up, location
+	// is the local directory of an upload or the key prefix of a download or list
+	OnListStart func(op, location string)
+	// OnFileStart is called before a file is transferred. The key of an upload
+	// and the size of a download are only known in OnFileDone.
+	OnFileStart func(op, path, key string, size int64)
+	// OnFileDone is called when the transfer of a file ends, result.Err is nil
+	// when it succeeded and result.Size is the size of the object
+	OnFileDone func(op string, result *TransferResult, elapsed time.Duration)
+	// OnRetry is called when a request of a file failed with err and is retried
+	OnRetry func(op, path, key string, attempt int, err error)
+	// OnError is called for every file that failed and for every path or
+	// prefix that could not be looked up
+	OnError func(op, path, key string, err error)
+	// OnBatchDone is called when an Upload or Download returns, err is the
+	// error it returns
+	OnBatchDone func(op string, report *TransferReport, err error)
+}
+
+// WithObserver calls the callbacks of o during lists, uploads and downloads
+func WithObserver(o *Observer) Option {
+	return func(c *Controller) {
+		c.observer = o
+	}
+}
+
+func (o *Observer) listStart(op, location string) {
+	if o != nil && o.OnListStart != nil {
+		o.OnListStart(op, location)
+	}
+}
+
+func (o *Observer) fail(op, path, key string, err error) {
+	if o != nil && o.OnError != nil {
+		o.OnError(op, path, key, err)
+	}
+}
+
+func (o *Observer) batchDone(op string, report *TransferReport, err error) {
+	if o != nil && o.OnBatchDone != nil {
+		o.OnBatchDone(op, report, err)
+	}
+}
+
+// observeFile calls OnFileStart and returns a copy of ctx whose retries are
+// reported to OnRetry, and a func to call with the result of the transfer
+func (c *Controller) observeFile(ctx context.Context, op, path, key string, size int64) (context.Context, func(result *TransferResult)) {
+	o := c.observer
+	if o == nil {
+		return ctx, func(*TransferResult) {}
+	}
+	start := time.Now()
+	if o.OnFileStart != nil {
+		o.OnFileStart(op, path, key, size)
+	}
+	if o.OnRetry != nil {
+		ctx = internal.WithRetryHook(ctx, func(_ string, attempt int, err error) {
+			o.OnRetry(op, path, key, attempt, err)
+		})
+	}
+	return ctx, func(result *TransferResult) {
+		if o.OnFileDone != nil {
+			o.OnFileDone(op, result, time.Since(start))
+		}
+		if result.Err != nil {
+			o.fail(op, result.Path, result.Key, result.Err)
+		}
+	}
+}
+
+// observeUpload observes the upload of the file at path, the func is called
+// with the uploaded object or the error
+func (c *Controller) observeUpload(ctx context.Context, prefix, path string) (context.Context, func(obj *internal.S3Object, err error)) {
+	if c.observer == nil {
+		return ctx, func(*internal.S3Object, error) {}
+	}
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	ctx, done := c.observeFile(ctx, "upload", path, "", size)
+	return ctx, func(obj *internal.S3Object, err error) {
+		result := &TransferResult{Path: path, Key: filepath.Join(prefix, filepath.Base(path)), Err: err}
+		if obj != nil {
+			result.Key, result.Size, result.ETag, result.LastModified = obj.Key, obj.Size, obj.ETag, obj.LastModified
+		}
+		done(result)
+	}
+}
+
+// observeDownload observes the download of key to path, the func is called
+// with the size of the downloaded object and the error
+func (c *Controller) observeDownload(ctx context.Context, key, path string) (context.Context, func(size int64, err error)) {
+	if c.observer == nil {
+		return ctx, func(int64, error) {}
+	}
+	ctx, done := c.observeFile(ctx, "download", path, key, 0)
+	return ctx, func(size int64, err error) {
+		done(&TransferResult{Path: path, Key: key, Size: size, Err: err})
+	}
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// observed records the callbacks of an observer
+type observed struct {
+	mu      sync.Mutex
+	lists   []string
+	started []string
+	done    []*TransferResult
+	retries int
+	errs    []string
+	batches []string
+}
+
+func (r *observed) observer() *Observer {
+	return &Observer{
+		OnListStart: func(op, location string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.lists = append(r.lists, op+":"+location)
+		},
+		OnFileStart: func(op, path, key string, size int64) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.started = append(r.started, path)
+		},
+		OnFileDone: func(op string, result *TransferResult, elapsed time.Duration) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.done = append(r.done, result)
+		},
+		OnRetry: func(op, path, key string, attempt int, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.retries++
+		},
+		OnError: func(op, path, key string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.errs = append(r.errs, key)
+		},
+		OnBatchDone: func(op string, report *TransferReport, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.batches = append(r.batches, op)
+		},
+	}
+}
+
+func TestUpload_Observer(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaaa"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bb"), 0644))
+
+	client := &retryingClient{newMemClient()}
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: client})
+	rec := &observed{}
+	WithObserver(rec.observer())(c)
+
+	_, err := c.Upload(ctx, UploadOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", EncryptKey: "k", Paths: []string{dir},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"upload:" + dir}, rec.lists)
+	assert.ElementsMatch(t, []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}, rec.started)
+	assert.Equal(t, 2, rec.retries)
+	assert.Empty(t, rec.errs)
+	assert.Equal(t, []string{"upload"}, rec.batches)
+
+	keys := make([]string, 0, len(rec.done))
+	for _, result := range rec.done {
+		assert.NoError(t, result.Err)
+		assert.Positive(t, result.Size)
+		keys = append(keys, result.Key)
+	}
+	assert.ElementsMatch(t, []string{"data/a.txt", "data/b.txt"}, keys)
+}
+
+func TestDownload_Observer(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	putEncrypted(t, c, mem, "ep", "bucket", "data/a.txt", "a", "k")
+	putEncrypted(t, c, mem, "ep", "bucket", "data/b.txt", "b", "wrong")
+	rec := &observed{}
+	WithObserver(rec.observer())(c)
+
+	_, err := c.Download(ctx, DownloadOptions{
+		S3ClientType: S3ClientTypeOSS,
+		Endpoint:     "ep",
+		Bucket:       "bucket",
+		OutputDir:    t.TempDir(),
+		DecryptKey:   "k",
+		S3keys:       []string{"data/", "missing/"},
+	})
+	assert.True(t, IsPartialFailure(err))
+
+	assert.ElementsMatch(t, []string{"download:data/", "download:missing/"}, rec.lists)
+	assert.Len(t, rec.started, 2)
+	assert.Len(t, rec.done, 2)
+	// the undecryptable file and the prefix that matched nothing
+	assert.ElementsMatch(t, []string{"data/b.txt", "missing/"}, rec.errs)
+	assert.Equal(t, []string{"download"}, rec.batches)
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/progress"
+)
+
+// WithProgress reports the progress of uploads and downloads to sink
+func WithProgress(sink progress.Sink) Option {
+	return func(c *Controller) {
+		c.progress = sink
+	}
+}
+
+func (c *Controller) emit(e progress.Event) {
+	if c.progress == nil {
+		return
+	}
+	e.Time = time.Now()
+	c.progress.Handle(e)
+}
+
+// runTransfers runs the tasks of a batch on a scheduler, between the batch
+// started and finished events
+func (c *Controller) runTransfers(ctx context.Context, op string, tasks []transferTask) {
+	var size int64
+	for _, task := range tasks {
+		size += task.size
+	}
+	c.emit(progress.Event{Kind: progress.BatchStarted, Op: op, Files: len(tasks), Size: size})
+	c.newScheduler().run(ctx, tasks)
+	c.emit(progress.Event{Kind: progress.BatchFinished, Op: op})
+}
+
+// startFile reports the start of a transfer and returns a copy of ctx whose
+// content streams and retries are reported as progress of the file
+func (c *Controller) startFile(ctx context.Context, op, path, key string, size int64) context.Context {
+	if c.progress == nil {
+		return ctx
+	}
+	file := progress.Event{Op: op, Path: path, Key: key}
+
+	started := file
+	started.Kind, started.Size = progress.FileStarted, size
+	c.emit(started)
+
+	sizes := &uploadSize{}
+	ctx = context.WithValue(ctx, uploadSizeKey{}, sizes)
+	ctx = internal.WithStreamWrapper(ctx, func(r io.Reader) io.Reader {
+		// the bytes read through r and the plain bytes reported for them
+		var sent, reported int64
+		return &countingReader{r: r, count: func(n int) {
+			sent += int64(n)
+			plain := sizes.plainBytes(sent)
+			if plain == reported {
+				return
+			}
+			e := file
+			e.Kind, e.Bytes = progress.Bytes, plain-reported
+			reported = plain
+			c.emit(e)
+		}}
+	})
+	return internal.WithRetryHook(ctx, func(_ string, attempt int, err error) {
+		e := file
+		e.Kind, e.Attempt, e.Err = progress.Retry, attempt, err
+		c.emit(e)
+	})
+}
+
+// uploadSize converts the bytes an upload sends to bytes of the plain file,
+// the content is compressed and encrypted and may be sent to several replicas
+type uploadSize struct {
+	plain, wire int64 // set before the content is sent, zero for downloads
+}
+
+type uploadSizeKey struct{}
+
+func (s *uploadSize) plainBytes(sent int64) int64 {
+	if s.wire <= 0 {
+		return sent
+	}
+	return sent * s.plain / s.wire
+}
+
+// setUploadSize tells the progress of the file of ctx that its plain bytes
+// are sent as wire bytes in total
+func setUploadSize(ctx context.Context, plain, wire int64) {
+	if s, ok := ctx.Value(uploadSizeKey{}).(*uploadSize); ok {
+		s.plain, s.wire = plain, wire
+	}
+}
+
+// wireSize returns the bytes sent to upload n bytes of content, once to every
+// replica or as the shards of the erasure set
+func (c *Controller) wireSize(n int64) int64 {
+	if set := c.erasure; set != nil {
+		return n * int64(set.DataShards+set.ParityShards) / int64(set.DataShards)
+	}
+	return n * int64(1+len(c.replicas))
+}
+
+// finishFile reports the end of a transfer started by startFile
+func (c *Controller) finishFile(op, path, key string, size int64, err error) {
+	c.emit(progress.Event{Kind: progress.FileFinished, Op: op, Path: path, Key: key, Size: size, Err: err})
+}
+
+// countingReader reports the bytes read through it
+type countingReader struct {
+	r     io.Reader
+	count func(n int)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.count(n)
+	}
+	return n, err
+}
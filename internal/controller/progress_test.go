@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/progress"
+	"github.com/stretchr/testify/assert"
+)
+
+// retryingClient reads uploads through the stream wrappers and reports a
+// retry before every upload, like the retry client after a transient failure
+type retryingClient struct {
+	*memClient
+}
+
+func (r *retryingClient) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (*internal.S3Object, error) {
+	internal.NotifyRetry(ctx, "upload", 1, errUnavailable)
+	if _, err := io.ReadAll(internal.WrapStream(ctx, bytes.NewReader(file.Content))); err != nil {
+		return nil, err
+	}
+	return r.memClient.Upload(ctx, endpoint, bucket, prefix, file)
+}
+
+// eventRecorder collects the events of the transfers
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []progress.Event
+}
+
+func (r *eventRecorder) Handle(e progress.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) count(kind progress.Kind) int {
+	n := 0
+	for _, e := range r.events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUpload_Progress(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaaa"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bb"), 0644))
+
+	client := &retryingClient{newMemClient()}
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: client})
+	recorder := &eventRecorder{}
+	WithProgress(recorder)(c)
+
+	_, err := c.Upload(ctx, UploadOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", EncryptKey: "k", Paths: []string{dir},
+	})
+	assert.NoError(t, err)
+
+	events := recorder.events
+	assert.Equal(t, progress.BatchStarted, events[0].Kind)
+	assert.Equal(t, 2, events[0].Files)
+	assert.Equal(t, int64(6), events[0].Size)
+	assert.Equal(t, progress.BatchFinished, events[len(events)-1].Kind)
+
+	assert.Equal(t, 2, recorder.count(progress.FileStarted))
+	assert.Equal(t, 2, recorder.count(progress.Retry))
+	assert.Equal(t, 2, recorder.count(progress.FileFinished))
+
+	var sent int64
+	keys := make([]string, 0, 2)
+	for _, e := range events {
+		switch e.Kind {
+		case progress.Bytes:
+			sent += e.Bytes
+		case progress.FileFinished:
+			assert.NoError(t, e.Err)
+			keys = append(keys, e.Key)
+		}
+	}
+	// the plain bytes, not the compressed and encrypted ones
+	assert.Equal(t, int64(6), sent)
+	assert.ElementsMatch(t, []string{"data/a.txt", "data/b.txt"}, keys)
+}
+
+func TestDownload_Progress(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	putEncrypted(t, c, mem, "ep", "bucket", "data/a.txt", "a", "k")
+	recorder := &eventRecorder{}
+	WithProgress(recorder)(c)
+
+	outputDir := t.TempDir()
+	_, err := c.Download(ctx, DownloadOptions{
+		S3ClientType: S3ClientTypeOSS,
+		Endpoint:     "ep",
+		Bucket:       "bucket",
+		OutputDir:    outputDir,
+		DecryptKey:   "k",
+		S3keys:       []string{"data/a.txt", "data/missing.txt"},
+	})
+	assert.True(t, IsPartialFailure(err))
+
+	// the missing key never became a transfer
+	assert.Equal(t, 1, recorder.events[0].Files)
+	assert.Equal(t, 1, recorder.count(progress.FileStarted))
+	for _, e := range recorder.events {
+		if e.Kind == progress.FileFinished {
+			assert.NoError(t, e.Err)
+			assert.Equal(t, filepath.Join(outputDir, "data/a.txt"), e.Path)
+			assert.Equal(t, "data/a.txt", e.Key)
+		}
+	}
+}
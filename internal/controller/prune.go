@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// RetentionPolicy keeps the newest backup of each of the last N days, weeks and months
+type RetentionPolicy struct {
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+func (p RetentionPolicy) Validate() error {
+	if p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 {
+		return errors.New("keep values must not be negative")
+	}
+	if p.KeepDaily+p.KeepWeekly+p.KeepMonthly == 0 {
+		return errors.New("at least one of keep daily, weekly or monthly is required")
+	}
+	return nil
+}
+
+// BackupSet is a group of objects pruned together, e.g. one dated backup or one snapshot
+type BackupSet struct {
+	Name    string
+	Time    time.Time
+	Keys    []string
+	Size    int64
+	Keep    bool
+	Reasons []string // daily, weekly, monthly
+}
+
+// PrunePlan is the sets the retention policy keeps or removes, newest first,
+// and the snapshot chunks that are no longer used
+type PrunePlan struct {
+	Sets   []*BackupSet
+	Chunks []string
+}
+
+// Apply marks the sets to keep, sets must be ordered newest first
+func (p RetentionPolicy) Apply(sets []*BackupSet) {
+	rules := []struct {
+		name   string
+		keep   int
+		bucket func(t time.Time) string
+	}{
+		{"daily", p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{"monthly", p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for _, rule := range rules {
+		left, last := rule.keep, ""
+		for _, set := range sets {
+			if left == 0 {
+				break
+			}
+			// the first, i.e. newest, set of each day / week / month is kept
+			if b := rule.bucket(set.Time); b != last {
+				last = b
+				left--
+				set.Keep = true
+				set.Reasons = append(set.Reasons, rule.name)
+			}
+		}
+	}
+}
+
+// setTimeLayouts are the date formats recognized in the name of a backup set
+var setTimeLayouts = []string{
+	"20060102T150405Z",
+	"2006-01-02_15-04-05",
+	"2006-01-02T15-04-05",
+	"2006-01-02",
+	"20060102",
+}
+
+// parseSetTime parses the leading date of a backup set name, e.g. 2024-03-01 or 20240301T120000Z-1a2b3c4d
+func parseSetTime(name string) (time.Time, bool) {
+	for _, layout := range setTimeLayouts {
+		if len(name) < len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, name[:len(layout)], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// groupObjects groups the objects by the first path element below prefix,
+// dated by their name, or by their newest object when the name holds no date
+func groupObjects(prefix string, objs []*internal.S3Object) []*BackupSet {
+	groups := make(map[string]*BackupSet)
+	for _, obj := range objs {
+		rel := strings.TrimPrefix(obj.Key, listPrefix(prefix))
+		name, _, _ := strings.Cut(rel, "/")
+		set, ok := groups[name]
+		if !ok {
+			set = &BackupSet{Name: name}
+			groups[name] = set
+		}
+		set.Keys = append(set.Keys, obj.Key)
+		set.Size += obj.Size
+		if obj.LastModified.After(set.Time) {
+			set.Time = obj.LastModified
+		}
+	}
+
+	sets := make([]*BackupSet, 0, len(groups))
+	for _, set := range groups {
+		if t, ok := parseSetTime(set.Name); ok {
+			set.Time = t
+		}
+		sets = append(sets, set)
+	}
+	sortSetsNewestFirst(sets)
+	return sets
+}
+
+func sortSetsNewestFirst(sets []*BackupSet) {
+	sort.Slice(sets, func(i, j int) bool {
+		if !sets[i].Time.Equal(sets[j].Time) {
+			return sets[i].Time.After(sets[j].Time)
+		}
+		return sets[i].Name > sets[j].Name
+	})
+}
+
+// unreferencedChunks returns the keys of the chunks no remaining snapshot refers to
+func (c *Controller) unreferencedChunks(
+	ctx context.Context, endpoint, bucket, prefix, decryptKey string, remaining []string, client internal.IS3Client) ([]string, error) {
+	referenced := make(map[string]struct{})
+	for _, id := range remaining {
+		s, err := c.loadSnapshot(ctx, endpoint, bucket, prefix, id, decryptKey, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range s.Files {
+			for _, chunk := range sf.Chunks {
+				referenced[chunk] = struct{}{}
+			}
+		}
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(path.Join(prefix, backupChunksDir)))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	for _, obj := range objs {
+		if _, ok := referenced[path.Base(obj.Key)]; !ok {
+			keys = append(keys, obj.Key)
+		}
+	}
+	return keys, nil
+}
+
+type PruneOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	Policy       RetentionPolicy
+	Snapshots    bool   // if true, prune the snapshots of the backup repository under Prefix
+	DecryptKey   string // required with Snapshots, to find the chunks still in use
+	DryRun       bool   // if true, only return the plan
+}
+
+// Prune deletes the backups under the prefix that the retention policy does not keep.
+// Each first level directory below the prefix is one backup, or each snapshot with Snapshots,
+// in which case the chunks no longer used by any snapshot are deleted as well.
+// It returns the plan, carried out unless DryRun is set.
+func (c *Controller) Prune(ctx context.Context, opts PruneOptions) (*PrunePlan, error) {
+	if err := c.requireBucket("prune"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := opts.Policy.Validate(); err != nil {
+		c.logger.Error("prune failed", "err", err.Error())
+		return nil, err
+	}
+	if opts.Snapshots && opts.DecryptKey == "" {
+		err := errors.New("decrypt key is required to prune snapshots")
+		c.logger.Error("prune failed", "err", err.Error())
+		return nil, err
+	}
+
+	var sets []*BackupSet
+	if opts.Snapshots {
+		ids, err := c.listSnapshotIDs(ctx, endpoint, bucket, opts.Prefix, client)
+		if err != nil {
+			c.logger.Error("prune failed", "err", err.Error())
+			return nil, err
+		}
+		for _, id := range ids {
+			t, ok := parseSetTime(id)
+			if !ok {
+				c.logger.Warn("skip snapshot with unknown id format", "id", id)
+				continue
+			}
+			sets = append(sets, &BackupSet{Name: id, Time: t, Keys: []string{snapshotKey(opts.Prefix, id)}})
+		}
+		sortSetsNewestFirst(sets)
+	} else {
+		objs, err := client.List(ctx, endpoint, bucket, listPrefix(opts.Prefix))
+		if err != nil {
+			c.logger.Error("prune failed", "err", err.Error())
+			return nil, err
+		}
+		sets = groupObjects(opts.Prefix, withoutTrash(objs))
+	}
+
+	opts.Policy.Apply(sets)
+
+	plan := &PrunePlan{Sets: sets}
+	toDelete := make([]string, 0)
+	remaining := make([]string, 0)
+	for _, set := range sets {
+		if set.Keep {
+			remaining = append(remaining, set.Name)
+			continue
+		}
+		toDelete = append(toDelete, set.Keys...)
+	}
+
+	if opts.Snapshots && len(toDelete) > 0 {
+		chunks, err := c.unreferencedChunks(ctx, endpoint, bucket, opts.Prefix, opts.DecryptKey, remaining, client)
+		if err != nil {
+			c.logger.Error("prune failed", "err", err.Error())
+			return nil, err
+		}
+		plan.Chunks = chunks
+	}
+
+	if opts.DryRun || len(toDelete) == 0 {
+		c.logger.Info("prune plan", "keep", len(remaining), "remove", len(sets)-len(remaining), "objects", len(toDelete)+len(plan.Chunks))
+		return plan, nil
+	}
+
+	// chunks are deleted only once the snapshots are gone, an interrupted prune
+	// never leaves a snapshot with missing chunks. Both go to the same trash batch.
+	batch := newTrashBatch()
+	deleted, err := c.deleteObjectsTo(ctx, endpoint, bucket, batch, toDelete, c.trash, client)
+	if err == nil && len(plan.Chunks) > 0 {
+		var chunks []string
+		chunks, err = c.deleteObjectsTo(ctx, endpoint, bucket, batch, plan.Chunks, c.trash, client)
+		deleted = append(deleted, chunks...)
+	}
+	c.logger.Info("pruned", "keep", len(remaining), "remove", len(sets)-len(remaining), "deleted objects", len(deleted))
+	if err != nil {
+		c.logger.Error("prune failed", "err", err.Error())
+		return plan, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicy_Apply(t *testing.T) {
+	// one backup a day over 60 days, newest first
+	start := time.Date(2024, 3, 31, 2, 0, 0, 0, time.Local)
+	sets := make([]*BackupSet, 0)
+	for i := 0; i < 60; i++ {
+		sets = append(sets, &BackupSet{Name: start.AddDate(0, 0, -i).Format("2006-01-02"), Time: start.AddDate(0, 0, -i)})
+	}
+
+	RetentionPolicy{KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 3}.Apply(sets)
+
+	kept := make([]string, 0)
+	for _, set := range sets {
+		if set.Keep {
+			kept = append(kept, set.Name)
+		}
+	}
+	assert.Equal(t, []string{
+		"2024-03-31", "2024-03-30", "2024-03-29", "2024-03-28", "2024-03-27", "2024-03-26", "2024-03-25", // daily
+		"2024-03-24", "2024-03-17", "2024-03-10", // weekly, sundays end an iso week
+		"2024-02-29", // monthly, the backups only go back to february
+	}, kept)
+	assert.Equal(t, []string{"daily", "weekly", "monthly"}, sets[0].Reasons)
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	assert.Error(t, RetentionPolicy{}.Validate())
+	assert.Error(t, RetentionPolicy{KeepDaily: -1, KeepWeekly: 2}.Validate())
+	assert.NoError(t, RetentionPolicy{KeepMonthly: 1}.Validate())
+}
+
+func TestParseSetTime(t *testing.T) {
+	tm, ok := parseSetTime("20240301T120000Z-1a2b3c4d")
+	assert.True(t, ok)
+	assert.Equal(t, 2024, tm.Year())
+
+	tm, ok = parseSetTime("2024-03-01")
+	assert.True(t, ok)
+	assert.Equal(t, time.March, tm.Month())
+
+	_, ok = parseSetTime("latest")
+	assert.False(t, ok)
+}
+
+func TestGroupObjects(t *testing.T) {
+	modified := time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)
+	objs := []*internal.S3Object{
+		{Key: "backups/2024-03-01/a.txt", Size: 1},
+		{Key: "backups/2024-03-01/b/c.txt", Size: 2},
+		{Key: "backups/2024-03-02/a.txt", Size: 3},
+		{Key: "backups/misc/a.txt", Size: 4, LastModified: modified},
+	}
+
+	sets := groupObjects("backups", objs)
+	assert.Len(t, sets, 3)
+	assert.Equal(t, "misc", sets[0].Name)
+	assert.True(t, sets[0].Time.Equal(modified))
+	assert.Equal(t, "2024-03-02", sets[1].Name)
+	assert.Equal(t, "2024-03-01", sets[2].Name)
+	assert.Equal(t, int64(3), sets[2].Size)
+	assert.Len(t, sets[2].Keys, 2)
+}
+
+// failingSnapshotCopyClient can't copy snapshots, so they can't be moved to the trash
+type failingSnapshotCopyClient struct {
+	*memClient
+}
+
+func (f failingSnapshotCopyClient) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if strings.Contains(srcKey, "/"+backupSnapshotsDir+"/") {
+		return errors.New("access denied")
+	}
+	return f.memClient.Copy(ctx, endpoint, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+func TestPrune_SnapshotsToTrash(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem, S3ClientTypeS3: failingSnapshotCopyClient{mem}})
+	c.trash = true
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("first version"), 0644))
+	backup := BackupOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "repo", EncryptKey: "k", Paths: []string{dir}}
+	first, err := c.Backup(ctx, backup)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("second version"), 0644))
+	_, err = c.Backup(ctx, backup)
+	assert.NoError(t, err)
+
+	chunks := func() []string {
+		objs, err := mem.List(ctx, "ep", "bucket", path.Join("repo", backupChunksDir)+"/")
+		assert.NoError(t, err)
+		return keysOf(objs)
+	}
+	assert.Len(t, chunks(), 2)
+
+	// the first snapshot can't be moved, its chunk must stay
+	prune := PruneOptions{
+		S3ClientType: S3ClientTypeS3, Endpoint: "ep", Bucket: "bucket", Prefix: "repo",
+		Policy: RetentionPolicy{KeepDaily: 1}, Snapshots: true, DecryptKey: "k",
+	}
+	plan, err := c.Prune(ctx, prune)
+	assert.Error(t, err)
+	assert.Len(t, plan.Chunks, 1)
+	assert.Len(t, chunks(), 2)
+
+	// the snapshot and its chunk go to the same trash batch
+	prune.S3ClientType = S3ClientTypeOSS
+	_, err = c.Prune(ctx, prune)
+	assert.NoError(t, err)
+	assert.Len(t, chunks(), 1)
+	batches, err := c.TrashList(ctx, TrashOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket"})
+	assert.NoError(t, err)
+	if assert.Len(t, batches, 1) {
+		assert.ElementsMatch(t, []string{
+			path.Join(trashDir, batches[0].Name, snapshotKey("repo", first.ID)),
+			path.Join(trashDir, batches[0].Name, plan.Chunks[0]),
+		}, keysOf(batches[0].Objs))
+	}
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+const (
+	SyncActionDownload SyncAction = "download"
+	SyncActionRemove   SyncAction = "remove" // remove the local file
+)
+
+// ConflictPolicy decides what to do when a local file differs from the object
+type ConflictPolicy string
+
+const (
+	ConflictPolicySkip      ConflictPolicy = "skip"       // keep the local file
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"  // replace the local file
+	ConflictPolicyKeepBoth  ConflictPolicy = "keep-both"  // rename the local file, then download
+	ConflictPolicyNewerWins ConflictPolicy = "newer-wins" // keep whichever has the latest mtime
+)
+
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyKeepBoth, ConflictPolicyNewerWins:
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict policy %q", p)
+	}
+}
+
+// conflictPath returns the path one version of a conflicting file is saved to,
+// e.g. app.conf -> app.local-20240301-120000.conf
+func conflictPath(path, label string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + label + "-" + t.Format("20060102-150405") + ext
+}
+
+// localConflictPattern matches the local copies kept by ConflictPolicyKeepBoth
+var localConflictPattern = regexp.MustCompile(`\.local-\d{8}-\d{6}(\.[^.]*)?$`)
+
+// isLocalConflict reports whether path is a local copy kept by ConflictPolicyKeepBoth, see conflictPath
+func isLocalConflict(path string) bool {
+	return localConflictPattern.MatchString(filepath.Base(path))
+}
+
+// localPath returns where the object is saved under dir, relative to the prefix
+func localPath(dir, prefix, s3key string) (string, error) {
+	rel := strings.TrimPrefix(s3key, listPrefix(prefix))
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+
+	dir = filepath.Clean(dir)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %s escapes %s", s3key, dir)
+	}
+	return path, nil
+}
+
+func (c *Controller) pullPlan(
+	ctx context.Context, endpoint, bucket, prefix, dir, decryptKey string, policy ConflictPolicy, deleteLocal bool, client internal.IS3Client) ([]*SyncItem, error) {
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	objs = withoutTrash(objs)
+
+	items := make([]*SyncItem, 0, len(objs))
+	remote := make(map[string]struct{}, len(objs))
+	for _, obj := range objs {
+		// skip directory placeholders
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		path, err := localPath(dir, prefix, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+		remote[path] = struct{}{}
+		items = append(items, &SyncItem{Key: obj.Key, Path: path, Size: obj.Size})
+	}
+
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, c.parallelism())
+
+	for i, item := range items {
+		info, err := os.Stat(item.Path)
+		if os.IsNotExist(err) {
+			item.Action, item.Reason = SyncActionDownload, "new"
+			continue
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(i int, item *SyncItem, info os.FileInfo) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+
+			changed, meta, err := c.remoteChanged(ctx, endpoint, bucket, decryptKey, item.Path, item.Key, client)
+			if err != nil {
+				errs[i] = fmt.Errorf("compare %s: %w", item.Path, err)
+				return
+			}
+			if !changed {
+				item.Action, item.Reason = SyncActionSkip, "unchanged"
+				return
+			}
+
+			switch policy {
+			case ConflictPolicySkip:
+				item.Action, item.Reason = SyncActionSkip, "changed, keep local"
+			case ConflictPolicyOverwrite:
+				item.Action, item.Reason = SyncActionDownload, "changed"
+			case ConflictPolicyKeepBoth:
+				item.Action, item.Reason = SyncActionDownload, "changed, keep both"
+			case ConflictPolicyNewerWins:
+				// objects without metadata have no mtime, the remote one wins
+				if meta != nil && !meta.ModTime.After(info.ModTime()) {
+					item.Action, item.Reason = SyncActionSkip, "changed, local newer"
+				} else {
+					item.Action, item.Reason = SyncActionDownload, "changed, remote newer"
+				}
+			}
+		}(i, item, info)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// local files without an object, the copies kept by keep-both never had one
+	if deleteLocal && utils.IsDir(dir) {
+		files, err := c.fileHandler.SearchFiles(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if _, ok := remote[filepath.Clean(file)]; !ok && !isLocalConflict(file) {
+				items = append(items, &SyncItem{Action: SyncActionRemove, Reason: "deleted remotely", Path: file})
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return items, nil
+}
+
+type PullOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	DecryptKey   string
+	Dir          string         // local directory mirroring the prefix
+	Conflict     ConflictPolicy // what to do with local files that differ from the object
+	Delete       bool           // if true, local files without an object are deleted, except the copies kept by keep-both
+	DryRun       bool           // if true, only return the plan
+	NoOwner      bool           // if true, uid / gid are not restored
+	NoXattrs     bool           // if true, extended attributes are not restored
+}
+
+// Pull mirrors the objects under the prefix to a local directory,
+// only objects that differ from the local file are downloaded.
+// It returns the plan, carried out unless DryRun is set.
+func (c *Controller) Pull(ctx context.Context, opts PullOptions) ([]*SyncItem, error) {
+	if err := c.requireBucket("pull"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictPolicyOverwrite
+	}
+	if err := opts.Conflict.Validate(); err != nil {
+		c.logger.Error("pull failed", "err", err.Error())
+		return nil, err
+	}
+
+	items, err := c.pullPlan(ctx, endpoint, bucket, opts.Prefix, opts.Dir, opts.DecryptKey, opts.Conflict, opts.Delete, client)
+	if err != nil {
+		c.logger.Error("pull failed", "prefix", opts.Prefix, "err", err.Error())
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return items, nil
+	}
+
+	metaOpts := internal.MetaOptions{Owner: !opts.NoOwner, Xattrs: !opts.NoXattrs}
+	now := time.Now()
+
+	report := newTransferReport("pull", c.retries)
+	tasks := make([]transferTask, 0)
+	for _, item := range items {
+		switch item.Action {
+		case SyncActionRemove:
+			// local deletes are not transfers, they run right away
+			report.plan(1)
+			if ctx.Err() != nil {
+				continue
+			}
+			err := os.Remove(item.Path)
+			report.add(&TransferResult{Path: item.Path, Err: err})
+			if err != nil {
+				c.logger.Error("delete failed", "path", item.Path, "err", err.Error())
+				continue
+			}
+			c.logger.Info("deleted", "path", item.Path)
+		case SyncActionDownload:
+			tasks = append(tasks, transferTask{size: item.Size, run: func() {
+				err := func() error {
+					if opts.Conflict == ConflictPolicyKeepBoth && utils.IsFile(item.Path) {
+						backup := conflictPath(item.Path, "local", now)
+						if err := os.Rename(item.Path, backup); err != nil {
+							return err
+						}
+						c.logger.Warn("conflict, local file kept", "path", item.Path, "renamedTo", backup)
+					}
+					return c.downloadSingleFileTo(
+						ctx, endpoint, bucket, item.Key, item.Path, opts.DecryptKey, metaOpts, client)
+				}()
+				if err != nil {
+					c.logger.Error("pull failed", "key", item.Key, "err", err.Error())
+				}
+				report.add(&TransferResult{Path: item.Path, Key: item.Key, Size: item.Size, Err: err})
+			}})
+		}
+	}
+	report.plan(len(tasks))
+	c.newScheduler().run(ctx, tasks)
+
+	return items, report.finish(ctx, c.logger)
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalPath(t *testing.T) {
+	p, err := localPath("/etc/app", "config", "config/nginx/app.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/app/nginx/app.conf", p)
+
+	p, err = localPath("/etc/app", "", "app.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/app/app.conf", p)
+
+	_, err = localPath("/etc/app", "config", "config/../../passwd")
+	assert.Error(t, err)
+}
+
+func TestConflictPath(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "/etc/app/app.local-20240301-120000.conf", conflictPath("/etc/app/app.conf", "local", ts))
+	assert.Equal(t, "/etc/app/Makefile.local-20240301-120000", conflictPath("/etc/app/Makefile", "local", ts))
+}
+
+// pullFixture stores new.txt, same.txt and conf.txt under data/ and a local
+// directory with the same same.txt, an older, different conf.txt and stale.txt
+func pullFixture(t *testing.T) (*Controller, string) {
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	uploadFiles(t, c, S3ClientTypeOSS, "ep", "bucket", "data", "k", map[string]string{
+		"new.txt": "new", "same.txt": "same", "conf.txt": "remote",
+	})
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"same.txt": "same", "conf.txt": "local!", "stale.txt": "stale"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	// older than the object, its mtime may otherwise equal the uploaded one
+	mtime := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "conf.txt"), mtime, mtime))
+	return c, dir
+}
+
+func pullActions(items []*SyncItem) map[string]string {
+	actions := make(map[string]string, len(items))
+	for _, item := range items {
+		actions[filepath.Base(item.Path)] = string(item.Action) + " " + item.Reason
+	}
+	return actions
+}
+
+func readLocal(t *testing.T, dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func localConflicts(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "conf.local-*.txt"))
+	assert.NoError(t, err)
+	return matches
+}
+
+func TestPull(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		newer    bool   // if true, the local conf.txt is newer than the object
+		conf     string // content of conf.txt after the pull
+		reason   string // plan of conf.txt
+		keepBoth bool   // if true, the local conf.txt is kept as a conflict copy
+	}{
+		{name: "remote wins", policy: ConflictPolicyOverwrite, conf: "remote", reason: "download changed"},
+		{name: "local wins", policy: ConflictPolicySkip, conf: "local!", reason: "skip changed, keep local"},
+		{name: "keep both", policy: ConflictPolicyKeepBoth, conf: "remote", reason: "download changed, keep both", keepBoth: true},
+		{name: "newer wins, remote", policy: ConflictPolicyNewerWins, conf: "remote", reason: "download changed, remote newer"},
+		{name: "newer wins, local", policy: ConflictPolicyNewerWins, newer: true, conf: "local!", reason: "skip changed, local newer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dir := pullFixture(t)
+			if tt.newer {
+				mtime := time.Now().Add(time.Hour)
+				assert.NoError(t, os.Chtimes(filepath.Join(dir, "conf.txt"), mtime, mtime))
+			}
+
+			items, err := c.Pull(context.Background(), PullOptions{
+				S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", DecryptKey: "k",
+				Dir: dir, Conflict: tt.policy,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{
+				"new.txt":  "download new",
+				"same.txt": "skip unchanged",
+				"conf.txt": tt.reason,
+			}, pullActions(items))
+
+			assert.Equal(t, "new", readLocal(t, dir, "new.txt"))
+			assert.Equal(t, "same", readLocal(t, dir, "same.txt"))
+			assert.Equal(t, tt.conf, readLocal(t, dir, "conf.txt"))
+			// without Delete the local only file is left alone
+			assert.Equal(t, "stale", readLocal(t, dir, "stale.txt"))
+
+			conflicts := localConflicts(t, dir)
+			if tt.keepBoth {
+				if assert.Len(t, conflicts, 1) {
+					assert.Equal(t, "local!", readLocal(t, dir, filepath.Base(conflicts[0])))
+				}
+			} else {
+				assert.Empty(t, conflicts)
+			}
+		})
+	}
+}
+
+func TestPull_Delete(t *testing.T) {
+	c, dir := pullFixture(t)
+	opts := PullOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", DecryptKey: "k",
+		Dir: dir, Conflict: ConflictPolicyKeepBoth, Delete: true,
+	}
+
+	items, err := c.Pull(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "remove deleted remotely", pullActions(items)["stale.txt"])
+	assert.NoFileExists(t, filepath.Join(dir, "stale.txt"))
+	conflicts := localConflicts(t, dir)
+	assert.Len(t, conflicts, 1)
+
+	// the copy kept by keep-both has no object, the next pull must not delete it
+	items, err = c.Pull(context.Background(), opts)
+	assert.NoError(t, err)
+	for _, item := range items {
+		assert.Equal(t, SyncActionSkip, item.Action, item.Path)
+	}
+	assert.Equal(t, conflicts, localConflicts(t, dir))
+}
+
+func TestIsLocalConflict(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, isLocalConflict(conflictPath("/etc/app/app.conf", "local", ts)))
+	assert.True(t, isLocalConflict(conflictPath("/etc/app/Makefile", "local", ts)))
+	assert.False(t, isLocalConflict("/etc/app/app.conf"))
+	assert.False(t, isLocalConflict("/etc/app/app.local.conf"))
+}
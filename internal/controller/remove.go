@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+type RemoveOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	S3keys       []string      // keys, or prefixes with Recursive
+	Recursive    bool          // if true, everything below each key is removed
+	OlderThan    time.Duration // if > 0, only objects last modified before now - OlderThan are removed
+	DryRun       bool          // if true, only return what would be removed
+	Trash        bool          // if true, objects are moved to the trash, see WithTrash
+
+	// Confirm is asked before deleting anything, the deletion is aborted when it returns false
+	Confirm func(count int, size int64) bool
+}
+
+// matchObjects returns the objects to remove for one key
+func (c *Controller) matchObjects(
+	ctx context.Context, endpoint, bucket, s3key string, recursive bool, client internal.IS3Client) ([]*internal.S3Object, error) {
+	if !recursive {
+		obj, err := client.Stat(ctx, &internal.S3Object{Endpoint: endpoint, Bucket: bucket, Key: s3key})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w, use --recursive for a prefix", s3key, err)
+		}
+		return []*internal.S3Object{obj}, nil
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, s3key)
+	if err != nil {
+		return nil, err
+	}
+	// the trash is only removed when asked for explicitly
+	if !isTrashKey(s3key) {
+		objs = withoutTrash(objs)
+	}
+
+	// "data" removes data and data/*, not data2/*
+	matched := make([]*internal.S3Object, 0, len(objs))
+	for _, obj := range objs {
+		if obj.Key == s3key || strings.HasPrefix(obj.Key, listPrefix(s3key)) {
+			matched = append(matched, obj)
+		}
+	}
+	return matched, nil
+}
+
+// Remove deletes objects, or every object below a prefix with Recursive, and
+// returns the objects deleted, with DryRun the ones that would be deleted.
+func (c *Controller) Remove(ctx context.Context, opts RemoveOptions) ([]*internal.S3Object, error) {
+	if err := c.requireBucket("remove"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.S3keys) == 0 {
+		err := errors.New("no files to remove")
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+	for _, s3key := range opts.S3keys {
+		// an empty prefix matches every object of the bucket
+		if opts.Recursive && listPrefix(s3key) == "" {
+			err := errors.New("refusing to remove the whole bucket, give a prefix")
+			c.logger.Error("remove failed", "err", err.Error())
+			return nil, err
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	seen := make(map[string]struct{})
+	matched := make([]*internal.S3Object, 0)
+	keys := make([]string, 0)
+	var size int64
+	for _, s3key := range opts.S3keys {
+		objs, err := c.matchObjects(ctx, endpoint, bucket, s3key, opts.Recursive, client)
+		if err != nil {
+			c.logger.Error("remove failed", "err", err.Error())
+			return nil, err
+		}
+		for _, obj := range objs {
+			if opts.OlderThan > 0 && !obj.LastModified.Before(cutoff) {
+				continue
+			}
+			if _, ok := seen[obj.Key]; ok {
+				continue
+			}
+			seen[obj.Key] = struct{}{}
+			matched = append(matched, obj)
+			keys = append(keys, obj.Key)
+			size += obj.Size
+		}
+	}
+
+	if len(keys) == 0 {
+		c.logger.Info("nothing to remove")
+		return matched, nil
+	}
+	if opts.DryRun {
+		c.logger.Info("remove plan", "objects", len(keys), "size(bytes)", size)
+		return matched, nil
+	}
+	if opts.Confirm != nil && !opts.Confirm(len(keys), size) {
+		err := errors.New("aborted")
+		c.logger.Error("remove failed", "err", err.Error())
+		return nil, err
+	}
+
+	deleted, err := c.deleteObjects(ctx, endpoint, bucket, keys, c.trash || opts.Trash, client)
+	for _, key := range deleted {
+		c.logger.Info("removed", "key", bucket+":"+key)
+	}
+	matched = pickObjects(matched, deleted)
+	if err != nil {
+		c.logger.Error("remove failed", "err", err.Error())
+		return matched, err
+	}
+	c.logger.Info("remove finished", "objects", len(deleted), "size(bytes)", size)
+	return matched, nil
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemove(t *testing.T) {
+	ctx := context.Background()
+	for _, trash := range []bool{false, true} {
+		mem := newMemClient()
+		c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+		for _, key := range []string{"data/a.txt", "data/sub/b.txt", "data2/c.txt", "d.txt"} {
+			mem.put("ep", "bucket", key, []byte(key), "")
+		}
+		opts := RemoveOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Trash: trash}
+
+		// an exact key, a prefix needs Recursive
+		opts.S3keys = []string{"d.txt"}
+		removed, err := c.Remove(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"d.txt"}, keysOf(removed))
+		opts.S3keys = []string{"data"}
+		_, err = c.Remove(ctx, opts)
+		assert.Error(t, err)
+
+		// "data" removes data/ but not data2/
+		opts.Recursive = true
+		removed, err = c.Remove(ctx, opts)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"data/a.txt", "data/sub/b.txt"}, keysOf(removed))
+
+		// never the whole bucket
+		opts.S3keys = []string{""}
+		_, err = c.Remove(ctx, opts)
+		assert.Error(t, err)
+
+		objs, err := mem.List(ctx, "ep", "bucket", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"data2/c.txt"}, keysOf(withoutTrash(objs)))
+		if !trash {
+			assert.Len(t, objs, 1)
+			continue
+		}
+		batches, err := c.TrashList(ctx, TrashOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket"})
+		assert.NoError(t, err)
+		trashed := 0
+		for _, b := range batches {
+			trashed += len(b.Objs)
+		}
+		assert.Equal(t, 3, trashed)
+	}
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+type ReplicaMode string
+
+const (
+	ReplicaModeQuorum ReplicaMode = "quorum" // an upload succeeds when most replicas are written
+	ReplicaModeAll    ReplicaMode = "all"    // an upload succeeds when every replica is written
+)
+
+func (m ReplicaMode) Validate() error {
+	switch m {
+	case ReplicaModeQuorum, ReplicaModeAll:
+		return nil
+	default:
+		return fmt.Errorf("invalid replica mode %q", m)
+	}
+}
+
+// satisfied reports whether written out of total replicas is enough for the mode
+func (m ReplicaMode) satisfied(written, total int) bool {
+	if m == ReplicaModeAll {
+		return written == total
+	}
+	return written*2 > total
+}
+
+// Replica is an extra destination every uploaded object is written to.
+// Each replica has its own client, clients keep per endpoint state
+type Replica struct {
+	ClientType S3ClientType
+	Endpoint   string
+	Bucket     string
+	Client     internal.IS3Client
+}
+
+func (r *Replica) String() string {
+	// the primary destination has no client type of its own
+	if r.ClientType == "" {
+		return fmt.Sprintf("primary://%s@%s", r.Bucket, r.Endpoint)
+	}
+	return fmt.Sprintf("%s://%s@%s", r.ClientType, r.Bucket, r.Endpoint)
+}
+
+// WithReplicas writes every uploaded object to the replicas as well, and lets
+// downloads fail over to them. The primary endpoint and bucket count as a replica.
+// Deletes of rm, mv, sync --delete and prune only reach the primary bucket,
+// the replicas keep the objects until they are removed there.
+func WithReplicas(mode ReplicaMode, replicas ...*Replica) Option {
+	return func(c *Controller) {
+		c.replicaMode = mode
+		c.replicas = replicas
+	}
+}
+
+// replicaStats counts the objects written to and failed on each replica
+type replicaStats struct {
+	mu      sync.Mutex
+	written map[string]int
+	failed  map[string]int
+}
+
+func newReplicaStats() *replicaStats {
+	return &replicaStats{written: make(map[string]int), failed: make(map[string]int)}
+}
+
+// replicaStatsKey is the context key of the stats of the running upload
+type replicaStatsKey struct{}
+
+// withReplicaStats returns a copy of ctx whose object writes are counted in stats
+func withReplicaStats(ctx context.Context, stats *replicaStats) context.Context {
+	return context.WithValue(ctx, replicaStatsKey{}, stats)
+}
+
+// replicaStatsFrom returns the stats of ctx, nil when writes are not counted
+func replicaStatsFrom(ctx context.Context) *replicaStats {
+	stats, _ := ctx.Value(replicaStatsKey{}).(*replicaStats)
+	return stats
+}
+
+// add counts a write to replica, nothing is counted on nil stats
+func (s *replicaStats) add(replica string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed[replica]++
+	} else {
+		s.written[replica]++
+	}
+}
+
+// replicaTargets returns the primary destination followed by the replicas
+func (c *Controller) replicaTargets(endpoint, bucket string, client internal.IS3Client) []*Replica {
+	targets := make([]*Replica, 0, len(c.replicas)+1)
+	targets = append(targets, &Replica{Endpoint: endpoint, Bucket: bucket, Client: client})
+	return append(targets, c.replicas...)
+}
+
+// putObject uploads the file to the primary destination and to every replica,
+// or as shards to the erasure set when there is one
+func (c *Controller) putObject(
+	ctx context.Context, endpoint, bucket, prefix string, file *internal.File, client internal.IS3Client) (*internal.S3Object, error) {
+	if c.erasure != nil {
+		return c.putShards(ctx, prefix, file)
+	}
+	if len(c.replicas) == 0 {
+		return client.Upload(ctx, endpoint, bucket, prefix, file)
+	}
+
+	targets := c.replicaTargets(endpoint, bucket, client)
+	objs := make([]*internal.S3Object, len(targets))
+	errs := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *Replica) {
+			defer wg.Done()
+			objs[i], errs[i] = target.Client.Upload(ctx, target.Endpoint, target.Bucket, prefix, file)
+		}(i, target)
+	}
+	wg.Wait()
+
+	stats := replicaStatsFrom(ctx)
+	written := 0
+	var obj *internal.S3Object
+	for i, target := range targets {
+		stats.add(target.String(), errs[i])
+		if errs[i] != nil {
+			c.logger.Error("replica upload failed", "replica", target.String(), "file", file.Path, "err", errs[i].Error())
+			continue
+		}
+		written++
+		if obj == nil {
+			obj = objs[i]
+		}
+	}
+
+	if !c.replicaMode.satisfied(written, len(targets)) {
+		return nil, fmt.Errorf("%d of %d replicas written, %s required: %w",
+			written, len(targets), c.replicaMode, errors.Join(errs...))
+	}
+	return obj, nil
+}
+
+// getObject downloads an object, falling over to the replicas when it can not be downloaded,
+// or rebuilds it from the erasure set when there is one
+func (c *Controller) getObject(ctx context.Context, obj *internal.S3Object, client internal.IS3Client) (*internal.File, error) {
+	if c.erasure != nil {
+		return c.getShards(ctx, obj.Key)
+	}
+	file, err := client.Download(ctx, obj, "")
+	if err == nil || len(c.replicas) == 0 {
+		return file, err
+	}
+
+	errs := []error{err}
+	for _, replica := range c.replicas {
+		c.logger.Warn("download failed, trying next replica",
+			"key", obj.Key, "replica", replica.String(), "err", errs[len(errs)-1].Error())
+		file, err := replica.Client.Download(
+			ctx, &internal.S3Object{Endpoint: replica.Endpoint, Bucket: replica.Bucket, Key: obj.Key}, "")
+		if err == nil {
+			return file, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// listObjects lists a prefix, falling over to the replicas or the erasure set targets
+// when it can not be listed
+func (c *Controller) listObjects(ctx context.Context, endpoint, bucket, prefix string, client internal.IS3Client) ([]*internal.S3Object, error) {
+	if c.erasure != nil {
+		return c.listShards(ctx, prefix)
+	}
+	objs, err := client.List(ctx, endpoint, bucket, prefix)
+	if err == nil || len(c.replicas) == 0 {
+		return objs, err
+	}
+
+	errs := []error{err}
+	for _, replica := range c.replicas {
+		c.logger.Warn("list failed, trying next replica",
+			"prefix", prefix, "replica", replica.String(), "err", errs[len(errs)-1].Error())
+		objs, err := replica.Client.List(ctx, replica.Endpoint, replica.Bucket, prefix)
+		if err == nil {
+			return objs, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// logReplicaStats reports how many objects were written to each replica
+func (c *Controller) logReplicaStats(stats *replicaStats) {
+	names := make([]string, 0, len(stats.written)+len(stats.failed))
+	seen := make(map[string]struct{})
+	for _, m := range []map[string]int{stats.written, stats.failed} {
+		for name := range m {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if stats.failed[name] > 0 {
+			c.logger.Warn("replica", "name", name, "written", stats.written[name], "failed", stats.failed[name])
+		} else {
+			c.logger.Info("replica", "name", name, "written", stats.written[name], "failed", 0)
+		}
+	}
+}
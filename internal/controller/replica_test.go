@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// downClient is a client whose backend is unavailable
+type downClient struct{ *memClient }
+
+var errUnavailable = errors.New("unavailable")
+
+func (d downClient) Upload(context.Context, string, string, string, *internal.File) (*internal.S3Object, error) {
+	return nil, errUnavailable
+}
+
+func (d downClient) Download(context.Context, *internal.S3Object, string) (*internal.File, error) {
+	return nil, errUnavailable
+}
+
+func TestReplicaMode_Satisfied(t *testing.T) {
+	assert.True(t, ReplicaModeQuorum.satisfied(2, 3))
+	assert.False(t, ReplicaModeQuorum.satisfied(1, 3))
+	assert.False(t, ReplicaModeQuorum.satisfied(1, 2))
+	assert.True(t, ReplicaModeAll.satisfied(3, 3))
+	assert.False(t, ReplicaModeAll.satisfied(2, 3))
+	assert.Error(t, ReplicaMode("most").Validate())
+}
+
+func TestPutObject(t *testing.T) {
+	ctx := context.Background()
+	primary, nas := newMemClient(), newMemClient()
+	down := downClient{newMemClient()}
+	file := &internal.File{Path: "a.txt", Content: []byte("hello")}
+
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: primary})
+	WithReplicas(ReplicaModeQuorum,
+		&Replica{ClientType: S3ClientTypeLocal, Endpoint: "/nas", Bucket: "b", Client: nas},
+		&Replica{ClientType: S3ClientTypeOSS, Endpoint: "other-region", Bucket: "b", Client: down},
+	)(c)
+	stats := newReplicaStats()
+	ctx = withReplicaStats(ctx, stats)
+
+	// 2 of 3 written is a quorum
+	obj, err := c.putObject(ctx, "ep", "a", "data", file, primary)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/a.txt", obj.Key)
+	_, err = nas.Stat(ctx, &internal.S3Object{Endpoint: "/nas", Bucket: "b", Key: "data/a.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.written["local://b@/nas"])
+	assert.Equal(t, 1, stats.failed["oss://b@other-region"])
+
+	c.replicaMode = ReplicaModeAll
+	_, err = c.putObject(ctx, "ep", "a", "data", file, primary)
+	assert.ErrorIs(t, err, errUnavailable)
+}
+
+func TestGetObject_Failover(t *testing.T) {
+	ctx := context.Background()
+	nas := newMemClient()
+	nas.put("/nas", "b", "data/a.txt", []byte("hello"), "")
+
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: newMemClient()})
+	WithReplicas(ReplicaModeQuorum,
+		&Replica{ClientType: S3ClientTypeLocal, Endpoint: "/nas", Bucket: "b", Client: nas},
+	)(c)
+
+	file, err := c.getObject(ctx, &internal.S3Object{Endpoint: "ep", Bucket: "a", Key: "data/a.txt"}, downClient{newMemClient()})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(file.Content))
+
+	_, err = c.getObject(ctx, &internal.S3Object{Endpoint: "ep", Bucket: "a", Key: "missing"}, downClient{newMemClient()})
+	assert.ErrorIs(t, err, errUnavailable)
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// TransferResult is the outcome of transferring a single file
+type TransferResult struct {
+	Path         string    // local path
+	Key          string    // object key
+	Size         int64     // object size in bytes
+	ETag         string    // object etag, empty when the client doesn't return it
+	LastModified time.Time // zero when the client doesn't return it
+	Err          error     // nil when the transfer succeeded
+}
+
+// TransferReport collects the results of a batch of transfers, it is safe
+// for concurrent use by the transfer workers
+type TransferReport struct {
+	op      string
+	retries func() int64 // retried requests so far, nil when clients don't retry
+	start   int64
+
+	mu      sync.Mutex
+	planned int
+	results []*TransferResult
+}
+
+func newTransferReport(op string, retries func() int64) *TransferReport {
+	r := &TransferReport{op: op, retries: retries}
+	if retries != nil {
+		r.start = retries()
+	}
+	return r
+}
+
+// Retries returns the number of requests retried since the report started
+func (r *TransferReport) Retries() int64 {
+	if r.retries == nil {
+		return 0
+	}
+	return r.retries() - r.start
+}
+
+// plan announces n more transfers, those that never report a result are
+// counted as skipped
+func (r *TransferReport) plan(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.planned += n
+}
+
+func (r *TransferReport) add(result *TransferResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+// Results returns the results in the order the transfers finished, none for
+// the nil report of a batch that failed before it started
+func (r *TransferReport) Results() []*TransferResult {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*TransferResult(nil), r.results...)
+}
+
+// Counts returns the number of transfers that succeeded, failed and were
+// never started
+func (r *TransferReport) Counts() (done, failed, skipped int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, result := range r.results {
+		if result.Err != nil {
+			failed++
+		} else {
+			done++
+		}
+	}
+	return done, failed, r.planned - done - failed
+}
+
+// finish logs a summary of the batch and returns the aggregated error, nil
+// only when every planned transfer succeeded
+func (r *TransferReport) finish(ctx context.Context, logger *slog.Logger) error {
+	done, failed, skipped := r.Counts()
+	retries := r.Retries()
+	if failed == 0 && skipped == 0 {
+		logger.Info(r.op+" finished", "done", done, "retries", retries)
+		return nil
+	}
+
+	err := &BatchError{Op: r.op, Total: done + failed + skipped, Failed: failed, Skipped: skipped}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err.Err = ctxErr
+		logger.Warn(r.op+" interrupted", "done", done, "failed", failed, "skipped", skipped, "retries", retries)
+		return err
+	}
+	for _, result := range r.Results() {
+		if result.Err != nil {
+			err.Err = result.Err
+			break
+		}
+	}
+	logger.Error(r.op+" failed", "done", done, "failed", failed, "skipped", skipped, "retries", retries)
+	return err
+}
+
+// BatchError is returned when some transfers of a batch did not succeed
+type BatchError struct {
+	Op      string
+	Total   int
+	Failed  int
+	Skipped int   // not started, the batch was interrupted
+	Err     error // the context error when interrupted, otherwise the first failure
+}
+
+func (e *BatchError) Error() string {
+	if e.Skipped > 0 {
+		return fmt.Sprintf("%s: %d of %d files failed, %d skipped: %v", e.Op, e.Failed, e.Total, e.Skipped, e.Err)
+	}
+	return fmt.Sprintf("%s: %d of %d files failed: %v", e.Op, e.Failed, e.Total, e.Err)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// Partial reports whether at least one file of the batch was transferred
+func (e *BatchError) Partial() bool {
+	return e.Failed+e.Skipped < e.Total
+}
+
+// IsPartialFailure reports whether err is a batch error where some, but not
+// all, files failed
+func IsPartialFailure(err error) bool {
+	var batchErr *BatchError
+	return errors.As(err, &batchErr) && batchErr.Partial()
+}
+
+// retries returns the number of retried requests of all clients, replicas
+// and erasure targets included
+func (c *Controller) retries() int64 {
+	clients := make([]internal.IS3Client, 0, len(c.clients)+len(c.replicas))
+	for _, client := range c.clients {
+		clients = append(clients, client)
+	}
+	for _, replica := range c.replicas {
+		clients = append(clients, replica.Client)
+	}
+	if c.erasure != nil {
+		for _, target := range c.erasure.Targets {
+			clients = append(clients, target.Client)
+		}
+	}
+
+	var total int64
+	for _, client := range clients {
+		if counter, ok := client.(internal.IRetryCounter); ok {
+			total += counter.Retries()
+		}
+	}
+	return total
+}
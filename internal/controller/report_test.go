@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpload_Report(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{
+		S3ClientTypeOSS: mem,
+		S3ClientTypeS3:  downClient{newMemClient()},
+	})
+	opts := UploadOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", EncryptKey: "k"}
+
+	// everything uploaded
+	opts.Paths = []string{dir}
+	report, err := c.Upload(ctx, opts)
+	assert.NoError(t, err)
+	keys := make([]string, 0, 2)
+	for _, result := range report.Results() {
+		assert.NoError(t, result.Err)
+		assert.Positive(t, result.Size)
+		keys = append(keys, result.Key)
+	}
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt"}, keys)
+
+	// one path is missing, the others are still uploaded
+	opts.Paths = []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "missing.txt")}
+	report, err = c.Upload(ctx, opts)
+	assert.Len(t, report.Results(), 2)
+	var batchErr *BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 2, batchErr.Total)
+	assert.Equal(t, 1, batchErr.Failed)
+	assert.True(t, IsPartialFailure(err))
+
+	// nothing could be uploaded
+	opts.S3ClientType = S3ClientTypeS3
+	opts.Paths = []string{dir}
+	_, err = c.Upload(ctx, opts)
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.False(t, IsPartialFailure(err))
+}
+
+func TestDownload_Report(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	putEncrypted(t, c, mem, "ep", "bucket", "data/a.txt", "a", "k")
+
+	opts := DownloadOptions{
+		S3ClientType: S3ClientTypeOSS,
+		Endpoint:     "ep",
+		Bucket:       "bucket",
+		OutputDir:    t.TempDir(),
+		DecryptKey:   "k",
+		S3keys:       []string{"data/a.txt", "data/missing.txt"},
+	}
+	report, err := c.Download(ctx, opts)
+	assert.True(t, IsPartialFailure(err))
+	done, failed, _ := report.Counts()
+	assert.Equal(t, 1, done)
+	assert.Equal(t, 1, failed)
+
+	opts.S3keys = []string{"data/missing.txt"}
+	_, err = c.Download(ctx, opts)
+	assert.Error(t, err)
+	assert.False(t, IsPartialFailure(err))
+}
+
+func TestTransferReport_Retries(t *testing.T) {
+	var retries int64 = 3
+	report := newTransferReport("upload", func() int64 { return retries })
+	retries += 2
+	assert.Equal(t, int64(2), report.Retries())
+	assert.Equal(t, int64(0), newTransferReport("upload", nil).Retries())
+}
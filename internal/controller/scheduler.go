@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+)
+
+// defaultMemoryLimit bounds the size of the files in flight when no limit is set
+const defaultMemoryLimit = 512 << 20
+
+// transferCopies is the number of copies of a file a transfer holds at once,
+// the plain, compressed and encrypted content of an upload are all in memory
+// until it is sent, so a task weighs this many times its size
+const transferCopies = 3
+
+// WithMemoryLimit bounds the memory of the files being transferred at once,
+// each file counts transferCopies times its size. A file larger than the
+// limit is transferred alone.
+func WithMemoryLimit(bytes int64) Option {
+	return func(c *Controller) {
+		c.memoryLimit = bytes
+	}
+}
+
+// transferTask is a single file transfer planned by an operation
+type transferTask struct {
+	size int64 // plain size of the file
+	run  func()
+}
+
+// fileSize returns the size of the file at path, 0 when it can not be read
+// and the transfer reports the error
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// scheduler runs transfer tasks on a fixed number of workers while the total
+// size of the running tasks stays under a memory budget. Every file is held
+// in memory while it's transferred, the budget keeps a directory of large
+// files from exhausting RAM.
+type scheduler struct {
+	workers int
+	budget  int64
+
+	mu       sync.Mutex
+	inflight int64
+	released chan struct{} // signalled when a task finishes
+}
+
+func (c *Controller) newScheduler() *scheduler {
+	budget := c.memoryLimit
+	if budget <= 0 {
+		budget = defaultMemoryLimit
+	}
+	return &scheduler{
+		workers:  c.parallelism(),
+		budget:   budget,
+		released: make(chan struct{}, 1),
+	}
+}
+
+// run runs the tasks, the smallest ones first so many small files are not
+// stuck behind a few large ones, and returns when all started tasks have
+// finished. No task is started once ctx is done.
+func (s *scheduler) run(ctx context.Context, tasks []transferTask) {
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].size < tasks[j].size })
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, s.workers)
+
+	for _, task := range tasks {
+		weight := min(max(task.size, 0)*transferCopies, s.budget)
+		if !s.acquire(ctx, weight) {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(task transferTask) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				s.release(weight)
+				wg.Done()
+			}()
+			task.run()
+		}(task)
+	}
+
+	wg.Wait()
+}
+
+// acquire waits until weight more bytes fit in the budget, it returns false
+// when ctx is done first
+func (s *scheduler) acquire(ctx context.Context, weight int64) bool {
+	for {
+		if ctx.Err() != nil {
+			return false
+		}
+		s.mu.Lock()
+		if s.inflight == 0 || s.inflight+weight <= s.budget {
+			s.inflight += weight
+			s.mu.Unlock()
+			return true
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.released:
+		}
+	}
+}
+
+func (s *scheduler) release(weight int64) {
+	s.mu.Lock()
+	s.inflight -= weight
+	s.mu.Unlock()
+
+	select {
+	case s.released <- struct{}{}:
+	default:
+	}
+}
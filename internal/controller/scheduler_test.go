@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_Run(t *testing.T) {
+	s := &scheduler{workers: 4, budget: 100, released: make(chan struct{}, 1)}
+
+	var mu sync.Mutex
+	var order []int64
+	var inflight, peak atomic.Int64
+	tasks := make([]transferTask, 0)
+	for _, size := range []int64{30, 5, 20, 10, 90, 12} {
+		tasks = append(tasks, transferTask{size: size, run: func() {
+			weight := min(size*transferCopies, 100)
+			peak.Store(max(peak.Load(), inflight.Add(weight)))
+			time.Sleep(5 * time.Millisecond)
+			inflight.Add(-weight)
+
+			mu.Lock()
+			order = append(order, size)
+			mu.Unlock()
+		}})
+	}
+	s.run(context.Background(), tasks)
+
+	assert.Len(t, order, 6)
+	// the file larger than the budget runs alone and last
+	assert.Equal(t, int64(90), order[5])
+	assert.LessOrEqual(t, peak.Load(), int64(100))
+}
+
+func TestScheduler_Cancelled(t *testing.T) {
+	s := &scheduler{workers: 1, budget: 100, released: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ran atomic.Int64
+	tasks := make([]transferTask, 0)
+	for i := 0; i < 5; i++ {
+		tasks = append(tasks, transferTask{size: 80, run: func() {
+			ran.Add(1)
+			cancel()
+		}})
+	}
+	s.run(ctx, tasks)
+	assert.Equal(t, int64(1), ran.Load())
+}
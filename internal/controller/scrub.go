@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// scrubCursor remembers where the last cycling scrub stopped
+type scrubCursor struct {
+	Endpoint  string    `json:"endpoint"`
+	Bucket    string    `json:"bucket"`
+	Prefix    string    `json:"prefix"`
+	LastKey   string    `json:"last_key"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func defaultScrubCursorPath(endpoint, bucket, prefix string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(endpoint + "\n" + bucket + "\n" + prefix))
+	return filepath.Join(home, ".soss", "scrub", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func loadScrubCursor(path string) (*scrubCursor, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &scrubCursor{}, nil
+		}
+		return nil, err
+	}
+	cursor := &scrubCursor{}
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func saveScrubCursor(path string, cursor *scrubCursor) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cursor, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// sampleObjects randomly picks percent% (at least one) of objs, in key order
+func sampleObjects(objs []*internal.S3Object, percent float64) []*internal.S3Object {
+	n := int(math.Ceil(float64(len(objs)) * percent / 100))
+	if n >= len(objs) {
+		return objs
+	}
+
+	picked := make([]*internal.S3Object, 0, n)
+	for _, i := range rand.Perm(len(objs))[:n] {
+		picked = append(picked, objs[i])
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].Key < picked[j].Key })
+	return picked
+}
+
+// cycleObjects picks the next 1/days of the key ordered objs after lastKey, wrapping around,
+// so every object is checked once within the given days
+func cycleObjects(objs []*internal.S3Object, lastKey string, days int) []*internal.S3Object {
+	n := int(math.Ceil(float64(len(objs)) / float64(days)))
+	if n >= len(objs) {
+		return objs
+	}
+
+	start := sort.Search(len(objs), func(i int) bool { return objs[i].Key > lastKey })
+	picked := make([]*internal.S3Object, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, objs[(start+i)%len(objs)])
+	}
+	return picked
+}
+
+type ScrubReport struct {
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Endpoint   string          `json:"endpoint"`
+	Bucket     string          `json:"bucket"`
+	Prefix     string          `json:"prefix"`
+	Total      int             `json:"total"`
+	Checked    int             `json:"checked"`
+	Failed     int             `json:"failed"`
+	Failures   []*VerifyResult `json:"failures"`
+}
+
+type ScrubOptions struct {
+	S3ClientType  S3ClientType
+	Endpoint      string
+	Bucket        string
+	Prefix        string
+	DecryptKey    string
+	SamplePercent float64 // randomly verify this percent of objects
+	CycleDays     int     // if > 0, verify all objects over this many days using a persisted cursor
+	CursorPath    string  // cursor file of cycling scrub, default $HOME/.soss/scrub/<hash>.json
+	ReportPath    string  // if set, the json report is written to this file
+}
+
+// Scrub verifies a sample of the objects under the prefix, see Verify,
+// and writes a json report of the failures. The report is returned as well.
+func (c *Controller) Scrub(ctx context.Context, opts ScrubOptions) (*ScrubReport, error) {
+	if err := c.requireBucket("scrub"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CycleDays <= 0 && (opts.SamplePercent <= 0 || opts.SamplePercent > 100) {
+		err := errors.New("sample percent must be in (0, 100]")
+		c.logger.Error("scrub failed", "err", err.Error())
+		return nil, err
+	}
+
+	report := &ScrubReport{
+		StartedAt: time.Now(),
+		Endpoint:  endpoint,
+		Bucket:    bucket,
+		Prefix:    opts.Prefix,
+		Failures:  make([]*VerifyResult, 0),
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, opts.Prefix)
+	if err != nil {
+		c.logger.Error("scrub failed", "prefix", opts.Prefix, "err", err.Error())
+		return nil, err
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Key < objs[j].Key })
+	report.Total = len(objs)
+
+	var picked []*internal.S3Object
+	var cursor *scrubCursor
+	cursorPath := opts.CursorPath
+	if opts.CycleDays > 0 {
+		if cursorPath == "" {
+			if cursorPath, err = defaultScrubCursorPath(endpoint, bucket, opts.Prefix); err != nil {
+				return nil, err
+			}
+		}
+		if cursor, err = loadScrubCursor(cursorPath); err != nil {
+			c.logger.Error("load scrub cursor failed", "path", cursorPath, "err", err.Error())
+			return nil, err
+		}
+		picked = cycleObjects(objs, cursor.LastKey, opts.CycleDays)
+	} else {
+		picked = sampleObjects(objs, opts.SamplePercent)
+	}
+	report.Checked = len(picked)
+
+	for _, result := range c.verifyObjects(ctx, endpoint, bucket, opts.DecryptKey, picked, client) {
+		if result.Status.Failed() {
+			c.logger.Error("scrub failed", "key", result.Key, "status", result.Status, "err", result.Error)
+			report.Failures = append(report.Failures, result)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		// leave the cursor and report untouched, the batch was not checked
+		return nil, err
+	}
+	report.Failed = len(report.Failures)
+	report.FinishedAt = time.Now()
+
+	// move the cursor forward only when the batch has been checked
+	if cursor != nil && len(picked) > 0 {
+		cursor.Endpoint = endpoint
+		cursor.Bucket = bucket
+		cursor.Prefix = opts.Prefix
+		cursor.LastKey = picked[len(picked)-1].Key
+		cursor.UpdatedAt = report.FinishedAt
+		if err := saveScrubCursor(cursorPath, cursor); err != nil {
+			c.logger.Error("save scrub cursor failed", "path", cursorPath, "err", err.Error())
+			return nil, err
+		}
+	}
+
+	if opts.ReportPath != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(opts.ReportPath, b, 0644); err != nil {
+			c.logger.Error("write scrub report failed", "path", opts.ReportPath, "err", err.Error())
+			return nil, err
+		}
+	}
+
+	c.logger.Info("scrub finished", "total", report.Total, "checked", report.Checked, "failed", report.Failed)
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d objects failed verification", report.Failed, report.Checked)
+	}
+	return report, nil
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func testObjects(n int) []*internal.S3Object {
+	objs := make([]*internal.S3Object, n)
+	for i := range objs {
+		objs[i] = &internal.S3Object{Key: fmt.Sprintf("key-%02d", i)}
+	}
+	return objs
+}
+
+func keysOf(objs []*internal.S3Object) []string {
+	keys := make([]string, len(objs))
+	for i, obj := range objs {
+		keys[i] = obj.Key
+	}
+	return keys
+}
+
+func TestSampleObjects(t *testing.T) {
+	objs := testObjects(10)
+	assert.Len(t, sampleObjects(objs, 30), 3)
+	assert.Len(t, sampleObjects(objs, 1), 1)
+	assert.Len(t, sampleObjects(objs, 100), 10)
+}
+
+func TestCycleObjects(t *testing.T) {
+	objs := testObjects(5)
+
+	picked := cycleObjects(objs, "", 2)
+	assert.Equal(t, []string{"key-00", "key-01", "key-02"}, keysOf(picked))
+
+	picked = cycleObjects(objs, "key-02", 2)
+	assert.Equal(t, []string{"key-03", "key-04", "key-00"}, keysOf(picked))
+
+	// the last key has been deleted since the last run
+	picked = cycleObjects(objs, "key-015", 5)
+	assert.Equal(t, []string{"key-02"}, keysOf(picked))
+}
+
+func TestScrub(t *testing.T) {
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	uploadFiles(t, c, S3ClientTypeOSS, "ep", "bucket", "data", "k", map[string]string{
+		"a.txt": "a", "b.txt": "b", "c.txt": "c", "d.txt": "d",
+	})
+	mem.corrupt("ep", "bucket", "data/b.txt")
+
+	dir := t.TempDir()
+	opts := ScrubOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data/", DecryptKey: "k",
+		CycleDays:  2,
+		CursorPath: filepath.Join(dir, "cursor.json"),
+		ReportPath: filepath.Join(dir, "report.json"),
+	}
+
+	// the first run checks a and b, and reports the corrupt b
+	report, err := c.Scrub(context.Background(), opts)
+	assert.Error(t, err)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, 1, report.Failed)
+	if assert.Len(t, report.Failures, 1) {
+		assert.Equal(t, "data/b.txt", report.Failures[0].Key)
+		assert.Equal(t, VerifyStatusCorrupt, report.Failures[0].Status)
+	}
+
+	cursor, err := loadScrubCursor(opts.CursorPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/b.txt", cursor.LastKey)
+
+	b, err := os.ReadFile(opts.ReportPath)
+	assert.NoError(t, err)
+	written := &ScrubReport{}
+	assert.NoError(t, json.Unmarshal(b, written))
+	assert.Equal(t, 1, written.Failed)
+	assert.Equal(t, "data/b.txt", written.Failures[0].Key)
+
+	// the next run continues after the cursor with c and d
+	report, err = c.Scrub(context.Background(), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, 0, report.Failed)
+
+	cursor, err = loadScrubCursor(opts.CursorPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/d.txt", cursor.LastKey)
+}
@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+type SyncAction string
+
+const (
+	SyncActionUpload SyncAction = "upload"
+	SyncActionDelete SyncAction = "delete"
+	SyncActionSkip   SyncAction = "skip"
+)
+
+type SyncItem struct {
+	Action SyncAction
+	Reason string // new, changed, unchanged, deleted locally ...
+	Key    string // object key
+	Path   string // local path, empty if only exists remotely
+	Prefix string // upload prefix of Path
+	Size   int64  // object size of a download or delete
+}
+
+// listPrefix returns the prefix to list the objects uploaded under prefix,
+// "data" must not match "data2/x"
+func listPrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
+// remoteChanged reports whether the local file differs from the object,
+// comparing size and mtime first and falling back to the plaintext checksum.
+// meta is the decrypted metadata of the object, nil if it has none or can not be decrypted
+func (c *Controller) remoteChanged(
+	ctx context.Context, endpoint, bucket, decryptKey, path, s3key string, client internal.IS3Client) (changed bool, meta *internal.FileMeta, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, nil, err
+	}
+
+	remote, err := client.Stat(ctx, &internal.S3Object{Endpoint: endpoint, Bucket: bucket, Key: s3key})
+	if err != nil {
+		return false, nil, err
+	}
+	if remote.EncryptedMeta == "" {
+		// uploaded by an older version, nothing to compare with
+		return true, nil, nil
+	}
+	meta, err = c.fileHandler.DecryptMeta(remote.EncryptedMeta, decryptKey)
+	if err != nil {
+		// uploaded with another key
+		return true, nil, nil
+	}
+
+	if meta.Size == info.Size() && meta.ModTime.Equal(info.ModTime()) {
+		return false, meta, nil
+	}
+	if meta.Size != info.Size() || meta.Checksum == "" {
+		return true, meta, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, nil, err
+	}
+	return utils.Sha256Hex(content) != meta.Checksum, meta, nil
+}
+
+func (c *Controller) syncPlan(
+	ctx context.Context, endpoint, bucket, prefix, root, decryptKey string, deleteRemote bool, client internal.IS3Client) ([]*SyncItem, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{root}
+	if info.IsDir() {
+		if files, err = c.fileHandler.SearchFiles(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, listPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	objs = withoutTrash(objs)
+	remote := make(map[string]*internal.S3Object, len(objs))
+	for _, obj := range objs {
+		remote[obj.Key] = obj
+	}
+
+	items := make([]*SyncItem, len(files))
+	errs := make([]error, len(files))
+
+	var wg sync.WaitGroup
+	limiter := make(chan struct{}, c.parallelism())
+
+	for i, file := range files {
+		subPrefix := uploadPrefix(prefix, root, file)
+		item := &SyncItem{
+			Key:    filepath.Join(subPrefix, filepath.Base(file)),
+			Path:   file,
+			Prefix: subPrefix,
+		}
+		items[i] = item
+
+		if _, ok := remote[item.Key]; !ok {
+			item.Action, item.Reason = SyncActionUpload, "new"
+			continue
+		}
+		delete(remote, item.Key)
+
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(i int) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+
+			changed, _, err := c.remoteChanged(ctx, endpoint, bucket, decryptKey, items[i].Path, items[i].Key, client)
+			if err != nil {
+				errs[i] = fmt.Errorf("compare %s: %w", items[i].Path, err)
+				return
+			}
+			if changed {
+				items[i].Action, items[i].Reason = SyncActionUpload, "changed"
+			} else {
+				items[i].Action, items[i].Reason = SyncActionSkip, "unchanged"
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// objects left have no local file anymore, unless a single file is synced,
+	// then the other objects under the prefix are not ours to delete
+	if deleteRemote && info.IsDir() {
+		for key, obj := range remote {
+			items = append(items, &SyncItem{Action: SyncActionDelete, Reason: "deleted locally", Key: key, Size: obj.Size})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+// confirmBucketDelete asks before the deletes of a sync without a prefix,
+// they may remove anything in the bucket
+func confirmBucketDelete(opts SyncOptions, items []*SyncItem) error {
+	if listPrefix(opts.Prefix) != "" {
+		return nil
+	}
+	count, size := 0, int64(0)
+	for _, item := range items {
+		if item.Action == SyncActionDelete {
+			count++
+			size += item.Size
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	if opts.Confirm == nil {
+		return fmt.Errorf("refusing to delete %d objects of the whole bucket, set a prefix or confirm", count)
+	}
+	if !opts.Confirm(count, size) {
+		return errors.New("aborted")
+	}
+	return nil
+}
+
+type SyncOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	EncryptKey   string
+	Path         string // local directory or file to sync
+	Delete       bool   // if true, objects without a local file are deleted
+	DryRun       bool   // if true, only return the plan
+	Xattrs       bool   // if true, extended attributes are uploaded with the file metadata
+
+	Bidirectional bool   // if true, changes are applied in both directions, see syncBidirectional
+	StatePath     string // local database of the bidirectional sync, default $HOME/.soss/sync/<hash>.json
+	ReportPath    string // if set, the json report of the bidirectional sync is written to this file
+	NoOwner       bool   // if true, uid / gid are not restored on download
+
+	// Confirm is asked before Delete removes objects without a Prefix, where
+	// every object of the bucket without a local file is deleted. Without it
+	// such a sync fails.
+	Confirm func(count int, size int64) bool
+}
+
+// Sync uploads the new and changed files of a local directory to the prefix,
+// unchanged files are detected with the metadata stored with each object.
+// With Bidirectional, remote changes are downloaded as well and conflicts are kept as renamed copies.
+// It returns the plan, carried out unless DryRun is set.
+func (c *Controller) Sync(ctx context.Context, opts SyncOptions) ([]*SyncItem, error) {
+	if err := c.requireBucket("sync"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Bidirectional {
+		return c.syncBidirectional(ctx, endpoint, bucket, opts, client)
+	}
+
+	items, err := c.syncPlan(ctx, endpoint, bucket, opts.Prefix, opts.Path, opts.EncryptKey, opts.Delete, client)
+	if err != nil {
+		c.logger.Error("sync failed", "path", opts.Path, "err", err.Error())
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return items, nil
+	}
+	if err := confirmBucketDelete(opts, items); err != nil {
+		c.logger.Error("sync failed", "path", opts.Path, "err", err.Error())
+		return items, err
+	}
+
+	metaOpts := internal.MetaOptions{Owner: true, Xattrs: opts.Xattrs}
+	report := newTransferReport("sync", c.retries)
+	tasks := make([]transferTask, 0)
+	toDelete := make([]string, 0)
+	for _, item := range items {
+		switch item.Action {
+		case SyncActionDelete:
+			toDelete = append(toDelete, item.Key)
+		case SyncActionUpload:
+			tasks = append(tasks, transferTask{size: fileSize(item.Path), run: func() {
+				_, err := c.uploadSingleFile(
+					ctx, endpoint, bucket, item.Prefix, item.Path, opts.EncryptKey, metaOpts, client)
+				report.add(&TransferResult{Path: item.Path, Key: item.Key, Err: err})
+			}})
+		}
+	}
+	report.plan(len(tasks) + len(toDelete))
+	c.newScheduler().run(ctx, tasks)
+
+	// the deletes are skipped when the uploads were interrupted
+	if len(toDelete) > 0 && ctx.Err() == nil {
+		deleted, err := c.deleteObjects(ctx, endpoint, bucket, toDelete, c.trash, client)
+		done := make(map[string]struct{}, len(deleted))
+		for _, key := range deleted {
+			c.logger.Info("deleted", "key", bucket+":"+key)
+			done[key] = struct{}{}
+			report.add(&TransferResult{Key: key})
+		}
+		if err != nil {
+			c.logger.Error("delete failed", "err", err.Error())
+			for _, key := range toDelete {
+				if _, ok := done[key]; !ok {
+					report.add(&TransferResult{Key: key, Err: err})
+				}
+			}
+		}
+	}
+
+	return items, report.finish(ctx, c.logger)
+}
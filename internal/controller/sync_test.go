@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadPrefix(t *testing.T) {
+	assert.Equal(t, "data", uploadPrefix("data", "a.txt", "a.txt"))
+	assert.Equal(t, "data/aa/bb", uploadPrefix("data", "uploads", "uploads/aa/bb/cc.txt"))
+	assert.Equal(t, ".", uploadPrefix("", "uploads", "uploads/xx.txt"))
+}
+
+func TestListPrefix(t *testing.T) {
+	assert.Equal(t, "", listPrefix(""))
+	assert.Equal(t, "data/", listPrefix("data"))
+	assert.Equal(t, "data/", listPrefix("data/"))
+}
+
+// syncFixture uploads a.txt and b.txt of a local directory to data/, then
+// changes b.txt, adds c.txt and stores data/gone.txt only remotely
+func syncFixture(t *testing.T) (*Controller, *memClient, string) {
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("aaaa"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bb"), 0644))
+	_, err := c.Upload(context.Background(), UploadOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", EncryptKey: "k", Paths: []string{dir},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("bbbb"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "c.txt"), []byte("cc"), 0644))
+	putEncrypted(t, c, mem, "ep", "bucket", "data/gone.txt", "gone", "k")
+	return c, mem, dir
+}
+
+func TestSyncPlan(t *testing.T) {
+	c, mem, dir := syncFixture(t)
+
+	items, err := c.syncPlan(context.Background(), "ep", "bucket", "data", dir, "k", true, mem)
+	assert.NoError(t, err)
+	actions := make(map[string]string, len(items))
+	for _, item := range items {
+		actions[item.Key] = string(item.Action) + " " + item.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"data/a.txt":    "skip unchanged",
+		"data/b.txt":    "upload changed",
+		"data/c.txt":    "upload new",
+		"data/gone.txt": "delete deleted locally",
+	}, actions)
+
+	// without deleteRemote the remote only object is left alone
+	items, err = c.syncPlan(context.Background(), "ep", "bucket", "data", dir, "k", false, mem)
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+
+	// a single file never deletes the other objects under the prefix
+	items, err = c.syncPlan(context.Background(), "ep", "bucket", "data", filepath.Join(dir, "c.txt"), "k", true, mem)
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "data/c.txt", items[0].Key)
+		assert.Equal(t, SyncActionUpload, items[0].Action)
+	}
+}
+
+func TestRemoteChanged(t *testing.T) {
+	c, mem, dir := syncFixture(t)
+	ctx := context.Background()
+
+	changed, meta, err := c.remoteChanged(ctx, "ep", "bucket", "k", filepath.Join(dir, "a.txt"), "data/a.txt", mem)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, int64(4), meta.Size)
+
+	changed, _, err = c.remoteChanged(ctx, "ep", "bucket", "k", filepath.Join(dir, "b.txt"), "data/b.txt", mem)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// metadata of another key can not be compared
+	changed, _, err = c.remoteChanged(ctx, "ep", "bucket", "other", filepath.Join(dir, "a.txt"), "data/a.txt", mem)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestSync_Delete(t *testing.T) {
+	c, mem, dir := syncFixture(t)
+	ctx := context.Background()
+	opts := SyncOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data", EncryptKey: "k", Path: dir, Delete: true}
+
+	_, err := c.Sync(ctx, opts)
+	assert.NoError(t, err)
+	objs, err := mem.List(ctx, "ep", "bucket", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data/a.txt", "data/b.txt", "data/c.txt"}, keysOf(objs))
+
+	// without a prefix every object of the bucket is a candidate
+	mem.put("ep", "bucket", "other/x.txt", []byte("x"), "")
+	opts.Prefix = ""
+	_, err = c.Sync(ctx, opts)
+	assert.Error(t, err)
+	opts.Confirm = func(count int, size int64) bool { return false }
+	_, err = c.Sync(ctx, opts)
+	assert.Error(t, err)
+	_, err = mem.Stat(ctx, &internal.S3Object{Endpoint: "ep", Bucket: "bucket", Key: "other/x.txt"})
+	assert.NoError(t, err)
+}
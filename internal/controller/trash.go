@@ -0,0 +1,399 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// deleted objects are moved to <trashDir>/<batch>/<original key>,
+// batch is the utc time of the deletion
+const (
+	trashDir         = ".soss-trash"
+	trashBatchLayout = "20060102T150405Z"
+)
+
+func isTrashKey(key string) bool {
+	return key == trashDir || strings.HasPrefix(key, trashDir+"/")
+}
+
+func withoutTrash(objs []*internal.S3Object) []*internal.S3Object {
+	filtered := make([]*internal.S3Object, 0, len(objs))
+	for _, obj := range objs {
+		if !isTrashKey(obj.Key) {
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered
+}
+
+// splitTrashKey returns the batch and the original key of an object in the trash
+func splitTrashKey(key string) (batch, original string, ok bool) {
+	rest, found := strings.CutPrefix(key, trashDir+"/")
+	if !found {
+		return "", "", false
+	}
+	batch, original, ok = strings.Cut(rest, "/")
+	return batch, original, ok && original != ""
+}
+
+// moveObjects server side copies each src key to its dst key, then deletes the copied src keys
+func (c *Controller) moveObjects(
+	ctx context.Context, endpoint, bucket string, moves map[string]string, client internal.IS3Client) (moved []string, err error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	limiter := make(chan struct{}, c.parallelism())
+
+	copied := make([]string, 0, len(moves))
+	errs := make([]error, 0)
+	for src, dst := range moves {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		limiter <- struct{}{} // Take up a concurrent signal
+
+		go func(src, dst string) {
+			defer func() {
+				<-limiter // Release a concurrent signal
+				wg.Done()
+			}()
+			err := client.Copy(ctx, endpoint, bucket, src, bucket, dst)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("copy %s: %w", src, err))
+				return
+			}
+			copied = append(copied, src)
+		}(src, dst)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// only what has been copied is deleted
+	sort.Strings(copied)
+	moved, err = client.Delete(ctx, endpoint, bucket, copied)
+	return moved, errors.Join(append(errs, err)...)
+}
+
+// newTrashBatch names the trash batch of the objects deleted now
+func newTrashBatch() string {
+	return time.Now().UTC().Format(trashBatchLayout)
+}
+
+// deleteObjects deletes the keys, or moves them to the trash when trash is true.
+// Objects already in the trash are always deleted
+func (c *Controller) deleteObjects(
+	ctx context.Context, endpoint, bucket string, keys []string, trash bool, client internal.IS3Client) (deleted []string, err error) {
+	return c.deleteObjectsTo(ctx, endpoint, bucket, newTrashBatch(), keys, trash, client)
+}
+
+// deleteObjectsTo is deleteObjects moving the keys to the given trash batch,
+// so objects deleted by several calls are restored together
+func (c *Controller) deleteObjectsTo(
+	ctx context.Context, endpoint, bucket, batch string, keys []string, trash bool, client internal.IS3Client) (deleted []string, err error) {
+	if !trash {
+		return client.Delete(ctx, endpoint, bucket, keys)
+	}
+
+	moves := make(map[string]string, len(keys))
+	purge := make([]string, 0)
+	for _, key := range keys {
+		if isTrashKey(key) {
+			purge = append(purge, key)
+			continue
+		}
+		moves[key] = path.Join(trashDir, batch, key)
+	}
+
+	deleted, err = c.moveObjects(ctx, endpoint, bucket, moves, client)
+	if len(purge) > 0 {
+		purged, purgeErr := client.Delete(ctx, endpoint, bucket, purge)
+		deleted = append(deleted, purged...)
+		err = errors.Join(err, purgeErr)
+	}
+	return deleted, err
+}
+
+// TrashBatch is the objects deleted at once, they are kept below the trash
+// prefix under the batch name
+type TrashBatch struct {
+	Name string
+	Time time.Time // when the objects were deleted
+	Objs []*internal.S3Object
+	Size int64
+}
+
+func (c *Controller) listTrash(ctx context.Context, endpoint, bucket string, client internal.IS3Client) ([]*TrashBatch, error) {
+	objs, err := client.List(ctx, endpoint, bucket, trashDir+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make(map[string]*TrashBatch)
+	for _, obj := range objs {
+		name, _, ok := splitTrashKey(obj.Key)
+		if !ok {
+			continue
+		}
+		b, ok := batches[name]
+		if !ok {
+			t, _ := time.Parse(trashBatchLayout, name)
+			b = &TrashBatch{Name: name, Time: t}
+			batches[name] = b
+		}
+		b.Objs = append(b.Objs, obj)
+		b.Size += obj.Size
+	}
+
+	sorted := make([]*TrashBatch, 0, len(batches))
+	for _, b := range batches {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted, nil
+}
+
+type TrashOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+}
+
+// TrashList returns the batches of deleted objects in the trash, oldest first.
+func (c *Controller) TrashList(ctx context.Context, opts TrashOptions) ([]*TrashBatch, error) {
+	if err := c.requireBucket("trash list"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	batches, err := c.listTrash(ctx, endpoint, bucket, client)
+	if err != nil {
+		c.logger.Error(err.Error())
+		return nil, err
+	}
+	return batches, nil
+}
+
+type TrashRestoreOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Batch        string   // batch to restore, required
+	S3keys       []string // if set, only these original keys or prefixes are restored
+	Force        bool     // if true, objects stored again at the original key are overwritten
+}
+
+// TrashRestore moves the objects of a batch back to their original key and
+// returns the original keys restored.
+func (c *Controller) TrashRestore(ctx context.Context, opts TrashRestoreOptions) ([]string, error) {
+	if err := c.requireBucket("trash restore"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single batch only, two batches may hold the same original key
+	if opts.Batch == "" || strings.Contains(opts.Batch, "/") || strings.Contains(opts.Batch, "..") {
+		err := fmt.Errorf("invalid trash batch %q", opts.Batch)
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, path.Join(trashDir, opts.Batch)+"/")
+	if err != nil {
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+
+	moves := make(map[string]string)
+	for _, obj := range objs {
+		_, original, ok := splitTrashKey(obj.Key)
+		if !ok {
+			continue
+		}
+		if len(opts.S3keys) > 0 && !matchAnyKey(original, opts.S3keys) {
+			continue
+		}
+		moves[obj.Key] = original
+	}
+	if len(moves) == 0 {
+		err := fmt.Errorf("nothing to restore in trash batch %s", opts.Batch)
+		c.logger.Error("restore failed", "err", err.Error())
+		return nil, err
+	}
+	if !opts.Force {
+		existing, err := c.existingKeys(ctx, endpoint, bucket, moves, client)
+		if err != nil {
+			c.logger.Error("restore failed", "err", err.Error())
+			return nil, err
+		}
+		if len(existing) > 0 {
+			err := fmt.Errorf("%d objects exist at their original key, e.g. %s, use force to overwrite them", len(existing), existing[0])
+			c.logger.Error("restore failed", "err", err.Error())
+			return nil, err
+		}
+	}
+
+	moved, err := c.moveObjects(ctx, endpoint, bucket, moves, client)
+	restored := make([]string, 0, len(moved))
+	for _, key := range moved {
+		c.logger.Info("restored", "key", bucket+":"+moves[key])
+		restored = append(restored, moves[key])
+	}
+	if err != nil {
+		c.logger.Error("restore failed", "err", err.Error())
+		return restored, err
+	}
+	return restored, nil
+}
+
+// existingKeys returns the destinations of moves that hold an object, sorted
+func (c *Controller) existingKeys(
+	ctx context.Context, endpoint, bucket string, moves map[string]string, client internal.IS3Client) ([]string, error) {
+	// one list below the directory shared by all destinations
+	dir := ""
+	for _, dst := range moves {
+		if dir == "" {
+			dir = path.Dir(dst)
+		}
+		for dir != "." && !strings.HasPrefix(dst, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	prefix := ""
+	if dir != "." {
+		prefix = dir + "/"
+	}
+	objs, err := client.List(ctx, endpoint, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	dsts := make(map[string]struct{}, len(moves))
+	for _, dst := range moves {
+		dsts[dst] = struct{}{}
+	}
+	existing := make([]string, 0)
+	for _, obj := range objs {
+		if _, ok := dsts[obj.Key]; ok {
+			existing = append(existing, obj.Key)
+		}
+	}
+	sort.Strings(existing)
+	return existing, nil
+}
+
+// matchAnyKey reports whether key is one of keys or below one of them
+func matchAnyKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasPrefix(key, listPrefix(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+type TrashEmptyOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	OlderThan    time.Duration // if > 0, only batches deleted before now - OlderThan are emptied
+	DryRun       bool          // if true, only return what would be deleted
+
+	// Confirm is asked before deleting anything, the deletion is aborted when it returns false
+	Confirm func(count int, size int64) bool
+}
+
+// TrashEmpty permanently deletes the objects in the trash and returns them,
+// with DryRun the ones that would be deleted.
+func (c *Controller) TrashEmpty(ctx context.Context, opts TrashEmptyOptions) ([]*internal.S3Object, error) {
+	if err := c.requireBucket("trash empty"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	batches, err := c.listTrash(ctx, endpoint, bucket, client)
+	if err != nil {
+		c.logger.Error("empty trash failed", "err", err.Error())
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	objs := make([]*internal.S3Object, 0)
+	keys := make([]string, 0)
+	var size int64
+	for _, b := range batches {
+		if opts.OlderThan > 0 && !b.Time.Before(cutoff) {
+			continue
+		}
+		for _, obj := range b.Objs {
+			objs = append(objs, obj)
+			keys = append(keys, obj.Key)
+		}
+		size += b.Size
+	}
+
+	if len(keys) == 0 {
+		c.logger.Info("nothing to empty")
+		return objs, nil
+	}
+	if opts.DryRun {
+		c.logger.Info("empty trash plan", "objects", len(keys), "size(bytes)", size)
+		return objs, nil
+	}
+	if opts.Confirm != nil && !opts.Confirm(len(keys), size) {
+		err := errors.New("aborted")
+		c.logger.Error("empty trash failed", "err", err.Error())
+		return nil, err
+	}
+
+	deleted, err := client.Delete(ctx, endpoint, bucket, keys)
+	c.logger.Info("trash emptied", "objects", len(deleted), "size(bytes)", size)
+	objs = pickObjects(objs, deleted)
+	if err != nil {
+		c.logger.Error("empty trash failed", "err", err.Error())
+		return objs, err
+	}
+	return objs, nil
+}
+
+// pickObjects returns the objects whose key is one of keys
+func pickObjects(objs []*internal.S3Object, keys []string) []*internal.S3Object {
+	picked := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		picked[key] = struct{}{}
+	}
+	matched := make([]*internal.S3Object, 0, len(keys))
+	for _, obj := range objs {
+		if _, ok := picked[obj.Key]; ok {
+			matched = append(matched, obj)
+		}
+	}
+	return matched
+}
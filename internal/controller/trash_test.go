@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithoutTrash(t *testing.T) {
+	objs := []*internal.S3Object{
+		{Key: "data/a.txt"},
+		{Key: ".soss-trash/20240301T120000Z/data/b.txt"},
+		{Key: ".soss-trash-not/c.txt"},
+	}
+	filtered := withoutTrash(objs)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, "data/a.txt", filtered[0].Key)
+	assert.Equal(t, ".soss-trash-not/c.txt", filtered[1].Key)
+}
+
+func TestSplitTrashKey(t *testing.T) {
+	batch, original, ok := splitTrashKey(".soss-trash/20240301T120000Z/data/b.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "20240301T120000Z", batch)
+	assert.Equal(t, "data/b.txt", original)
+
+	_, _, ok = splitTrashKey(".soss-trash/20240301T120000Z/")
+	assert.False(t, ok)
+	_, _, ok = splitTrashKey("data/b.txt")
+	assert.False(t, ok)
+}
+
+func TestMatchAnyKey(t *testing.T) {
+	keys := []string{"data", "logs/app.log"}
+	assert.True(t, matchAnyKey("data/a.txt", keys))
+	assert.True(t, matchAnyKey("logs/app.log", keys))
+	assert.False(t, matchAnyKey("data2/a.txt", keys))
+	assert.False(t, matchAnyKey("logs/app.log.1", keys))
+}
+
+func TestTrashRestore(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	for _, key := range []string{"data/a.txt", "data/sub/b.txt"} {
+		mem.put("ep", "bucket", key, []byte(key), "")
+	}
+	_, err := c.Remove(ctx, RemoveOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", S3keys: []string{"data"}, Recursive: true, Trash: true,
+	})
+	assert.NoError(t, err)
+
+	batches, err := c.TrashList(ctx, TrashOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket"})
+	assert.NoError(t, err)
+	if !assert.Len(t, batches, 1) {
+		return
+	}
+	assert.Len(t, batches[0].Objs, 2)
+
+	// only a single batch is restored
+	for _, batch := range []string{"", "../data", batches[0].Name + "/data", ".."} {
+		_, err = c.TrashRestore(ctx, TrashRestoreOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Batch: batch})
+		assert.Error(t, err, batch)
+	}
+
+	// a new object at the original key is not overwritten
+	mem.put("ep", "bucket", "data/a.txt", []byte("new"), "")
+	opts := TrashRestoreOptions{S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Batch: batches[0].Name}
+	_, err = c.TrashRestore(ctx, opts)
+	assert.Error(t, err)
+	objs, err := mem.List(ctx, "ep", "bucket", "data/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data/a.txt"}, keysOf(objs))
+
+	// unless forced
+	opts.Force = true
+	restored, err := c.TrashRestore(ctx, opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"data/a.txt", "data/sub/b.txt"}, restored)
+	objs, err = mem.List(ctx, "ep", "bucket", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data/a.txt", "data/sub/b.txt"}, keysOf(objs))
+	file, err := mem.Download(ctx, &internal.S3Object{Endpoint: "ep", Bucket: "bucket", Key: "data/a.txt"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "data/a.txt", string(file.Content))
+}
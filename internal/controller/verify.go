@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+type VerifyStatus string
+
+const (
+	VerifyStatusOK            VerifyStatus = "ok"            // decrypted and checksum matched
+	VerifyStatusNoChecksum    VerifyStatus = "no_checksum"   // decrypted, but uploaded without a checksum
+	VerifyStatusCorrupt       VerifyStatus = "corrupt"       // key is right, but content is damaged
+	VerifyStatusUndecryptable VerifyStatus = "undecryptable" // content can not be decrypted, no metadata to tell why
+	VerifyStatusWrongKey      VerifyStatus = "wrong_key"     // metadata can not be decrypted with the given key
+	VerifyStatusError         VerifyStatus = "error"         // object can not be downloaded
+)
+
+// Failed reports whether the status means the object can not be restored.
+func (s VerifyStatus) Failed() bool {
+	return s != VerifyStatusOK && s != VerifyStatusNoChecksum
+}
+
+type VerifyResult struct {
+	Key    string       `json:"key"`
+	Size   int64        `json:"size"`
+	Status VerifyStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+}
+
+func (c *Controller) verifySingleObject(ctx context.Context, endpoint, bucket, decryptKey string, obj *internal.S3Object, client internal.IS3Client) *VerifyResult {
+	result := &VerifyResult{Key: obj.Key, Size: obj.Size}
+	fail := func(status VerifyStatus, err error) *VerifyResult {
+		result.Status = status
+		result.Error = err.Error()
+		return result
+	}
+
+	// nothing is written to disk, the output dir is never used
+	file, err := client.Download(
+		ctx, &internal.S3Object{
+			Endpoint: endpoint,
+			Bucket:   bucket,
+			Key:      obj.Key,
+		},
+		"",
+	)
+	if err != nil {
+		if errors.Is(err, internal.ErrIntegrity) {
+			return fail(VerifyStatusCorrupt, err)
+		}
+		return fail(VerifyStatusError, err)
+	}
+
+	hasMeta := file.EncryptedMeta != ""
+	if err := c.fileHandler.Decrypt(file, decryptKey); err != nil {
+		switch {
+		case errors.Is(err, internal.ErrDecryptMeta):
+			return fail(VerifyStatusWrongKey, err)
+		case hasMeta:
+			return fail(VerifyStatusCorrupt, err)
+		default:
+			return fail(VerifyStatusUndecryptable, err)
+		}
+	}
+
+	if c.isCompress {
+		if err := c.fileHandler.Decompress(file); err != nil {
+			return fail(VerifyStatusCorrupt, err)
+		}
+	}
+
+	if file.Meta == nil || file.Meta.Checksum == "" {
+		result.Status = VerifyStatusNoChecksum
+		return result
+	}
+
+	if sum := utils.Sha256Hex(file.Content); sum != file.Meta.Checksum {
+		return fail(VerifyStatusCorrupt, fmt.Errorf("checksum mismatch, expected %s, got %s", file.Meta.Checksum, sum))
+	}
+
+	result.Status = VerifyStatusOK
+	return result
+}
+
+func (c *Controller) verifyObjects(
+	ctx context.Context, endpoint, bucket, decryptKey string, objs []*internal.S3Object, client internal.IS3Client) []*VerifyResult {
+	results := make([]*VerifyResult, len(objs))
+
+	tasks := make([]transferTask, len(objs))
+	for i, obj := range objs {
+		tasks[i] = transferTask{size: obj.Size, run: func() {
+			results[i] = c.verifySingleObject(ctx, endpoint, bucket, decryptKey, obj, client)
+		}}
+	}
+	c.newScheduler().run(ctx, tasks)
+	if ctx.Err() != nil {
+		// results are incomplete, callers check ctx
+		return nil
+	}
+
+	return results
+}
+
+type VerifyOptions struct {
+	S3ClientType S3ClientType
+	Endpoint     string
+	Bucket       string
+	Prefix       string
+	DecryptKey   string
+}
+
+// Verify downloads, decrypts and decompresses every object under the prefix in memory,
+// and compares the plaintext with the checksum recorded at upload time. It
+// returns a result per object.
+func (c *Controller) Verify(ctx context.Context, opts VerifyOptions) ([]*VerifyResult, error) {
+	if err := c.requireBucket("verify"); err != nil {
+		return nil, err
+	}
+	endpoint, bucket := c.target(opts.Endpoint, opts.Bucket)
+
+	client, err := c.getClient(opts.S3ClientType)
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := client.List(ctx, endpoint, bucket, opts.Prefix)
+	if err != nil {
+		c.logger.Error("verify failed", "prefix", opts.Prefix, "err", err.Error())
+		return nil, err
+	}
+	if len(objs) == 0 {
+		err := errors.New("no objects to verify")
+		c.logger.Error("verify failed", "prefix", opts.Prefix, "err", err.Error())
+		return nil, err
+	}
+
+	failed := 0
+	results := c.verifyObjects(ctx, endpoint, bucket, opts.DecryptKey, objs, client)
+	for _, result := range results {
+		if result.Status.Failed() {
+			failed++
+			c.logger.Error("verify failed", "key", result.Key, "status", result.Status, "err", result.Error)
+			continue
+		}
+		c.logger.Info("verified", "key", result.Key, "status", result.Status, "size(bytes)", result.Size)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.logger.Info("verify finished", "total", len(objs), "failed", failed)
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d objects failed verification", failed, len(objs))
+	}
+	return results, nil
+}
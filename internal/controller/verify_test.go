@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	mem := newMemClient()
+	c := newMemCtrl(map[S3ClientType]internal.IS3Client{S3ClientTypeOSS: mem})
+	uploadFiles(t, c, S3ClientTypeOSS, "ep", "bucket", "data", "k", map[string]string{"intact.txt": "intact", "corrupt.txt": "corrupt"})
+	uploadFiles(t, c, S3ClientTypeOSS, "ep", "bucket", "data", "other", map[string]string{"wrong_key.txt": "wrong key"})
+	mem.corrupt("ep", "bucket", "data/corrupt.txt")
+
+	results, err := c.Verify(context.Background(), VerifyOptions{
+		S3ClientType: S3ClientTypeOSS, Endpoint: "ep", Bucket: "bucket", Prefix: "data/", DecryptKey: "k",
+	})
+	assert.Error(t, err)
+
+	statuses := make(map[string]VerifyStatus, len(results))
+	for _, result := range results {
+		statuses[result.Key] = result.Status
+	}
+	assert.Equal(t, map[string]VerifyStatus{
+		"data/intact.txt":    VerifyStatusOK,
+		"data/corrupt.txt":   VerifyStatusCorrupt,
+		"data/wrong_key.txt": VerifyStatusWrongKey,
+	}, statuses)
+}
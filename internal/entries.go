@@ -1,17 +1,42 @@
 package internal
 
+import (
+	"os"
+	"time"
+)
+
 type File struct {
-	Path       string // absolute path
-	Content    []byte // content
-	Encrypted  bool   // if true, content is encrypted
-	Compressed bool   // if true, content is compressed
+	Path          string    // absolute path
+	Content       []byte    // content
+	Encrypted     bool      // if true, content is encrypted
+	Compressed    bool      // if true, content is compressed
+	Meta          *FileMeta // file metadata, nil if not captured
+	EncryptedMeta string    // encrypted Meta, stored alongside the object
+}
+
+type FileMeta struct {
+	Size    int64             `json:"size"`             // plaintext size
+	Mode    os.FileMode       `json:"mode"`             // permission and mode bits
+	ModTime time.Time         `json:"mtime"`            // modification time
+	Uid     int               `json:"uid"`              // owner user id, -1 if unknown
+	Gid     int               `json:"gid"`              // owner group id, -1 if unknown
+	Xattrs  map[string][]byte `json:"xattrs,omitempty"` // extended attributes
+
+	Checksum string `json:"sha256,omitempty"` // hex encoded sha256 of the plaintext content
+}
+
+type MetaOptions struct {
+	Owner  bool // if true, read or restore uid / gid
+	Xattrs bool // if true, read or restore extended attributes
 }
 
 type S3Object struct {
-	Endpoint string // endpoint
-	Bucket   string // Object bucket
-	Key      string // Object key
-	Type     string // Object type
-	Size     int64  // Object size
-	ETag     string // Object eTag
+	Endpoint      string    // endpoint
+	Bucket        string    // Object bucket
+	Key           string    // Object key
+	Type          string    // Object type
+	Size          int64     // Object size
+	ETag          string    // Object eTag
+	LastModified  time.Time // Object last modified time
+	EncryptedMeta string    // encrypted file metadata
 }
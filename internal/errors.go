@@ -0,0 +1,9 @@
+package internal
+
+import "errors"
+
+var (
+	ErrDecryptContent = errors.New("failed to decrypt content")
+	ErrDecryptMeta    = errors.New("failed to decrypt metadata")
+	ErrIntegrity      = errors.New("integrity check failed")
+)
@@ -1,10 +1,16 @@
 package filehandler
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/pkg/bufpool"
 	"github.com/linlanniao/soss/pkg/cipher"
 	"github.com/linlanniao/soss/pkg/compressor"
 )
@@ -41,6 +47,19 @@ func (f *fileHandler) Encrypt(in *internal.File, encryptKey string) (err error)
 		return err
 	}
 
+	// encrypt file metadata
+	if in.Meta != nil {
+		b, err := json.Marshal(in.Meta)
+		if err != nil {
+			return err
+		}
+		encrypted, err := c.EncryptBytes(b)
+		if err != nil {
+			return err
+		}
+		in.EncryptedMeta = base64.StdEncoding.EncodeToString(encrypted)
+	}
+
 	in.Encrypted = true
 	return nil
 }
@@ -51,17 +70,50 @@ func (f *fileHandler) Decrypt(in *internal.File, decryptKey string) (err error)
 		return err
 	}
 
+	// decrypt file metadata first, objects uploaded by older versions have none.
+	// it is small and stored apart from the content, a failure here means a wrong key
+	if in.EncryptedMeta != "" {
+		if in.Meta, err = f.DecryptMeta(in.EncryptedMeta, decryptKey); err != nil {
+			return err
+		}
+	}
+
 	in.Content, err = c.DecryptBytes(in.Content)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", internal.ErrDecryptContent, err)
 	}
 
 	in.Encrypted = false
 	return nil
 }
 
-func (f *fileHandler) Read(path string) (*internal.File, error) {
-	content, err := os.ReadFile(path)
+func (f *fileHandler) DecryptMeta(encryptedMeta string, decryptKey string) (meta *internal.FileMeta, err error) {
+	c, err := f.cipher(decryptKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedMeta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", internal.ErrDecryptMeta, err)
+	}
+	b, err := c.DecryptBytes(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", internal.ErrDecryptMeta, err)
+	}
+	meta = &internal.FileMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, fmt.Errorf("%w: %w", internal.ErrDecryptMeta, err)
+	}
+	return meta, nil
+}
+
+func (f *fileHandler) Read(ctx context.Context, path string) (*internal.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	content, err := readFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +125,31 @@ func (f *fileHandler) Read(path string) (*internal.File, error) {
 	}, nil
 }
 
-func (f *fileHandler) Write(file *internal.File) error {
+// readFile is os.ReadFile into a buffer of bufpool, callers done with the
+// content can put it back
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// one spare MinRead so the final read hits EOF without growing
+	buf := bytes.NewBuffer(bufpool.Get(int(info.Size()) + bytes.MinRead)[:0])
+	if _, err := buf.ReadFrom(f); err != nil {
+		bufpool.Put(buf.Bytes())
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write writes the file content to a temporary file next to it, then renames it,
+// an interrupted write never leaves a partial file behind
+func (f *fileHandler) Write(ctx context.Context, file *internal.File) error {
 	dir := filepath.Dir(file.Path)
 
 	// if directory no exist, create it
@@ -84,10 +160,32 @@ func (f *fileHandler) Write(file *internal.File) error {
 		}
 	}
 
-	return os.WriteFile(file.Path, file.Content, 0644)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file.Path)+".soss-tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(file.Content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file with 0600
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	// the last chance to stop before the destination is replaced
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file.Path)
 }
 
-func (f *fileHandler) SearchFiles(path string) (files []string, err error) {
+func (f *fileHandler) SearchFiles(ctx context.Context, path string) (files []string, err error) {
 	// if given path is a file, return list of this file
 	if info, err := os.Stat(path); err != nil && !info.IsDir() {
 		return []string{path}, nil
@@ -98,6 +196,9 @@ func (f *fileHandler) SearchFiles(path string) (files []string, err error) {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			files = append(files, path)
 		}
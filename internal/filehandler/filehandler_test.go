@@ -0,0 +1,34 @@
+package filehandler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHandler_Write(t *testing.T) {
+	f := &fileHandler{}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "a.txt")
+
+	assert.NoError(t, f.Write(context.Background(), &internal.File{Path: path, Content: []byte("hello")}))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// a cancelled write keeps the old content and leaves no temp file behind
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, f.Write(ctx, &internal.File{Path: path, Content: []byte("world")}), context.Canceled)
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
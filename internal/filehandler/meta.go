@@ -0,0 +1,76 @@
+package filehandler
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+func (f *fileHandler) ReadMeta(ctx context.Context, path string, opts internal.MetaOptions) (*internal.FileMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &internal.FileMeta{
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		Uid:     -1,
+		Gid:     -1,
+	}
+
+	if opts.Owner {
+		meta.Uid, meta.Gid = fileOwner(info)
+	}
+
+	if opts.Xattrs {
+		meta.Xattrs, err = readXattrs(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return meta, nil
+}
+
+func (f *fileHandler) WriteMeta(ctx context.Context, path string, meta *internal.FileMeta, opts internal.MetaOptions) error {
+	if meta == nil {
+		return errors.New("meta is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.Xattrs && len(meta.Xattrs) > 0 {
+		if err := writeXattrs(path, meta.Xattrs); err != nil {
+			return err
+		}
+	}
+
+	// chown before chmod, changing the owner may clear the setuid / setgid bits
+	if opts.Owner && meta.Uid >= 0 && meta.Gid >= 0 {
+		if err := chown(path, meta.Uid, meta.Gid); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chmod(path, meta.Mode); err != nil {
+		return err
+	}
+
+	// restore mtime last, any other change would touch it
+	if !meta.ModTime.IsZero() {
+		if err := os.Chtimes(path, meta.ModTime, meta.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package filehandler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHandler_ReadWriteMeta(t *testing.T) {
+	f := &fileHandler{}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "run.sh")
+	assert.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\necho hi\n"), 0755))
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	meta, err := f.ReadMeta(context.Background(), src, internal.MetaOptions{Owner: true})
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), meta.Mode.Perm())
+	assert.True(t, meta.ModTime.Equal(mtime))
+
+	dst := filepath.Join(dir, "restored.sh")
+	assert.NoError(t, os.WriteFile(dst, []byte("#!/bin/sh\necho hi\n"), 0644))
+	assert.NoError(t, f.WriteMeta(context.Background(), dst, meta, internal.MetaOptions{}))
+
+	info, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.True(t, info.ModTime().Equal(mtime))
+}
+
+func TestFileHandler_EncryptDecryptMeta(t *testing.T) {
+	f := &fileHandler{}
+	meta := &internal.FileMeta{
+		Mode:    0700,
+		ModTime: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Uid:     1000,
+		Gid:     1000,
+	}
+	file := &internal.File{Path: "a.txt", Content: []byte("hello"), Meta: meta}
+
+	assert.NoError(t, f.Encrypt(file, "p@ssW0rd"))
+	assert.NotEmpty(t, file.EncryptedMeta)
+
+	downloaded := &internal.File{Path: "a.txt", Content: file.Content, EncryptedMeta: file.EncryptedMeta}
+	assert.NoError(t, f.Decrypt(downloaded, "p@ssW0rd"))
+	assert.Equal(t, []byte("hello"), downloaded.Content)
+	assert.Equal(t, meta.Mode, downloaded.Meta.Mode)
+	assert.True(t, meta.ModTime.Equal(downloaded.Meta.ModTime))
+	assert.Equal(t, meta.Uid, downloaded.Meta.Uid)
+}
+
+func TestFileHandler_DecryptWrongKey(t *testing.T) {
+	f := &fileHandler{}
+	file := &internal.File{Path: "a.txt", Content: []byte("hello"), Meta: &internal.FileMeta{Mode: 0644}}
+	assert.NoError(t, f.Encrypt(file, "p@ssW0rd"))
+
+	err := f.Decrypt(&internal.File{Content: file.Content, EncryptedMeta: file.EncryptedMeta}, "wrong")
+	assert.ErrorIs(t, err, internal.ErrDecryptMeta)
+
+	err = f.Decrypt(&internal.File{Content: file.Content}, "wrong")
+	assert.ErrorIs(t, err, internal.ErrDecryptContent)
+}
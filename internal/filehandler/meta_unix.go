@@ -0,0 +1,20 @@
+//go:build !windows
+
+package filehandler
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileOwner(info os.FileInfo) (uid, gid int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(stat.Uid), int(stat.Gid)
+}
+
+func chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
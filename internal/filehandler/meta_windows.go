@@ -0,0 +1,13 @@
+package filehandler
+
+import "os"
+
+// windows has no posix ownership, uid / gid are never captured nor restored
+
+func fileOwner(_ os.FileInfo) (uid, gid int) {
+	return -1, -1
+}
+
+func chown(_ string, _, _ int) error {
+	return nil
+}
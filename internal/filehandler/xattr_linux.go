@@ -0,0 +1,64 @@
+package filehandler
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getXattr(path, string(name))
+		if err != nil {
+			return nil, err
+		}
+		xattrs[string(name)] = value
+	}
+	return xattrs, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size == 0 {
+		return value, nil
+	}
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+func writeXattrs(path string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		if err := syscall.Setxattr(path, name, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package filehandler
+
+// extended attributes are only supported on linux
+
+func readXattrs(_ string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func writeXattrs(_ string, _ map[string][]byte) error {
+	return nil
+}
@@ -1,15 +1,29 @@
 package internal
 
+import "context"
+
 type IDownloader interface {
-	Download(obj *S3Object, outputDir string) (file *File, err error)
+	Download(ctx context.Context, obj *S3Object, outputDir string) (file *File, err error)
 }
 
 type IUploader interface {
-	Upload(endpoint, bucket, prefix string, file *File) (obj *S3Object, err error)
+	Upload(ctx context.Context, endpoint, bucket, prefix string, file *File) (obj *S3Object, err error)
 }
 
 type ILister interface {
-	List(endpoint, bucket string, prefix string) (objs []*S3Object, err error)
+	List(ctx context.Context, endpoint, bucket string, prefix string) (objs []*S3Object, err error)
+}
+
+type IStatter interface {
+	Stat(ctx context.Context, obj *S3Object) (*S3Object, error)
+}
+
+type ICopier interface {
+	Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error
+}
+
+type IDeleter interface {
+	Delete(ctx context.Context, endpoint, bucket string, keys []string) (deleted []string, err error)
 }
 
 //type IS3ClientConfigurator interface {
@@ -21,12 +35,23 @@ type IS3Client interface {
 	ILister
 	IUploader
 	IDownloader
+	IStatter
+	ICopier
+	IDeleter
 	//IS3ClientConfigurator
 }
 
+// IRetryCounter is implemented by clients that retry failed requests
+type IRetryCounter interface {
+	Retries() int64
+}
+
+// the content transforms work in memory and take no context
+
 type IContentCipher interface {
 	Encrypt(in *File, encryptKey string) (err error)
 	Decrypt(in *File, decryptKey string) (err error)
+	DecryptMeta(encryptedMeta string, decryptKey string) (meta *FileMeta, err error)
 }
 
 type IContentCompressor interface {
@@ -35,17 +60,23 @@ type IContentCompressor interface {
 }
 
 type IFileReadWriter interface {
-	Read(path string) (*File, error)
-	Write(file *File) error
+	Read(ctx context.Context, path string) (*File, error)
+	Write(ctx context.Context, file *File) error
+}
+
+type IFileMetaHandler interface {
+	ReadMeta(ctx context.Context, path string, opts MetaOptions) (*FileMeta, error)
+	WriteMeta(ctx context.Context, path string, meta *FileMeta, opts MetaOptions) error
 }
 
 type IFileScanner interface {
-	SearchFiles(path string) (files []string, err error)
+	SearchFiles(ctx context.Context, path string) (files []string, err error)
 }
 
 type IFileHandler interface {
 	IContentCipher
 	IFileReadWriter
+	IFileMetaHandler
 	IFileScanner
 	IContentCompressor
 }
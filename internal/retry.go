@@ -0,0 +1,30 @@
+package internal
+
+import "context"
+
+// RetryHook is told about a request that failed and is retried, attempt is
+// the number of the attempt that failed
+type RetryHook func(op string, attempt int, err error)
+
+type retryHookKey struct{}
+
+// WithRetryHook returns a copy of ctx whose retried requests are reported to
+// h, after the hooks ctx already carries
+func WithRetryHook(ctx context.Context, h RetryHook) context.Context {
+	if outer, ok := ctx.Value(retryHookKey{}).(RetryHook); ok {
+		inner := h
+		h = func(op string, attempt int, err error) {
+			outer(op, attempt, err)
+			inner(op, attempt, err)
+		}
+	}
+	return context.WithValue(ctx, retryHookKey{}, h)
+}
+
+// NotifyRetry calls the retry hooks of ctx. Clients that retry call it before
+// every retry.
+func NotifyRetry(ctx context.Context, op string, attempt int, err error) {
+	if h, ok := ctx.Value(retryHookKey{}).(RetryHook); ok {
+		h(op, attempt, err)
+	}
+}
@@ -0,0 +1,364 @@
+package localclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// metaDir holds a json sidecar per object with its metadata and md5,
+// it lives in the bucket directory and is never listed
+const metaDir = ".soss-local"
+
+// objectMeta is the sidecar of an object
+type objectMeta struct {
+	ETag          string    `json:"etag"` // hex md5 of the content
+	LastModified  time.Time `json:"last_modified"`
+	EncryptedMeta string    `json:"meta,omitempty"`
+}
+
+// client stores objects as files below a root directory, the endpoint,
+// e.g. a NAS mount. An object is saved at <endpoint>/<bucket>/<key>
+type client struct{}
+
+var _ internal.IS3Client = (*client)(nil)
+
+func NewClient() internal.IS3Client {
+	return &client{}
+}
+
+// objectPath returns the path of an object, keys can not escape the bucket
+func objectPath(endpoint, bucket, key string) (string, error) {
+	if endpoint == "" {
+		return "", errors.New("endpoint cannot be empty")
+	}
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket %q", bucket)
+	}
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != key || clean == metaDir || strings.HasPrefix(clean, metaDir+"/") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(endpoint, bucket, filepath.FromSlash(key)), nil
+}
+
+func metaPath(endpoint, bucket, key string) string {
+	return filepath.Join(endpoint, bucket, metaDir, filepath.FromSlash(key)+".json")
+}
+
+const tempSuffix = ".tmp"
+
+// isTempFile reports whether name is a file being written by writeFile
+func isTempFile(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, ".") && strings.Contains(base, tempSuffix)
+}
+
+// writeFile writes to a temporary file then renames it, readers never see a partial file
+func writeFile(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+tempSuffix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// readFile reads an object through the stream wrappers of ctx
+func readFile(ctx context.Context, name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(internal.WrapStream(ctx, f))
+}
+
+func readMeta(endpoint, bucket, key string) (*objectMeta, error) {
+	b, err := os.ReadFile(metaPath(endpoint, bucket, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// a file copied into the store by hand
+			return &objectMeta{}, nil
+		}
+		return nil, err
+	}
+	meta := &objectMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (c *client) put(
+	ctx context.Context, endpoint, bucket, key string, content []byte, encryptedMeta string) (*internal.S3Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := objectPath(endpoint, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(content)
+	meta := &objectMeta{
+		ETag:          hex.EncodeToString(sum[:]),
+		LastModified:  time.Now().UTC(),
+		EncryptedMeta: encryptedMeta,
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// the content first, a sidecar always describes the content next to it
+	if err := writeFile(p, internal.WrapStream(ctx, bytes.NewReader(content))); err != nil {
+		return nil, err
+	}
+	if err := writeFile(metaPath(endpoint, bucket, key), bytes.NewReader(b)); err != nil {
+		return nil, err
+	}
+
+	return &internal.S3Object{
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		Key:           key,
+		Size:          int64(len(content)),
+		ETag:          meta.ETag,
+		LastModified:  meta.LastModified,
+		EncryptedMeta: encryptedMeta,
+	}, nil
+}
+
+func (c *client) List(ctx context.Context, endpoint, bucket, prefix string) (objs []*internal.S3Object, err error) {
+	if endpoint == "" {
+		return nil, errors.New("endpoint cannot be empty")
+	}
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	root := filepath.Join(endpoint, bucket)
+	objs = make([]*internal.S3Object, 0)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if key == metaDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) || isTempFile(p) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		meta, err := readMeta(endpoint, bucket, key)
+		if err != nil {
+			return err
+		}
+		lastModified := meta.LastModified
+		if lastModified.IsZero() {
+			lastModified = info.ModTime()
+		}
+		objs = append(objs, &internal.S3Object{
+			Key:          key,
+			Size:         info.Size(),
+			ETag:         meta.ETag,
+			LastModified: lastModified,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objs, nil
+}
+
+func (c *client) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (obj *internal.S3Object, err error) {
+	if file == nil {
+		return nil, errors.New("file is nil")
+	}
+
+	// same key layout as the oss client
+	key := filepath.ToSlash(filepath.Join(prefix, filepath.Base(file.Path)))
+	return c.put(ctx, endpoint, bucket, key, file.Content, file.EncryptedMeta)
+}
+
+func (c *client) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (file *internal.File, err error) {
+	if obj == nil {
+		return nil, errors.New("obj is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p, err := objectPath(obj.Endpoint, obj.Bucket, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readFile(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readMeta(obj.Endpoint, obj.Bucket, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// detect bit rot before the content is decrypted
+	if meta.ETag != "" {
+		sum := md5.Sum(content)
+		if local := hex.EncodeToString(sum[:]); local != meta.ETag {
+			return nil, fmt.Errorf("download %s: %w: md5 mismatch, expected %s, got %s",
+				obj.Key, internal.ErrIntegrity, meta.ETag, local)
+		}
+	}
+
+	return &internal.File{
+		Path:          filepath.Join(outputDir, obj.Key),
+		Content:       content,
+		Encrypted:     true, // encrypted by default
+		Compressed:    true, // compressed by default
+		EncryptedMeta: meta.EncryptedMeta,
+	}, nil
+}
+
+func (c *client) Stat(ctx context.Context, obj *internal.S3Object) (*internal.S3Object, error) {
+	if obj == nil {
+		return nil, errors.New("obj is nil")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p, err := objectPath(obj.Endpoint, obj.Bucket, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s: %w", obj.Key, fs.ErrNotExist)
+	}
+	meta, err := readMeta(obj.Endpoint, obj.Bucket, obj.Key)
+	if err != nil {
+		return nil, err
+	}
+	lastModified := meta.LastModified
+	if lastModified.IsZero() {
+		lastModified = info.ModTime()
+	}
+
+	return &internal.S3Object{
+		Endpoint:      obj.Endpoint,
+		Bucket:        obj.Bucket,
+		Key:           obj.Key,
+		Size:          info.Size(),
+		ETag:          meta.ETag,
+		LastModified:  lastModified,
+		EncryptedMeta: meta.EncryptedMeta,
+	}, nil
+}
+
+// removeEmptyDirs removes the empty parents of name up to root
+func removeEmptyDirs(root, name string) {
+	for dir := filepath.Dir(name); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) Delete(ctx context.Context, endpoint, bucket string, keys []string) (deleted []string, err error) {
+	deleted = make([]string, 0, len(keys))
+	errs := make([]error, 0)
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		p, err := objectPath(endpoint, bucket, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		mp := metaPath(endpoint, bucket, key)
+		if err := os.Remove(mp); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		root := filepath.Join(endpoint, bucket)
+		removeEmptyDirs(root, p)
+		removeEmptyDirs(filepath.Join(root, metaDir), mp)
+		deleted = append(deleted, key)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func (c *client) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	src, err := objectPath(endpoint, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	meta, err := readMeta(endpoint, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	_, err = c.put(ctx, endpoint, dstBucket, dstKey, content, meta.EncryptedMeta)
+	return err
+}
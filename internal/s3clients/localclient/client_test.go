@@ -0,0 +1,91 @@
+package localclient
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBucket = "bucket"
+
+func TestClient_UploadDownload(t *testing.T) {
+	root := t.TempDir()
+	c := NewClient()
+	ctx := context.Background()
+
+	obj, err := c.Upload(ctx, root, testBucket, "data/sub", &internal.File{
+		Path: "/tmp/a.txt", Content: []byte("iam test file"), EncryptedMeta: "meta"})
+	assert.NoError(t, err)
+	assert.Equal(t, "data/sub/a.txt", obj.Key)
+	assert.Equal(t, "56a1309477d63cfdd425348b557cd516", obj.ETag)
+
+	file, err := c.Download(ctx, &internal.S3Object{Endpoint: root, Bucket: testBucket, Key: "data/sub/a.txt"}, "out")
+	assert.NoError(t, err)
+	assert.Equal(t, "iam test file", string(file.Content))
+	assert.Equal(t, "meta", file.EncryptedMeta)
+	assert.Equal(t, filepath.Join("out", "data/sub/a.txt"), file.Path)
+
+	stat, err := c.Stat(ctx, &internal.S3Object{Endpoint: root, Bucket: testBucket, Key: "data/sub/a.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), stat.Size)
+	assert.Equal(t, "meta", stat.EncryptedMeta)
+
+	// bit rot is detected
+	p := filepath.Join(root, testBucket, "data", "sub", "a.txt")
+	assert.NoError(t, os.WriteFile(p, []byte("iam test filf"), 0644))
+	_, err = c.Download(ctx, &internal.S3Object{Endpoint: root, Bucket: testBucket, Key: "data/sub/a.txt"}, "")
+	assert.True(t, errors.Is(err, internal.ErrIntegrity))
+}
+
+func TestClient_ListCopyDelete(t *testing.T) {
+	root := t.TempDir()
+	c := NewClient()
+	ctx := context.Background()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		_, err := c.Upload(ctx, root, testBucket, "data", &internal.File{Path: name, Content: []byte(name)})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.Copy(ctx, root, testBucket, "data/a.txt", "other", "copy/a.txt"))
+
+	objs, err := c.List(ctx, root, testBucket, "data/")
+	assert.NoError(t, err)
+	assert.Len(t, objs, 2)
+	assert.Equal(t, "data/a.txt", objs[0].Key)
+
+	objs, err = c.List(ctx, root, "other", "")
+	assert.NoError(t, err)
+	assert.Len(t, objs, 1)
+	assert.Equal(t, "copy/a.txt", objs[0].Key)
+
+	deleted, err := c.Delete(ctx, root, testBucket, []string{"data/a.txt", "data/b.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"data/a.txt", "data/b.txt"}, deleted)
+	objs, err = c.List(ctx, root, testBucket, "")
+	assert.NoError(t, err)
+	assert.Empty(t, objs)
+	assert.NoDirExists(t, filepath.Join(root, testBucket, "data"))
+
+	// an empty store lists nothing
+	objs, err = c.List(ctx, root, "missing", "")
+	assert.NoError(t, err)
+	assert.Empty(t, objs)
+}
+
+func TestObjectPath(t *testing.T) {
+	_, err := objectPath("/store", testBucket, "../escape")
+	assert.Error(t, err)
+	_, err = objectPath("/store", testBucket, ".soss-local/x.json")
+	assert.Error(t, err)
+	_, err = objectPath("/store", "../b", "key")
+	assert.Error(t, err)
+
+	p, err := objectPath("/store", testBucket, "data/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("/store", testBucket, "data", "a.txt"), p)
+}
@@ -2,96 +2,128 @@ package ossclient
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/linlanniao/soss/internal"
 )
 
+const (
+	// metaKeyFileMeta is the user metadata key of the encrypted file metadata
+	metaKeyFileMeta = "soss-meta"
+
+	// maxUserMetaSize is the max total size of user metadata allowed by OSS
+	maxUserMetaSize = 8 * 1024
+)
+
+// client keeps an oss client per endpoint and a bucket handle per endpoint
+// and bucket. They are created on first use and never replaced, so the client
+// is safe for concurrent use by transfers to any mix of endpoints.
 type client struct {
-	endpoint  string
 	accessKey string
 	secretKey string
-	_cli      *oss.Client
-	_bucket   *oss.Bucket
+
+	mu      sync.RWMutex
+	clients map[string]*oss.Client
+	buckets map[bucketKey]*oss.Bucket
+}
+
+type bucketKey struct {
+	endpoint string
+	bucket   string
 }
 
 var _ internal.IS3Client = (*client)(nil)
 
 func NewClient(endpoint, accessKey, secretKey string) internal.IS3Client {
-	c := &client{endpoint: endpoint, accessKey: accessKey, secretKey: secretKey}
+	c := &client{
+		accessKey: accessKey,
+		secretKey: secretKey,
+		clients:   make(map[string]*oss.Client),
+		buckets:   make(map[bucketKey]*oss.Bucket),
+	}
 
-	cli, err := oss.New(endpoint, accessKey, secretKey)
-	if err != nil {
-		panic(err.Error())
+	// fail early on a malformed default endpoint
+	if endpoint != "" {
+		if _, err := c.ossClient(endpoint); err != nil {
+			panic(err.Error())
+		}
 	}
-	c._cli = cli
 
 	return c
 }
 
-func (c *client) setEndpoint(endpoint string) error {
+// ossClient returns the oss client of an endpoint, c.mu must not be held
+func (c *client) ossClient(endpoint string) (*oss.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ossClientLocked(endpoint)
+}
 
-	// same endpoint, do nothing
-	if endpoint == c.endpoint {
-		return nil
+func (c *client) ossClientLocked(endpoint string) (*oss.Client, error) {
+	if cli, ok := c.clients[endpoint]; ok {
+		return cli, nil
 	}
-
-	// update endpoint
-	c.endpoint = endpoint
-
-	// create new oss client
-	if cli, err := oss.New(endpoint, c.accessKey, c.secretKey); err != nil {
-		return err
-	} else {
-		c._cli = cli
-		return nil
+	cli, err := oss.New(endpoint, c.accessKey, c.secretKey)
+	if err != nil {
+		return nil, err
 	}
+	c.clients[endpoint] = cli
+	return cli, nil
 }
 
-func (c *client) setBucket(bucket string) error {
-	// update bucket
-	_, err := c.bucket(bucket)
-	return err
-}
+// bucket returns the handle of a bucket at an endpoint
+func (c *client) bucket(endpoint, bucket string) (*oss.Bucket, error) {
+	if endpoint == "" {
+		return nil, errors.New("endpoint cannot be empty")
+	}
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
 
-func (c *client) bucket(bucket string) (*oss.Bucket, error) {
-	if c._bucket != nil && c._bucket.BucketName == bucket {
-		return c._bucket, nil
+	key := bucketKey{endpoint: endpoint, bucket: bucket}
+	c.mu.RLock()
+	b, ok := c.buckets[key]
+	c.mu.RUnlock()
+	if ok {
+		return b, nil
 	}
 
-	b, err := c._cli.Bucket(bucket)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.buckets[key]; ok {
+		return b, nil
+	}
+	cli, err := c.ossClientLocked(endpoint)
 	if err != nil {
 		return nil, err
 	}
-	c._bucket = b
+	b, err = cli.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	c.buckets[key] = b
 	return b, nil
 }
 
-func (c *client) List(endpoint, bucket, prefix string) (objs []*internal.S3Object, err error) {
-	if err := c.setEndpoint(endpoint); err != nil {
-		return nil, err
-	}
-	b, err := c._cli.Bucket(bucket)
+func (c *client) List(ctx context.Context, endpoint, bucket, prefix string) (objs []*internal.S3Object, err error) {
+	b, err := c.bucket(endpoint, bucket)
 	if err != nil {
 		return nil, err
 	}
-	if b.BucketName == "" {
-		return nil, errors.New("bucket cannot be empty")
-	}
-
-	if c.endpoint == "" {
-		return nil, errors.New("endpoint cannot be empty")
-	}
 
 	objs = make([]*internal.S3Object, 0)
 
 	continuationToken := oss.ContinuationToken("")
 	for {
-		result, err := b.ListObjectsV2(oss.Prefix(prefix), oss.MaxKeys(50), continuationToken)
+		result, err := b.ListObjectsV2(oss.Prefix(prefix), oss.MaxKeys(50), continuationToken, oss.WithContext(ctx))
 		if err != nil {
 			return nil, err
 		}
@@ -99,10 +131,11 @@ func (c *client) List(endpoint, bucket, prefix string) (objs []*internal.S3Objec
 
 		for _, obj := range result.Objects {
 			objs = append(objs, &internal.S3Object{
-				Key:  obj.Key,
-				Type: obj.Type,
-				Size: obj.Size,
-				ETag: obj.ETag,
+				Key:          obj.Key,
+				Type:         obj.Type,
+				Size:         obj.Size,
+				ETag:         obj.ETag,
+				LastModified: obj.LastModified,
 			})
 		}
 		if !result.IsTruncated {
@@ -113,111 +146,193 @@ func (c *client) List(endpoint, bucket, prefix string) (objs []*internal.S3Objec
 	return objs, nil
 }
 
-func (c *client) Upload(endpoint, bucket, prefix string, file *internal.File) (obj *internal.S3Object, err error) {
-	if err := c.setEndpoint(endpoint); err != nil {
-		return nil, err
-	}
-
+func (c *client) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (obj *internal.S3Object, err error) {
 	if file == nil {
 		return nil, errors.New("file is nil")
 	}
 
-	b, err := c._cli.Bucket(bucket)
-
+	b, err := c.bucket(endpoint, bucket)
 	if err != nil {
 		return nil, err
 	}
 
-	if b.BucketName == "" {
-		return nil, errors.New("bucket cannot be empty")
-	}
-
-	if c.endpoint == "" {
-		return nil, errors.New("endpoint cannot be empty")
-	}
-
 	fileName := filepath.Base(file.Path)
 	// TODO: what to deal with the prefix?
 	//  1. filepath.Join ?
 	//  2. prefix + filepath.Dir ?
 	key := filepath.Join(prefix, fileName)
 	//key := prefix + fileName
-	reader := bytes.NewReader(file.Content)
-	err = b.PutObject(key, reader, oss.Prefix(prefix))
-	if err != nil {
-		return nil, err
+	reader := internal.WrapStream(ctx, bytes.NewReader(file.Content))
+	var header http.Header
+	options := []oss.Option{
+		oss.Prefix(prefix),
+		oss.ContentLength(int64(len(file.Content))),
+		oss.ContentMD5(contentMD5(file.Content)),
+		oss.GetResponseHeader(&header),
+		oss.WithContext(ctx),
 	}
-	header, err := b.GetObjectDetailedMeta(key)
+	if file.EncryptedMeta != "" {
+		if len(file.EncryptedMeta) > maxUserMetaSize {
+			return nil, errors.New("file metadata is too large")
+		}
+		options = append(options, oss.Meta(metaKeyFileMeta, file.EncryptedMeta))
+	}
+	err = b.PutObject(key, reader, options...)
 	if err != nil {
 		return nil, err
 	}
-	cType := header.Get("Content-Type")
-	eTag := header.Get("ETag")
-	sizeStr := header.Get("Content-Length")
 
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		return nil, errors.New("failed to parse size")
+	// make sure what OSS stored is what we sent
+	if err := checkCRC64(header, file.Content); err != nil {
+		return nil, fmt.Errorf("upload %s: %w: %w", key, internal.ErrIntegrity, err)
 	}
 
 	return &internal.S3Object{
-		Bucket: bucket,
-		Key:    key,
-		Type:   cType,
-		Size:   int64(size),
-		ETag:   eTag,
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		Key:           key,
+		Size:          int64(len(file.Content)),
+		ETag:          header.Get(oss.HTTPHeaderEtag),
+		EncryptedMeta: file.EncryptedMeta,
 	}, nil
 }
 
-func (c *client) Download(obj *internal.S3Object, outputDir string) (file *internal.File, err error) {
+func (c *client) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (file *internal.File, err error) {
 	if obj == nil {
 		return nil, errors.New("obj is nil")
 	}
 
-	if obj.Endpoint == "" {
-		return nil, errors.New("endpoint cannot be empty")
+	b, err := c.bucket(obj.Endpoint, obj.Bucket)
+	if err != nil {
+		return nil, err
 	}
 
-	if obj.Bucket == "" {
-		return nil, errors.New("bucket is empty")
+	result, err := b.DoGetObject(&oss.GetObjectRequest{ObjectKey: obj.Key}, []oss.Option{oss.WithContext(ctx)})
+	if err != nil {
+		return nil, err
 	}
+	defer result.Response.Close()
 
-	if err := c.setEndpoint(obj.Endpoint); err != nil {
+	content, err := io.ReadAll(internal.WrapStream(ctx, result.Response))
+	if err != nil {
 		return nil, err
 	}
 
-	b, err := c.bucket(obj.Bucket)
+	// detect corruption in transit before the content is decrypted
+	if err := checkSize(result.Response.Headers, content); err != nil {
+		return nil, fmt.Errorf("download %s: %w: %w", obj.Key, internal.ErrIntegrity, err)
+	}
+	if err := checkCRC64(result.Response.Headers, content); err != nil {
+		return nil, fmt.Errorf("download %s: %w: %w", obj.Key, internal.ErrIntegrity, err)
+	}
+
+	outputPath := filepath.Join(outputDir, obj.Key)
+	//absPath, _ := filepath.Abs(filepath.Join(outputDir, obj.Key))
+
+	return &internal.File{
+		Path:          outputPath,
+		Content:       content,
+		Encrypted:     true, // encrypted by default
+		Compressed:    true, // compressed by default
+		EncryptedMeta: result.Response.Headers.Get(oss.HTTPHeaderOssMetaPrefix + metaKeyFileMeta),
+	}, nil
+}
+
+func (c *client) Stat(ctx context.Context, obj *internal.S3Object) (*internal.S3Object, error) {
+	if obj == nil {
+		return nil, errors.New("obj is nil")
+	}
 
+	b, err := c.bucket(obj.Endpoint, obj.Bucket)
 	if err != nil {
 		return nil, err
 	}
 
-	if b.BucketName == "" {
-		return nil, errors.New("bucket cannot be empty")
+	header, err := b.GetObjectDetailedMeta(obj.Key, oss.WithContext(ctx))
+	if err != nil {
+		return nil, err
 	}
 
-	if c.endpoint == "" {
-		return nil, errors.New("endpoint cannot be empty")
+	size, err := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return nil, errors.New("failed to parse size")
 	}
 
-	reader, err := b.GetObject(obj.Key)
+	lastModified, _ := http.ParseTime(header.Get(oss.HTTPHeaderLastModified))
+
+	return &internal.S3Object{
+		Endpoint:      obj.Endpoint,
+		Bucket:        obj.Bucket,
+		Key:           obj.Key,
+		Type:          header.Get("X-Oss-Object-Type"),
+		Size:          size,
+		ETag:          header.Get(oss.HTTPHeaderEtag),
+		LastModified:  lastModified,
+		EncryptedMeta: header.Get(oss.HTTPHeaderOssMetaPrefix + metaKeyFileMeta),
+	}, nil
+}
+
+// maxDeleteKeys is the max number of keys OSS accepts in one DeleteObjects call
+const maxDeleteKeys = 1000
+
+func (c *client) Delete(ctx context.Context, endpoint, bucket string, keys []string) (deleted []string, err error) {
+	b, err := c.bucket(endpoint, bucket)
 	if err != nil {
 		return nil, err
 	}
-	defer reader.Close()
 
-	content, err := io.ReadAll(reader)
+	deleted = make([]string, 0, len(keys))
+	for start := 0; start < len(keys); start += maxDeleteKeys {
+		end := min(start+maxDeleteKeys, len(keys))
+		result, err := b.DeleteObjects(keys[start:end], oss.WithContext(ctx))
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, result.DeletedObjects...)
+	}
+
+	return deleted, nil
+}
+
+const (
+	// copyPartThreshold is the size above which objects are copied part by part,
+	// a single CopyObject is limited to 1GB
+	copyPartThreshold = 1024 * 1024 * 1024
+
+	copyPartSize     = 100 * 1024 * 1024
+	copyPartRoutines = 5
+)
+
+func (c *client) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	src, err := c.bucket(endpoint, srcBucket)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	b, err := c.bucket(endpoint, dstBucket)
+	if err != nil {
+		return err
 	}
 
-	outputPath := filepath.Join(outputDir, obj.Key)
-	//absPath, _ := filepath.Abs(filepath.Join(outputDir, obj.Key))
+	header, err := src.GetObjectDetailedMeta(srcKey, oss.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return errors.New("failed to parse size")
+	}
 
-	return &internal.File{
-		Path:       outputPath,
-		Content:    content,
-		Encrypted:  true, // encrypted by default
-		Compressed: true, // compressed by default
-	}, nil
+	// the user metadata, i.e. the encrypted file metadata, is copied along
+	if size <= copyPartThreshold {
+		_, err = b.CopyObjectFrom(srcBucket, srcKey, dstKey, oss.WithContext(ctx))
+		return err
+	}
+
+	// a multipart copy starts a new object, the metadata has to be set again.
+	// the sdk aborts the multipart upload when the copy fails or is cancelled
+	options := []oss.Option{oss.Routines(copyPartRoutines), oss.WithContext(ctx)}
+	if meta := header.Get(oss.HTTPHeaderOssMetaPrefix + metaKeyFileMeta); meta != "" {
+		options = append(options, oss.Meta(metaKeyFileMeta, meta))
+	}
+	return b.CopyFile(srcBucket, srcKey, dstKey, copyPartSize, options...)
 }
@@ -2,6 +2,7 @@ package ossclient
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -27,7 +28,7 @@ func newTestClient() *client {
 }
 
 func deleteObject(client *client, objectName string) error {
-	bucket, err := client.bucket(testBucket)
+	bucket, err := client.bucket(testEndpoint, testBucket)
 	if err != nil {
 		return err
 	}
@@ -36,7 +37,7 @@ func deleteObject(client *client, objectName string) error {
 
 func TestClient_List(t *testing.T) {
 	client := newTestClient()
-	objs, err := client.List(testBucket, "tester3")
+	objs, err := client.List(context.Background(), testEndpoint, testBucket, "tester3")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, objs)
 	for _, obj := range objs {
@@ -52,7 +53,7 @@ func TestClient_Upload(t *testing.T) {
 		Encrypted: true, //fake
 	}
 	prefix := "tester"
-	obj, err := client.Upload(testBucket, prefix, file)
+	obj, err := client.Upload(context.Background(), testEndpoint, testBucket, prefix, file)
 	assert.NoError(t, err)
 	assert.NotNil(t, obj)
 	t.Logf("obj: %+v", obj)
@@ -61,7 +62,7 @@ func TestClient_Upload(t *testing.T) {
 
 	download := func() {
 		// using oss client to download test file
-		bucket, err := client.bucket(obj.Bucket)
+		bucket, err := client.bucket(testEndpoint, obj.Bucket)
 		assert.NoError(t, err)
 		reader, err := bucket.GetObject(obj.Key)
 		assert.NoError(t, err)
@@ -82,7 +83,7 @@ func TestClient_Download(t *testing.T) {
 
 	upload := func() *internal.S3Object {
 		// using oss client to upload test file
-		bucket, err := client.bucket(testBucket)
+		bucket, err := client.bucket(testEndpoint, testBucket)
 		assert.NoError(t, err)
 
 		key := prefix + filepath.Base(file.Path)
@@ -91,11 +92,12 @@ func TestClient_Download(t *testing.T) {
 		_ = bucket.PutObject(key, reader)
 
 		return &internal.S3Object{
-			Bucket: testBucket,
-			Key:    key,
-			Type:   "",
-			Size:   int64(len(file.Content)),
-			ETag:   "",
+			Endpoint: testEndpoint,
+			Bucket:   testBucket,
+			Key:      key,
+			Type:     "",
+			Size:     int64(len(file.Content)),
+			ETag:     "",
 		}
 	}
 
@@ -103,7 +105,7 @@ func TestClient_Download(t *testing.T) {
 
 	//defer deleteObject(client, obj.Key) // clean up
 
-	file2, err := client.Download(obj, "/tmp")
+	file2, err := client.Download(context.Background(), obj, "/tmp")
 	assert.NoError(t, err)
 	assert.NotNil(t, file2)
 	assert.Equal(t, file.Content, file2.Content)
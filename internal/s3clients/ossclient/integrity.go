@@ -0,0 +1,57 @@
+package ossclient
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash/crc64"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// crc64Table is the ECMA table used by OSS to compute X-Oss-Hash-Crc64ecma
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// contentMD5 returns the base64 encoded md5 of content, sent as Content-MD5 so OSS
+// rejects a body damaged in transit
+func contentMD5(content []byte) string {
+	sum := md5.Sum(content)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkCRC64 compares the crc64 reported by OSS with the one computed locally.
+// Some proxies, OSS compatible stores and old objects don't report it, then
+// there is nothing to compare and only a mismatch is an error.
+func checkCRC64(header http.Header, content []byte) error {
+	serverCRC := header.Get(oss.HTTPHeaderOssCRC64)
+	if serverCRC == "" {
+		slog.Debug("crc64 check skipped, no header", "header", oss.HTTPHeaderOssCRC64)
+		return nil
+	}
+
+	localCRC := strconv.FormatUint(crc64.Checksum(content, crc64Table), 10)
+	if serverCRC != localCRC {
+		return fmt.Errorf("crc64 mismatch, server %s, local %s", serverCRC, localCRC)
+	}
+	return nil
+}
+
+// checkSize compares the Content-Length reported by OSS with the received size
+func checkSize(header http.Header, content []byte) error {
+	sizeStr := header.Get(oss.HTTPHeaderContentLength)
+	if sizeStr == "" {
+		return nil
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse size: %w", err)
+	}
+	if size != int64(len(content)) {
+		return fmt.Errorf("size mismatch, expected %d, got %d", size, len(content))
+	}
+	return nil
+}
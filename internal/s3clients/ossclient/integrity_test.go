@@ -0,0 +1,36 @@
+package ossclient
+
+import (
+	"hash/crc64"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCRC64(t *testing.T) {
+	content := []byte("iam test file")
+	header := http.Header{}
+	header.Set(oss.HTTPHeaderOssCRC64, strconv.FormatUint(crc64.Checksum(content, crc64.MakeTable(crc64.ECMA)), 10))
+
+	assert.NoError(t, checkCRC64(header, content))
+	assert.Error(t, checkCRC64(header, []byte("iam test filf")))
+	// nothing to compare without the header
+	assert.NoError(t, checkCRC64(http.Header{}, content))
+}
+
+func TestCheckSize(t *testing.T) {
+	content := []byte("iam test file")
+	header := http.Header{}
+	header.Set(oss.HTTPHeaderContentLength, strconv.Itoa(len(content)))
+
+	assert.NoError(t, checkSize(header, content))
+	assert.Error(t, checkSize(header, content[1:]))
+}
+
+func TestContentMD5(t *testing.T) {
+	// echo -n "iam test file" | openssl md5 -binary | base64
+	assert.Equal(t, "VqEwlHfWPP3UJTSLVXzVFg==", contentMD5([]byte("iam test file")))
+}
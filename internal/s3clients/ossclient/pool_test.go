@@ -0,0 +1,110 @@
+package ossclient
+
+import (
+	"context"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/linlanniao/soss/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOSS speaks just enough of the OSS API for uploads and downloads. The
+// sdk addresses buckets by path on IP endpoints, objects are kept by path.
+type fakeOSS struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeOSS(t *testing.T) *httptest.Server {
+	f := &fakeOSS{objects: make(map[string][]byte)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeOSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.objects[r.URL.Path] = body
+		f.mu.Unlock()
+		w.Header().Set(oss.HTTPHeaderOssCRC64, strconv.FormatUint(crc64.Checksum(body, crc64Table), 10))
+		w.Header().Set(oss.HTTPHeaderEtag, `"`+contentMD5(body)+`"`)
+	case http.MethodGet:
+		f.mu.Lock()
+		body, ok := f.objects[r.URL.Path]
+		f.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(oss.HTTPHeaderContentLength, strconv.Itoa(len(body)))
+		w.Header().Set(oss.HTTPHeaderOssCRC64, strconv.FormatUint(crc64.Checksum(body, crc64Table), 10))
+		_, _ = w.Write(body)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeOSS) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.objects)
+}
+
+// TestClient_ConcurrentEndpoints transfers to two endpoints at once through
+// one client, run it with -race
+func TestClient_ConcurrentEndpoints(t *testing.T) {
+	ctx := context.Background()
+	servers := []*httptest.Server{newFakeOSS(t), newFakeOSS(t)}
+	c := NewClient("", "ak", "sk")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			endpoint := servers[i%2].URL
+			bucket := fmt.Sprintf("bucket-%d", i%3)
+			content := []byte(fmt.Sprintf("content of file %d", i))
+
+			obj, err := c.Upload(ctx, endpoint, bucket, "data", &internal.File{Path: fmt.Sprintf("%d.txt", i), Content: content})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, endpoint, obj.Endpoint)
+			file, err := c.Download(ctx, obj, t.TempDir())
+			if assert.NoError(t, err) {
+				assert.Equal(t, content, file.Content)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, server := range servers {
+		assert.Equal(t, 16, server.Config.Handler.(*fakeOSS).len())
+	}
+
+	// one oss client per endpoint, one handle per endpoint and bucket
+	pool := c.(*client)
+	assert.Len(t, pool.clients, 2)
+	assert.Len(t, pool.buckets, 6)
+
+	_, err := c.Upload(ctx, "", "bucket", "data", &internal.File{Path: "a.txt"})
+	assert.Error(t, err)
+	_, err = c.Upload(ctx, servers[0].URL, "", "data", &internal.File{Path: "a.txt"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package retryclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/linlanniao/soss/internal"
+	"github.com/minio/minio-go/v7"
+)
+
+// Class is the kind of failure an error stands for
+type Class int
+
+const (
+	// Permanent errors fail the same way when retried, e.g. auth or not found
+	Permanent Class = iota
+	// Network errors are timeouts, resets and truncated transfers
+	Network
+	// Throttled errors are the backend asking to slow down
+	Throttled
+	// ServerError is a 5xx response
+	ServerError
+	// Corrupted transfers failed the integrity check after download or upload
+	Corrupted
+)
+
+func (c Class) String() string {
+	switch c {
+	case Network:
+		return "network"
+	case Throttled:
+		return "throttled"
+	case ServerError:
+		return "server_error"
+	case Corrupted:
+		return "corrupted"
+	default:
+		return "permanent"
+	}
+}
+
+// Retryable reports whether a request failing with this class may succeed
+// when it's sent again
+func (c Class) Retryable() bool {
+	return c != Permanent
+}
+
+// throttlingCodes are the error codes OSS and S3 send when throttling
+var throttlingCodes = map[string]bool{
+	"Throttling":         true,
+	"SlowDown":           true,
+	"RequestLimitExceed": true,
+	"TooManyRequests":    true,
+}
+
+// Classify tells whether err is worth retrying and why
+func Classify(err error) Class {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return Permanent
+	}
+
+	var ossErr oss.ServiceError
+	if errors.As(err, &ossErr) {
+		return classifyStatus(ossErr.StatusCode, ossErr.Code)
+	}
+	var ossStatusErr oss.UnexpectedStatusCodeError
+	if errors.As(err, &ossStatusErr) {
+		return classifyStatus(ossStatusErr.Got(), "")
+	}
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) {
+		return classifyStatus(s3Err.StatusCode, s3Err.Code)
+	}
+	var crcErr oss.CRCCheckError
+	if errors.As(err, &crcErr) || errors.Is(err, internal.ErrIntegrity) {
+		return Corrupted
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE):
+		return Network
+	}
+	return Permanent
+}
+
+func classifyStatus(status int, code string) Class {
+	switch {
+	case throttlingCodes[code], status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable:
+		return Throttled
+	case status == http.StatusRequestTimeout:
+		return Network
+	case status >= http.StatusInternalServerError:
+		return ServerError
+	default:
+		return Permanent
+	}
+}
@@ -0,0 +1,168 @@
+package retryclient
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/linlanniao/soss/internal"
+)
+
+// Policy limits how often and how fast a failed request is retried
+type Policy struct {
+	MaxAttempts int           // attempts per request including the first one, 1 disables retries
+	BaseDelay   time.Duration // the backoff before the first retry, doubled for every further one
+	MaxDelay    time.Duration // the backoff never exceeds this
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 5,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^retry)),
+// the full jitter keeps workers that failed together from retrying together
+func (p Policy) backoff(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if retry < 32 {
+		if d := p.BaseDelay << retry; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// client retries the requests of the wrapped client that fail with a
+// retryable error. Every request of internal.IS3Client is idempotent: uploads
+// put the whole object, deletes of missing keys succeed, so all are retried.
+type client struct {
+	next    internal.IS3Client
+	policy  Policy
+	logger  *slog.Logger
+	retries atomic.Int64
+}
+
+var (
+	_ internal.IS3Client     = (*client)(nil)
+	_ internal.IRetryCounter = (*client)(nil)
+)
+
+type Option func(*client)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *client) {
+		c.logger = logger
+	}
+}
+
+// NewClient wraps next with retries, a policy allowing one attempt or less
+// returns next unchanged
+func NewClient(next internal.IS3Client, policy Policy, opts ...Option) internal.IS3Client {
+	if policy.MaxAttempts <= 1 {
+		return next
+	}
+	c := &client{
+		next:   next,
+		policy: policy,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Retries returns the number of retried requests so far
+func (c *client) Retries() int64 {
+	return c.retries.Load()
+}
+
+// do runs fn until it succeeds, fails permanently, runs out of attempts or
+// ctx is done, and returns the last error
+func (c *client) do(ctx context.Context, op, key string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		class := Classify(err)
+		if !class.Retryable() || attempt >= c.policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := c.policy.backoff(attempt - 1)
+		c.logger.Warn("retrying",
+			"op", op,
+			"key", key,
+			"attempt", attempt,
+			"class", class.String(),
+			"delay", delay.Round(time.Millisecond).String(),
+			"err", err.Error(),
+		)
+		c.retries.Add(1)
+		internal.NotifyRetry(ctx, op, attempt, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *client) List(ctx context.Context, endpoint, bucket string, prefix string) (objs []*internal.S3Object, err error) {
+	err = c.do(ctx, "list", prefix, func() error {
+		objs, err = c.next.List(ctx, endpoint, bucket, prefix)
+		return err
+	})
+	return objs, err
+}
+
+func (c *client) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (obj *internal.S3Object, err error) {
+	err = c.do(ctx, "upload", file.Path, func() error {
+		obj, err = c.next.Upload(ctx, endpoint, bucket, prefix, file)
+		return err
+	})
+	return obj, err
+}
+
+func (c *client) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (file *internal.File, err error) {
+	err = c.do(ctx, "download", obj.Key, func() error {
+		file, err = c.next.Download(ctx, obj, outputDir)
+		return err
+	})
+	return file, err
+}
+
+func (c *client) Stat(ctx context.Context, obj *internal.S3Object) (stat *internal.S3Object, err error) {
+	err = c.do(ctx, "stat", obj.Key, func() error {
+		stat, err = c.next.Stat(ctx, obj)
+		return err
+	})
+	return stat, err
+}
+
+func (c *client) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	return c.do(ctx, "copy", srcKey, func() error {
+		return c.next.Copy(ctx, endpoint, srcBucket, srcKey, dstBucket, dstKey)
+	})
+}
+
+func (c *client) Delete(ctx context.Context, endpoint, bucket string, keys []string) (deleted []string, err error) {
+	err = c.do(ctx, "delete", bucket, func() error {
+		deleted, err = c.next.Delete(ctx, endpoint, bucket, keys)
+		return err
+	})
+	return deleted, err
+}
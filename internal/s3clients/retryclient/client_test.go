@@ -0,0 +1,114 @@
+package retryclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/linlanniao/soss/internal"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Class
+	}{
+		{oss.ServiceError{StatusCode: 503, Code: "ServiceUnavailable"}, Throttled},
+		{oss.ServiceError{StatusCode: 403, Code: "AccessDenied"}, Permanent},
+		{oss.ServiceError{StatusCode: 404, Code: "NoSuchKey"}, Permanent},
+		{fmt.Errorf("upload: %w", oss.ServiceError{StatusCode: 500, Code: "InternalError"}), ServerError},
+		{minio.ErrorResponse{StatusCode: 503, Code: "SlowDown"}, Throttled},
+		{minio.ErrorResponse{StatusCode: 429}, Throttled},
+		{minio.ErrorResponse{StatusCode: 502}, ServerError},
+		{minio.ErrorResponse{StatusCode: 401, Code: "AccessDenied"}, Permanent},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, Network},
+		{fmt.Errorf("download a.txt: %w: size mismatch", internal.ErrIntegrity), Corrupted},
+		{context.Canceled, Permanent},
+		{errors.New("invalid key"), Permanent},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Classify(tt.err), tt.err.Error())
+	}
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry := 0; retry < 40; retry++ {
+		d := p.backoff(retry)
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.Less(t, d, time.Second)
+		if retry == 0 {
+			assert.Less(t, d, 100*time.Millisecond)
+		}
+	}
+}
+
+// flakyClient fails the first failures uploads with err
+type flakyClient struct {
+	internal.IS3Client
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyClient) Upload(_ context.Context, _, _, prefix string, file *internal.File) (*internal.S3Object, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return &internal.S3Object{Key: prefix + file.Path}, nil
+}
+
+func TestClient_Upload(t *testing.T) {
+	ctx := context.Background()
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	file := &internal.File{Path: "a.txt"}
+	unavailable := oss.ServiceError{StatusCode: 503}
+
+	// recovers from transient errors
+	flaky := &flakyClient{failures: 2, err: unavailable}
+	c := NewClient(flaky, policy)
+	var attempts []int
+	hooked := internal.WithRetryHook(ctx, func(op string, attempt int, err error) {
+		assert.Equal(t, "upload", op)
+		assert.ErrorIs(t, err, unavailable)
+		attempts = append(attempts, attempt)
+	})
+	obj, err := c.Upload(hooked, "ep", "bucket", "data/", file)
+	assert.NoError(t, err)
+	assert.Equal(t, "data/a.txt", obj.Key)
+	assert.Equal(t, 3, flaky.calls)
+	assert.Equal(t, int64(2), c.(internal.IRetryCounter).Retries())
+	assert.Equal(t, []int{1, 2}, attempts)
+
+	// gives up after MaxAttempts
+	flaky = &flakyClient{failures: 5, err: unavailable}
+	_, err = NewClient(flaky, policy).Upload(ctx, "ep", "bucket", "data/", file)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, flaky.calls)
+
+	// permanent errors are not retried
+	flaky = &flakyClient{failures: 5, err: oss.ServiceError{StatusCode: 403}}
+	_, err = NewClient(flaky, policy).Upload(ctx, "ep", "bucket", "data/", file)
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls)
+
+	// a cancelled context stops the retries
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	flaky = &flakyClient{failures: 5, err: unavailable}
+	_, err = NewClient(flaky, policy).Upload(cctx, "ep", "bucket", "data/", file)
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls)
+
+	// retries can be disabled
+	flaky = &flakyClient{failures: 1, err: unavailable}
+	c = NewClient(flaky, Policy{MaxAttempts: 1})
+	assert.Same(t, flaky, c)
+}
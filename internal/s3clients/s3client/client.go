@@ -0,0 +1,327 @@
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// metaKeyFileMeta is the user metadata key of the encrypted file metadata
+	metaKeyFileMeta = "soss-meta"
+
+	// headerFileMeta is the header the user metadata is returned in
+	headerFileMeta = "X-Amz-Meta-Soss-Meta"
+
+	// maxUserMetaSize is the max total size of user metadata allowed by S3
+	maxUserMetaSize = 2 * 1024
+)
+
+// client keeps a minio client per endpoint, created on first use and never
+// replaced, so it is safe for concurrent use by transfers to any endpoint
+type client struct {
+	accessKey string
+	secretKey string
+
+	mu      sync.Mutex
+	clients map[string]*minio.Client
+}
+
+var _ internal.IS3Client = (*client)(nil)
+
+// NewClient returns a client of S3 compatible services such as MinIO, the
+// endpoint may be empty and set later by any call
+func NewClient(endpoint, accessKey, secretKey string) internal.IS3Client {
+	c := &client{accessKey: accessKey, secretKey: secretKey, clients: make(map[string]*minio.Client)}
+	if endpoint == "" {
+		return c
+	}
+
+	if _, err := c.minioClient(endpoint); err != nil {
+		panic(err.Error())
+	}
+	return c
+}
+
+// parseEndpoint splits "https://host:port" into the host and whether to use tls,
+// an endpoint without scheme uses tls
+func parseEndpoint(endpoint string) (host string, secure bool, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid endpoint scheme %q", u.Scheme)
+	}
+}
+
+// minioClient returns the client of an endpoint
+func (c *client) minioClient(endpoint string) (*minio.Client, error) {
+	if endpoint == "" {
+		return nil, errors.New("endpoint cannot be empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cli, ok := c.clients[endpoint]; ok {
+		return cli, nil
+	}
+
+	host, secure, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(c.accessKey, c.secretKey, ""),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.clients[endpoint] = cli
+	return cli, nil
+}
+
+func (c *client) List(ctx context.Context, endpoint, bucket, prefix string) (objs []*internal.S3Object, err error) {
+	cli, err := c.minioClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	objs = make([]*internal.S3Object, 0)
+	for obj := range cli.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objs = append(objs, &internal.S3Object{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+	}
+
+	return objs, nil
+}
+
+func (c *client) Upload(ctx context.Context, endpoint, bucket, prefix string, file *internal.File) (obj *internal.S3Object, err error) {
+	cli, err := c.minioClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, errors.New("file is nil")
+	}
+
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	// same key layout as the oss client
+	key := filepath.Join(prefix, filepath.Base(file.Path))
+	options := minio.PutObjectOptions{
+		// the server rejects a body damaged in transit
+		SendContentMd5: true,
+	}
+	if file.EncryptedMeta != "" {
+		if len(file.EncryptedMeta) > maxUserMetaSize {
+			return nil, errors.New("file metadata is too large")
+		}
+		options.UserMetadata = map[string]string{metaKeyFileMeta: file.EncryptedMeta}
+	}
+
+	info, err := cli.PutObject(
+		ctx, bucket, key, internal.WrapStream(ctx, bytes.NewReader(file.Content)), int64(len(file.Content)), options)
+	if err != nil {
+		// the client can not abort a multipart upload with a cancelled context
+		if ctx.Err() != nil {
+			_ = cli.RemoveIncompleteUpload(context.Background(), bucket, key)
+		}
+		return nil, err
+	}
+
+	if info.Size != int64(len(file.Content)) {
+		return nil, fmt.Errorf("upload %s: %w: size mismatch, expected %d, got %d",
+			key, internal.ErrIntegrity, len(file.Content), info.Size)
+	}
+
+	return &internal.S3Object{
+		Endpoint:      endpoint,
+		Bucket:        bucket,
+		Key:           key,
+		Size:          info.Size,
+		ETag:          info.ETag,
+		EncryptedMeta: file.EncryptedMeta,
+	}, nil
+}
+
+func (c *client) Download(ctx context.Context, obj *internal.S3Object, outputDir string) (file *internal.File, err error) {
+	if obj == nil {
+		return nil, errors.New("obj is nil")
+	}
+
+	if obj.Endpoint == "" {
+		return nil, errors.New("endpoint cannot be empty")
+	}
+
+	if obj.Bucket == "" {
+		return nil, errors.New("bucket is empty")
+	}
+
+	cli, err := c.minioClient(obj.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := cli.GetObject(ctx, obj.Bucket, obj.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(internal.WrapStream(ctx, reader))
+	if err != nil {
+		return nil, err
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// detect corruption in transit before the content is decrypted
+	if err := checkContent(info, content); err != nil {
+		return nil, fmt.Errorf("download %s: %w: %w", obj.Key, internal.ErrIntegrity, err)
+	}
+
+	outputPath := filepath.Join(outputDir, obj.Key)
+
+	return &internal.File{
+		Path:          outputPath,
+		Content:       content,
+		Encrypted:     true, // encrypted by default
+		Compressed:    true, // compressed by default
+		EncryptedMeta: info.Metadata.Get(headerFileMeta),
+	}, nil
+}
+
+func (c *client) Stat(ctx context.Context, obj *internal.S3Object) (*internal.S3Object, error) {
+	if obj == nil {
+		return nil, errors.New("obj is nil")
+	}
+
+	cli, err := c.minioClient(obj.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.Bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	info, err := cli.StatObject(ctx, obj.Bucket, obj.Key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &internal.S3Object{
+		Endpoint:      obj.Endpoint,
+		Bucket:        obj.Bucket,
+		Key:           obj.Key,
+		Size:          info.Size,
+		ETag:          info.ETag,
+		LastModified:  info.LastModified,
+		EncryptedMeta: info.Metadata.Get(headerFileMeta),
+	}, nil
+}
+
+func (c *client) Delete(ctx context.Context, endpoint, bucket string, keys []string) (deleted []string, err error) {
+	cli, err := c.minioClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+
+	// sent is the number of keys handed to RemoveObjects, it is final once
+	// the results are drained as they end after objectsCh is closed
+	sent := 0
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, key := range keys {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: key}:
+				sent++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	failed := make(map[string]struct{})
+	errs := make([]error, 0)
+	for result := range cli.RemoveObjects(ctx, bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		failed[result.ObjectName] = struct{}{}
+		errs = append(errs, fmt.Errorf("%s: %w", result.ObjectName, result.Err))
+	}
+
+	// keys not sent before a cancellation are not deleted, the batches sent
+	// before it were
+	deleted = make([]string, 0, sent)
+	for _, key := range keys[:sent] {
+		if _, ok := failed[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return deleted, err
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func (c *client) Copy(ctx context.Context, endpoint, srcBucket, srcKey, dstBucket, dstKey string) error {
+	cli, err := c.minioClient(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if srcBucket == "" || dstBucket == "" {
+		return errors.New("bucket cannot be empty")
+	}
+
+	// a single CopyObject up to 5GB, a multipart copy above, the user
+	// metadata, i.e. the encrypted file metadata, is copied along
+	_, err = cli.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey},
+	)
+	return err
+}
@@ -0,0 +1,66 @@
+package s3client
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deleteServer answers the multi object deletes of a bucket, it cancels the
+// run when the second batch arrives and leaves that batch unanswered
+func deleteServer(cancel context.CancelFunc) *httptest.Server {
+	var batches atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		if batches.Add(1) > 1 {
+			// answered only once the client gave up
+			_, _ = io.Copy(io.Discard, r.Body)
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		var req struct {
+			Objects []struct {
+				Key string
+			} `xml:"Object"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+		for _, obj := range req.Objects {
+			fmt.Fprintf(w, "<Deleted><Key>%s</Key></Deleted>", obj.Key)
+		}
+		fmt.Fprint(w, `</DeleteResult>`)
+	}))
+}
+
+func TestDelete_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := deleteServer(cancel)
+	defer srv.Close()
+
+	// more than the 1000 keys of a batch
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("data/%04d.txt", i)
+	}
+
+	c := NewClient(srv.URL, "id", "secret")
+	deleted, err := c.Delete(ctx, srv.URL, "bucket", keys)
+	assert.ErrorIs(t, err, context.Canceled)
+	// the first batch was deleted before the cancellation
+	assert.Equal(t, keys[:1000], deleted)
+}
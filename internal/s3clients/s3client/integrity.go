@@ -0,0 +1,29 @@
+package s3client
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// checkContent compares the size, and the md5 for objects uploaded in a
+// single part, reported by the server with the received content
+func checkContent(info minio.ObjectInfo, content []byte) error {
+	if info.Size != int64(len(content)) {
+		return fmt.Errorf("size mismatch, expected %d, got %d", info.Size, len(content))
+	}
+
+	// the etag of a multipart upload is not the md5 of the content
+	etag := strings.Trim(info.ETag, `"`)
+	if len(etag) != md5.Size*2 || strings.Contains(etag, "-") {
+		return nil
+	}
+	sum := md5.Sum(content)
+	if local := hex.EncodeToString(sum[:]); local != strings.ToLower(etag) {
+		return fmt.Errorf("md5 mismatch, server %s, local %s", etag, local)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package s3client
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckContent(t *testing.T) {
+	content := []byte("iam test file")
+
+	// md5 of "iam test file"
+	info := minio.ObjectInfo{Size: int64(len(content)), ETag: `"56a1309477d63cfdd425348b557cd516"`}
+	assert.NoError(t, checkContent(info, content))
+
+	assert.Error(t, checkContent(info, []byte("iam test filf")))
+	assert.Error(t, checkContent(info, content[:4]))
+
+	// multipart etags are not checked
+	info.ETag = `"d41d8cd98f00b204e9800998ecf8427e-2"`
+	assert.NoError(t, checkContent(info, content))
+}
+
+func TestParseEndpoint(t *testing.T) {
+	host, secure, err := parseEndpoint("http://127.0.0.1:9000")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9000", host)
+	assert.False(t, secure)
+
+	host, secure, err = parseEndpoint("https://s3.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3.amazonaws.com", host)
+	assert.True(t, secure)
+
+	host, secure, err = parseEndpoint("minio.local:9000")
+	assert.NoError(t, err)
+	assert.Equal(t, "minio.local:9000", host)
+	assert.True(t, secure)
+
+	_, _, err = parseEndpoint("ftp://minio.local")
+	assert.Error(t, err)
+}
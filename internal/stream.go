@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"context"
+	"io"
+)
+
+// StreamWrapper wraps the content stream of a transfer, e.g. to limit its
+// bandwidth
+type StreamWrapper func(r io.Reader) io.Reader
+
+type streamWrapperKey struct{}
+
+// WithStreamWrapper returns a copy of ctx whose transfers have their content
+// streams wrapped by w, inside the wrappers ctx already carries
+func WithStreamWrapper(ctx context.Context, w StreamWrapper) context.Context {
+	if outer, ok := ctx.Value(streamWrapperKey{}).(StreamWrapper); ok {
+		inner := w
+		w = func(r io.Reader) io.Reader { return outer(inner(r)) }
+	}
+	return context.WithValue(ctx, streamWrapperKey{}, w)
+}
+
+// WrapStream wraps r with the stream wrappers of ctx. Clients call it on the
+// content they send and receive.
+func WrapStream(ctx context.Context, r io.Reader) io.Reader {
+	if w, ok := ctx.Value(streamWrapperKey{}).(StreamWrapper); ok {
+		return w(r)
+	}
+	return r
+}
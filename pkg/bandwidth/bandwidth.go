@@ -0,0 +1,163 @@
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/pkg/utils"
+	"golang.org/x/time/rate"
+)
+
+// ParseRate parses a rate in bytes per second, e.g. "512K", "10M", "1.5G" or
+// "10MB/s", units are powers of 1024. "", "0" and "unlimited" mean no limit
+// and return 0.
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	if v == "" || v == "0" || v == "UNLIMITED" {
+		return 0, nil
+	}
+	n, err := utils.ParseBytes(strings.TrimSuffix(v, "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n, nil
+}
+
+// Window is a daily time range with its own limit
+type Window struct {
+	From  time.Duration // offset from midnight
+	To    time.Duration // offset from midnight, a window with To before From spans midnight
+	Limit int64         // bytes per second, 0 for unlimited
+}
+
+// ParseWindow parses a window like ("08:00", "19:00", "5M")
+func ParseWindow(from, to, limit string) (Window, error) {
+	var w Window
+	var err error
+	if w.From, err = parseClock(from); err != nil {
+		return w, err
+	}
+	if w.To, err = parseClock(to); err != nil {
+		return w, err
+	}
+	if w.Limit, err = ParseRate(limit); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected hh:mm", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.From <= w.To {
+		return offset >= w.From && offset < w.To
+	}
+	return offset >= w.From || offset < w.To
+}
+
+// Schedule is the limit over the day, the first window containing the time
+// wins and Default applies outside all windows
+type Schedule struct {
+	Default int64 // bytes per second, 0 for unlimited
+	Windows []Window
+}
+
+// LimitAt returns the limit at t in bytes per second, 0 for unlimited
+func (s Schedule) LimitAt(t time.Time) int64 {
+	for _, w := range s.Windows {
+		if w.contains(t) {
+			return w.Limit
+		}
+	}
+	return s.Default
+}
+
+// IsUnlimited reports whether the schedule never limits anything
+func (s Schedule) IsUnlimited() bool {
+	if s.Default > 0 {
+		return false
+	}
+	for _, w := range s.Windows {
+		if w.Limit > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// burst is the most bytes a reader passes on at once
+const burst = 64 << 10
+
+// Limiter is a token bucket shared by all the streams it wraps, their total
+// rate follows the schedule
+type Limiter struct {
+	schedule Schedule
+	now      func() time.Time
+
+	mu      sync.Mutex
+	current int64
+	limiter *rate.Limiter
+}
+
+func NewLimiter(schedule Schedule) *Limiter {
+	return &Limiter{
+		schedule: schedule,
+		now:      time.Now,
+		current:  -1,
+		limiter:  rate.NewLimiter(rate.Inf, burst),
+	}
+}
+
+// refresh applies the limit of the current time and returns it
+func (l *Limiter) refresh() int64 {
+	limit := l.schedule.LimitAt(l.now())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit != l.current {
+		l.current = limit
+		if limit == 0 {
+			l.limiter.SetLimit(rate.Inf)
+		} else {
+			l.limiter.SetLimit(rate.Limit(limit))
+		}
+	}
+	return limit
+}
+
+// Reader returns r limited by l, waiting for tokens stops when ctx is done
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.l.refresh() == 0 {
+		return r.r.Read(p)
+	}
+	if len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,76 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"":          0,
+		"0":         0,
+		"unlimited": 0,
+		"1024":      1024,
+		"512K":      512 << 10,
+		"10M":       10 << 20,
+		"10MB/s":    10 << 20,
+		"1.5G":      3 << 29,
+		"2MiB":      2 << 20,
+	}
+	for s, want := range tests {
+		got, err := ParseRate(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	for _, s := range []string{"fast", "-1M", "10X"} {
+		_, err := ParseRate(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSchedule_LimitAt(t *testing.T) {
+	office, err := ParseWindow("08:00", "19:00", "1M")
+	assert.NoError(t, err)
+	night, err := ParseWindow("23:00", "06:00", "0")
+	assert.NoError(t, err)
+	s := Schedule{Default: 10 << 20, Windows: []Window{office, night}}
+
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	assert.Equal(t, int64(1<<20), s.LimitAt(at("08:00")))
+	assert.Equal(t, int64(1<<20), s.LimitAt(at("18:59")))
+	assert.Equal(t, int64(10<<20), s.LimitAt(at("19:00")))
+	assert.Equal(t, int64(0), s.LimitAt(at("23:30")))
+	assert.Equal(t, int64(0), s.LimitAt(at("05:00")))
+	assert.False(t, s.IsUnlimited())
+	assert.True(t, Schedule{Windows: []Window{night}}.IsUnlimited())
+
+	_, err = ParseWindow("8am", "19:00", "1M")
+	assert.Error(t, err)
+}
+
+func TestLimiter_Reader(t *testing.T) {
+	// 256K/s with a 64K burst: 128K takes at least a quarter of a second
+	l := NewLimiter(Schedule{Default: 256 << 10})
+	content := bytes.Repeat([]byte("x"), 128<<10)
+
+	start := time.Now()
+	got, err := io.ReadAll(l.Reader(context.Background(), bytes.NewReader(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// waiting stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = io.ReadAll(NewLimiter(Schedule{Default: 1024}).Reader(ctx, bytes.NewReader(content)))
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,47 @@
+// Package bufpool recycles the byte slices holding file contents, so that a
+// long transfer doesn't allocate a new buffer for every file.
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minClass = 16 // 64KB, smaller slices are left to the allocator
+	maxClass = 30 // 1GB, larger slices are too rare to keep around
+)
+
+// pools holds one pool per power of two capacity
+var pools [maxClass + 1]sync.Pool
+
+// class returns the smallest power of two holding size bytes
+func class(size int) int {
+	if size <= 1<<minClass {
+		return minClass
+	}
+	return bits.Len(uint(size - 1))
+}
+
+// Get returns a slice of length size, its content is undefined
+func Get(size int) []byte {
+	c := class(size)
+	if c > maxClass {
+		return make([]byte, size)
+	}
+	if b, ok := pools[c].Get().(*[]byte); ok {
+		return (*b)[:size]
+	}
+	return make([]byte, size, 1<<c)
+}
+
+// Put recycles b, the caller must not use it afterwards. Slices that don't
+// come from Get are dropped unless their capacity is a pooled class.
+func Put(b []byte) {
+	c := cap(b)
+	if c < 1<<minClass || c > 1<<maxClass || c&(c-1) != 0 {
+		return
+	}
+	b = b[:0]
+	pools[bits.Len(uint(c))-1].Put(&b)
+}
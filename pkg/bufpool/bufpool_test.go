@@ -0,0 +1,26 @@
+package bufpool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPut(t *testing.T) {
+	b := Get(100)
+	assert.Len(t, b, 100)
+	assert.Equal(t, 1<<minClass, cap(b))
+
+	b = Get(1<<20 + 1)
+	assert.Len(t, b, 1<<20+1)
+	assert.Equal(t, 1<<21, cap(b))
+	Put(b)
+
+	// a recycled slice is handed out again for the same class
+	again := Get(1<<20 + 100)
+	assert.Len(t, again, 1<<20+100)
+	assert.Equal(t, 1<<21, cap(again))
+
+	// foreign slices with an odd capacity are dropped
+	Put(make([]byte, 1000, 3000))
+}
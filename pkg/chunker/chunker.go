@@ -0,0 +1,81 @@
+package chunker
+
+import (
+	"errors"
+	"math/bits"
+)
+
+const (
+	DefaultMinSize = 256 * 1024
+	DefaultAvgSize = 1024 * 1024
+	DefaultMaxSize = 4 * 1024 * 1024
+)
+
+// gear is the table of the gear rolling hash. It must never change,
+// otherwise chunk boundaries move and nothing is deduplicated against older backups
+var gear = func() (t [256]uint64) {
+	// splitmix64 with a fixed seed
+	x := uint64(0x736f7373) // "soss"
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// Chunker splits content into content-defined chunks, so an insertion only changes
+// the chunks around it instead of shifting every following fixed size block
+type Chunker struct {
+	minSize int
+	maxSize int
+	mask    uint64
+}
+
+func NewChunker(minSize, avgSize, maxSize int) (*Chunker, error) {
+	if minSize <= 0 || minSize > avgSize || avgSize > maxSize {
+		return nil, errors.New("chunk sizes must satisfy 0 < min <= avg <= max")
+	}
+	// a boundary is found when the top log2(avg) bits of the hash are zero
+	b := bits.Len(uint(avgSize)) - 1
+	return &Chunker{
+		minSize: minSize,
+		maxSize: maxSize,
+		mask:    ^uint64(0) << (64 - b),
+	}, nil
+}
+
+func NewDefaultChunker() *Chunker {
+	c, _ := NewChunker(DefaultMinSize, DefaultAvgSize, DefaultMaxSize)
+	return c
+}
+
+// Split returns the chunks of content, they are sub slices of content
+func (c *Chunker) Split(content []byte) [][]byte {
+	chunks := make([][]byte, 0, len(content)/c.minSize+1)
+	for len(content) > 0 {
+		n := c.next(content)
+		chunks = append(chunks, content[:n])
+		content = content[n:]
+	}
+	return chunks
+}
+
+// next returns the length of the first chunk of content
+func (c *Chunker) next(content []byte) int {
+	if len(content) <= c.minSize {
+		return len(content)
+	}
+
+	end := min(len(content), c.maxSize)
+	var h uint64
+	for i := c.minSize; i < end; i++ {
+		h = (h << 1) + gear[content[i]]
+		if h&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return end
+}
@@ -0,0 +1,63 @@
+package chunker_test
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/linlanniao/soss/pkg/chunker"
+	"github.com/stretchr/testify/assert"
+)
+
+func randomBytes(n int, seed uint64) []byte {
+	r := rand.New(rand.NewPCG(seed, seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.UintN(256))
+	}
+	return b
+}
+
+func TestChunker_Split(t *testing.T) {
+	c, err := chunker.NewChunker(1024, 4096, 16384)
+	assert.NoError(t, err)
+
+	content := randomBytes(1<<20, 1)
+	chunks := c.Split(content)
+	assert.Equal(t, content, bytes.Join(chunks, nil))
+	for _, chunk := range chunks[:len(chunks)-1] {
+		assert.GreaterOrEqual(t, len(chunk), 1024)
+		assert.LessOrEqual(t, len(chunk), 16384)
+	}
+
+	assert.Empty(t, c.Split(nil))
+}
+
+func TestChunker_Insertion(t *testing.T) {
+	c, err := chunker.NewChunker(1024, 4096, 16384)
+	assert.NoError(t, err)
+
+	content := randomBytes(1<<20, 2)
+	edited := append(append(append([]byte{}, content[:5000]...), []byte("inserted")...), content[5000:]...)
+
+	seen := make(map[string]struct{})
+	for _, chunk := range c.Split(content) {
+		seen[string(chunk)] = struct{}{}
+	}
+	chunks := c.Split(edited)
+	shared := 0
+	for _, chunk := range chunks {
+		if _, ok := seen[string(chunk)]; ok {
+			shared++
+		}
+	}
+	// only the chunks around the insertion change
+	assert.GreaterOrEqual(t, shared, len(chunks)-2)
+}
+
+func TestNewChunker(t *testing.T) {
+	_, err := chunker.NewChunker(0, 1, 2)
+	assert.Error(t, err)
+	_, err = chunker.NewChunker(4, 2, 8)
+	assert.Error(t, err)
+}
@@ -6,14 +6,26 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/s2"
 )
 
+// s2Writers keeps the writers and their block buffers between calls
+var s2Writers = sync.Pool{
+	New: func() any { return s2.NewWriter(nil) },
+}
+
 func CompressS2Bytes(rawBytes []byte) (compressedBytes []byte, err error) {
 	var buf bytes.Buffer
-	c := s2.NewWriter(&buf)
+	c := s2Writers.Get().(*s2.Writer)
+	c.Reset(&buf)
+	defer func() {
+		c.Reset(nil)
+		s2Writers.Put(c)
+	}()
+
 	if _, err := c.Write(rawBytes); err != nil {
 		return nil, err
 	}
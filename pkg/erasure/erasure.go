@@ -0,0 +1,158 @@
+package erasure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// every shard starts with a header, so a shard alone tells how to rebuild the
+// object and whether it is damaged
+//
+//	magic   [6]byte  "SOSSEC"
+//	version uint8
+//	data    uint8    number of data shards
+//	parity  uint8    number of parity shards
+//	index   uint8    index of this shard
+//	size    uint64   size of the encoded content
+//	sum     [32]byte sha256 of the shard payload
+const (
+	magic      = "SOSSEC"
+	version    = 1
+	headerSize = len(magic) + 4 + 8 + sha256.Size
+)
+
+var (
+	ErrTooFewShards = errors.New("too few intact shards")
+	ErrBadShard     = errors.New("bad shard")
+)
+
+type header struct {
+	Data   int
+	Parity int
+	Index  int
+	Size   int64
+	Sum    [sha256.Size]byte
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, magic...)
+	b = append(b, version, byte(h.Data), byte(h.Parity), byte(h.Index))
+	b = binary.BigEndian.AppendUint64(b, uint64(h.Size))
+	return append(b, h.Sum[:]...)
+}
+
+// parseShard returns the header and the payload of a shard, after checking the payload checksum
+func parseShard(shard []byte) (*header, []byte, error) {
+	if len(shard) < headerSize || string(shard[:len(magic)]) != magic {
+		return nil, nil, fmt.Errorf("%w: missing header", ErrBadShard)
+	}
+	b := shard[len(magic):]
+	if b[0] != version {
+		return nil, nil, fmt.Errorf("%w: unknown version %d", ErrBadShard, b[0])
+	}
+	h := &header{Data: int(b[1]), Parity: int(b[2]), Index: int(b[3])}
+	h.Size = int64(binary.BigEndian.Uint64(b[4:12]))
+	copy(h.Sum[:], b[12:12+sha256.Size])
+
+	payload := shard[headerSize:]
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:], h.Sum[:]) {
+		return nil, nil, fmt.Errorf("%w: checksum mismatch", ErrBadShard)
+	}
+	return h, payload, nil
+}
+
+// Size returns the size of the content a shard belongs to, read from its header
+func Size(shard []byte) (int64, error) {
+	h, _, err := parseShard(shard)
+	if err != nil {
+		return 0, err
+	}
+	return h.Size, nil
+}
+
+// Encode splits content into data shards and adds parity shards, any data
+// shards out of the data+parity returned rebuild the content
+func Encode(content []byte, data, parity int) ([][]byte, error) {
+	if data <= 0 || parity < 0 || data+parity > 255 {
+		return nil, fmt.Errorf("invalid shard count %d+%d", data, parity)
+	}
+	enc, err := reedsolomon.New(data, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split pads the last data shard and needs at least one byte
+	src := content
+	if len(src) == 0 {
+		src = []byte{0}
+	}
+	payloads, err := enc.Split(bytes.Clone(src))
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(payloads); err != nil {
+		return nil, err
+	}
+
+	shards := make([][]byte, len(payloads))
+	for i, payload := range payloads {
+		h := &header{Data: data, Parity: parity, Index: i, Size: int64(len(content)), Sum: sha256.Sum256(payload)}
+		shards[i] = append(h.marshal(), payload...)
+	}
+	return shards, nil
+}
+
+// Decode rebuilds the content from its shards, indexed by shard index.
+// Missing shards are nil, damaged shards are detected and ignored
+func Decode(shards [][]byte) ([]byte, error) {
+	var ref *header
+	payloads := make([][]byte, len(shards))
+	intact := 0
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		h, payload, err := parseShard(shard)
+		if err != nil || h.Index != i {
+			continue
+		}
+		if ref == nil {
+			ref = h
+		} else if h.Data != ref.Data || h.Parity != ref.Parity || h.Size != ref.Size {
+			continue
+		}
+		payloads[i] = payload
+		intact++
+	}
+
+	if ref == nil {
+		return nil, ErrTooFewShards
+	}
+	if len(shards) != ref.Data+ref.Parity {
+		return nil, fmt.Errorf("expected %d shards, got %d", ref.Data+ref.Parity, len(shards))
+	}
+	if intact < ref.Data {
+		return nil, fmt.Errorf("%w, %d of %d needed", ErrTooFewShards, intact, ref.Data)
+	}
+
+	enc, err := reedsolomon.New(ref.Data, ref.Parity)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.ReconstructData(payloads); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(ref.Size))
+	if err := enc.Join(&buf, payloads, max(int(ref.Size), 1)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes()[:ref.Size], nil
+}
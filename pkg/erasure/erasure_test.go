@@ -0,0 +1,74 @@
+package erasure
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	content := make([]byte, 100_003)
+	_, _ = rand.Read(content)
+
+	shards, err := Encode(content, 4, 2)
+	assert.NoError(t, err)
+	assert.Len(t, shards, 6)
+
+	decoded, err := Decode(shards)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	// up to parity shards missing or damaged
+	shards[0] = nil
+	shards[3][headerSize+10] ^= 0xff
+	decoded, err = Decode(shards)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decoded)
+
+	// one too many
+	shards[5] = shards[5][:headerSize-1]
+	_, err = Decode(shards)
+	assert.ErrorIs(t, err, ErrTooFewShards)
+}
+
+func TestSize(t *testing.T) {
+	shards, err := Encode(make([]byte, 1001), 4, 2)
+	assert.NoError(t, err)
+	for _, shard := range shards {
+		size, err := Size(shard)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1001), size)
+	}
+
+	shards[0][headerSize] ^= 0xff
+	_, err = Size(shards[0])
+	assert.ErrorIs(t, err, ErrBadShard)
+}
+
+func TestEncodeDecode_Empty(t *testing.T) {
+	shards, err := Encode(nil, 2, 1)
+	assert.NoError(t, err)
+	shards[1] = nil
+
+	decoded, err := Decode(shards)
+	assert.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestDecode_SwappedShards(t *testing.T) {
+	shards, err := Encode([]byte("iam test file"), 2, 1)
+	assert.NoError(t, err)
+
+	// a shard stored at the wrong index is ignored
+	shards[0], shards[1] = shards[1], shards[0]
+	_, err = Decode(shards)
+	assert.ErrorIs(t, err, ErrTooFewShards)
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	_, err := Encode([]byte("x"), 0, 1)
+	assert.Error(t, err)
+	_, err = Encode([]byte("x"), 200, 100)
+	assert.Error(t, err)
+}
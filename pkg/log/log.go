@@ -22,3 +22,9 @@ func DefaultConsoleLogger() *slog.Logger {
 	))
 	return logger
 }
+
+// ConsoleLogger returns a logger like DefaultConsoleLogger that drops records
+// below level, e.g. to keep per-file lines from breaking a progress bar
+func ConsoleLogger(level slog.Level) *slog.Logger {
+	return slog.New(tint.NewHandler(os.Stderr, &tint.Options{Level: level}))
+}
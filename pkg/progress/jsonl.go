@@ -0,0 +1,105 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLines writes an event per line for CI logs. Byte counts are too
+// frequent to log one by one, they are folded into a "progress" record with
+// the totals at most every interval.
+type JSONLines struct {
+	interval time.Duration
+	tracker  *tracker
+
+	mu   sync.Mutex
+	enc  *json.Encoder
+	last time.Time
+}
+
+// NewJSONLines returns a renderer writing to w
+func NewJSONLines(w io.Writer, interval time.Duration) *JSONLines {
+	return &JSONLines{interval: interval, tracker: newTracker(), enc: json.NewEncoder(w)}
+}
+
+// record is a line of output, the event fields followed by the totals of
+// progress records
+type record struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Op      string    `json:"op,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Key     string    `json:"key,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	Files   int       `json:"files,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Error   string    `json:"error,omitempty"`
+
+	Done        int     `json:"done,omitempty"`
+	Failed      int     `json:"failed,omitempty"`
+	Transferred int64   `json:"transferred,omitempty"`
+	Retries     int     `json:"retries,omitempty"`
+	Throughput  float64 `json:"bytes_per_second,omitempty"`
+	ETA         float64 `json:"eta_seconds,omitempty"`
+}
+
+const progressEvent = "progress"
+
+func (r *JSONLines) Handle(e Event) {
+	r.tracker.apply(e)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.Kind == Bytes {
+		if e.Time.Sub(r.last) < r.interval {
+			return
+		}
+		r.last = e.Time
+		r.write(r.totals(progressEvent, e.Time))
+		return
+	}
+
+	rec := record{
+		Time:    e.Time,
+		Event:   string(e.Kind),
+		Op:      e.Op,
+		Path:    e.Path,
+		Key:     e.Key,
+		Size:    e.Size,
+		Files:   e.Files,
+		Attempt: e.Attempt,
+	}
+	if e.Err != nil {
+		rec.Error = e.Err.Error()
+	}
+	if e.Kind == BatchFinished {
+		rec = r.totals(string(e.Kind), e.Time)
+	}
+	r.write(rec)
+}
+
+// totals returns a record of the batch stats at now
+func (r *JSONLines) totals(event string, now time.Time) record {
+	s := r.tracker.snapshot(now)
+	return record{
+		Time:        now,
+		Event:       event,
+		Op:          s.Op,
+		Size:        s.Size,
+		Files:       s.Files,
+		Done:        s.Done,
+		Failed:      s.Failed,
+		Transferred: s.Transferred,
+		Retries:     s.Retries,
+		Throughput:  s.Throughput(),
+		ETA:         s.ETA().Seconds(),
+	}
+}
+
+func (r *JSONLines) write(rec record) {
+	// a log line that can't be written must not fail the transfer
+	_ = r.enc.Encode(rec)
+}
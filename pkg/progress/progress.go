@@ -0,0 +1,162 @@
+package progress
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind is the kind of progress event
+type Kind string
+
+const (
+	BatchStarted  Kind = "batch_started"  // Files and Size are the planned totals
+	FileStarted   Kind = "file_started"   // Size is the file size
+	Bytes         Kind = "bytes"          // Bytes more bytes of the file were sent or received
+	Retry         Kind = "retry"          // a request of the file failed with Err and is retried
+	FileFinished  Kind = "file_finished"  // Err is nil when the transfer succeeded
+	BatchFinished Kind = "batch_finished" // every started file has finished
+)
+
+// Event is a step of a batch of transfers
+type Event struct {
+	Kind    Kind
+	Time    time.Time
+	Op      string // e.g. "upload", "download"
+	Path    string // local path of the file
+	Key     string // object key of the file
+	Size    int64
+	Files   int
+	Bytes   int64
+	Attempt int // the failed attempt of a retry
+	Err     error
+}
+
+// Sink receives the progress events of the transfers, it's called from the
+// transfer workers and must be safe for concurrent use
+type Sink interface {
+	Handle(e Event)
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(e Event)
+
+func (f SinkFunc) Handle(e Event) { f(e) }
+
+// Stats is the state of a batch at some point
+type Stats struct {
+	Op          string
+	Files       int   // planned files
+	Done        int   // files transferred
+	Failed      int   // files that failed
+	Size        int64 // planned bytes
+	Transferred int64 // bytes of the finished files and the progress of the active ones
+	Retries     int
+	Elapsed     time.Duration
+	Active      []FileStats // the files in flight, the longest running first
+}
+
+// FileStats is the progress of a file in flight
+type FileStats struct {
+	Path        string
+	Key         string
+	Size        int64
+	Transferred int64
+	started     time.Time
+}
+
+// Throughput returns the average rate of the batch in bytes per second
+func (s Stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Transferred) / s.Elapsed.Seconds()
+}
+
+// ETA estimates the time left at the average rate, 0 when it's unknown
+func (s Stats) ETA() time.Duration {
+	rate := s.Throughput()
+	if rate <= 0 || s.Transferred >= s.Size {
+		return 0
+	}
+	return time.Duration(float64(s.Size-s.Transferred) / rate * float64(time.Second))
+}
+
+// tracker folds events into stats, the renderers share it
+type tracker struct {
+	mu       sync.Mutex
+	start    time.Time
+	stats    Stats
+	finished int64 // bytes of the finished files
+	active   map[string]*FileStats
+}
+
+func newTracker() *tracker {
+	return &tracker{active: make(map[string]*FileStats)}
+}
+
+// fileID identifies a file in flight by its path, uploads only learn the key
+// when they finish, and by its key when there is no path
+func fileID(e Event) string {
+	if e.Path != "" {
+		return e.Path
+	}
+	return e.Key
+}
+
+func (t *tracker) apply(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch e.Kind {
+	case BatchStarted:
+		t.start = e.Time
+		t.stats = Stats{Op: e.Op, Files: e.Files, Size: e.Size}
+		t.finished = 0
+		clear(t.active)
+	case FileStarted:
+		if t.start.IsZero() {
+			t.start = e.Time
+		}
+		t.active[fileID(e)] = &FileStats{Path: e.Path, Key: e.Key, Size: e.Size, started: e.Time}
+	case Bytes:
+		if f, ok := t.active[fileID(e)]; ok {
+			f.Transferred += e.Bytes
+		}
+	case Retry:
+		t.stats.Retries++
+		// the failed attempt is sent again from the start
+		if f, ok := t.active[fileID(e)]; ok {
+			f.Transferred = 0
+		}
+	case FileFinished:
+		delete(t.active, fileID(e))
+		if e.Err != nil {
+			t.stats.Failed++
+			return
+		}
+		t.stats.Done++
+		t.finished += e.Size
+	}
+}
+
+// snapshot returns the stats at now
+func (t *tracker) snapshot(now time.Time) Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stats
+	if !t.start.IsZero() {
+		s.Elapsed = now.Sub(t.start)
+	}
+	s.Transferred = t.finished
+	s.Active = make([]FileStats, 0, len(t.active))
+	for _, f := range t.active {
+		// the bytes of an upload are converted from the compressed and
+		// encrypted content, a file never counts for more than its size
+		s.Transferred += min(f.Transferred, f.Size)
+		s.Active = append(s.Active, *f)
+	}
+	sort.Slice(s.Active, func(i, j int) bool { return s.Active[i].started.Before(s.Active[j].started) })
+	return s
+}
@@ -0,0 +1,102 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// batch replays the events of two files, one of them retried and failing, a
+// second apart
+func batch(sink Sink) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	sink.Handle(Event{Kind: BatchStarted, Time: at(0), Op: "upload", Files: 2, Size: 300})
+	sink.Handle(Event{Kind: FileStarted, Time: at(0), Op: "upload", Path: "data/a.txt", Size: 100})
+	sink.Handle(Event{Kind: FileStarted, Time: at(0), Op: "upload", Path: "data/b.txt", Size: 200})
+	sink.Handle(Event{Kind: Bytes, Time: at(1), Op: "upload", Path: "data/a.txt", Bytes: 60})
+	sink.Handle(Event{Kind: Bytes, Time: at(1), Op: "upload", Path: "data/b.txt", Bytes: 50})
+	sink.Handle(Event{Kind: Retry, Time: at(2), Op: "upload", Path: "data/b.txt", Attempt: 1, Err: errors.New("reset")})
+	sink.Handle(Event{Kind: Bytes, Time: at(3), Op: "upload", Path: "data/a.txt", Bytes: 60})
+	sink.Handle(Event{Kind: FileFinished, Time: at(3), Op: "upload", Path: "data/a.txt", Key: "a.txt", Size: 100})
+	sink.Handle(Event{Kind: FileFinished, Time: at(4), Op: "upload", Path: "data/b.txt", Size: 200, Err: errors.New("denied")})
+	sink.Handle(Event{Kind: BatchFinished, Time: at(4), Op: "upload"})
+}
+
+func TestTracker(t *testing.T) {
+	tr := newTracker()
+	start := time.Now()
+	tr.apply(Event{Kind: BatchStarted, Time: start, Op: "download", Files: 2, Size: 400})
+	tr.apply(Event{Kind: FileStarted, Time: start, Key: "a", Size: 100})
+	tr.apply(Event{Kind: FileStarted, Time: start.Add(time.Millisecond), Key: "b", Size: 300})
+	tr.apply(Event{Kind: Bytes, Key: "a", Bytes: 150}) // more than the file, e.g. encryption overhead
+	tr.apply(Event{Kind: Bytes, Key: "b", Bytes: 100})
+
+	s := tr.snapshot(start.Add(2 * time.Second))
+	assert.Equal(t, int64(200), s.Transferred)
+	assert.Equal(t, 100.0, s.Throughput())
+	assert.Equal(t, 2*time.Second, s.ETA())
+	assert.Len(t, s.Active, 2)
+	assert.Equal(t, "a", s.Active[0].Key)
+
+	tr.apply(Event{Kind: Retry, Key: "b"})
+	tr.apply(Event{Kind: FileFinished, Key: "a", Size: 100})
+	s = tr.snapshot(start.Add(2 * time.Second))
+	assert.Equal(t, int64(100), s.Transferred)
+	assert.Equal(t, 1, s.Done)
+	assert.Equal(t, 1, s.Retries)
+	assert.Len(t, s.Active, 1)
+}
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+	batch(NewTerminal(&out, time.Second))
+
+	text := out.String()
+	assert.Contains(t, text, "a.txt  60 B / 100 B")
+	assert.Contains(t, text, "\x1b[3A") // the bar and two files are redrawn
+
+	// the final summary has no file lines
+	final := text[strings.LastIndex(text, "\x1b[J")+len("\x1b[J"):]
+	assert.Equal(t, "upload [==========>                   ]  33%  2/2 files  100 B / 300 B  25 B/s  ETA 8s  1 failed  1 retries\n", final)
+}
+
+func TestJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	batch(NewJSONLines(&out, time.Second))
+
+	var records []record
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var rec record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+
+	events := make([]string, 0, len(records))
+	for _, rec := range records {
+		events = append(events, rec.Event)
+	}
+	// the two byte counts of the same second are folded into one record
+	assert.Equal(t, []string{
+		"batch_started", "file_started", "file_started", "progress", "retry", "progress",
+		"file_finished", "file_finished", "batch_finished",
+	}, events)
+
+	assert.Equal(t, int64(60), records[3].Transferred)
+	assert.Equal(t, "reset", records[4].Error)
+	assert.Equal(t, 1, records[4].Attempt)
+	assert.Equal(t, "denied", records[7].Error)
+	last := records[len(records)-1]
+	assert.Equal(t, 1, last.Done)
+	assert.Equal(t, 1, last.Failed)
+	assert.Equal(t, int64(100), last.Transferred)
+	assert.Equal(t, 1, last.Retries)
+}
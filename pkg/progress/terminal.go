@@ -0,0 +1,125 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linlanniao/soss/pkg/utils"
+)
+
+const (
+	barWidth       = 30
+	maxActiveLines = 8
+)
+
+// Terminal draws an aggregate bar with throughput and ETA, followed by a line
+// per file in flight, and redraws them in place as events arrive
+type Terminal struct {
+	w        io.Writer
+	interval time.Duration
+	tracker  *tracker
+
+	mu    sync.Mutex
+	last  time.Time
+	lines int // lines drawn last time, they are overwritten by the next draw
+}
+
+// NewTerminal returns a renderer writing to w, a terminal that understands
+// ANSI escape codes, at most every interval
+func NewTerminal(w io.Writer, interval time.Duration) *Terminal {
+	return &Terminal{w: w, interval: interval, tracker: newTracker()}
+}
+
+func (r *Terminal) Handle(e Event) {
+	r.tracker.apply(e)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	final := e.Kind == BatchFinished
+	if !final && e.Time.Sub(r.last) < r.interval {
+		return
+	}
+	r.last = e.Time
+	r.draw(r.tracker.snapshot(e.Time), final)
+}
+
+// draw replaces the previous lines with the stats, the final draw has no
+// file lines and is left on screen
+func (r *Terminal) draw(s Stats, final bool) {
+	var b strings.Builder
+	if r.lines > 0 {
+		// back to the first line drawn last time, clear it and all below
+		fmt.Fprintf(&b, "\x1b[%dA", r.lines)
+	}
+	b.WriteString("\r\x1b[J")
+
+	b.WriteString(summaryLine(s))
+	b.WriteByte('\n')
+	lines := 1
+	if !final {
+		for i, f := range s.Active {
+			if i == maxActiveLines {
+				fmt.Fprintf(&b, "  ... and %d more\n", len(s.Active)-i)
+				lines++
+				break
+			}
+			fmt.Fprintf(&b, "  %s  %s / %s\n", fileName(f), utils.FormatBytes(min(f.Transferred, f.Size)), utils.FormatBytes(f.Size))
+			lines++
+		}
+	}
+	r.lines = lines
+	if final {
+		r.lines = 0 // the summary stays above whatever is written next
+	}
+
+	_, _ = io.WriteString(r.w, b.String())
+}
+
+func summaryLine(s Stats) string {
+	var b strings.Builder
+	if s.Op != "" {
+		b.WriteString(s.Op + " ")
+	}
+
+	ratio := 0.0
+	if s.Size > 0 {
+		ratio = min(float64(s.Transferred)/float64(s.Size), 1)
+	} else if s.Files > 0 {
+		ratio = float64(s.Done+s.Failed) / float64(s.Files)
+	}
+	filled := int(ratio * barWidth)
+	b.WriteByte('[')
+	b.WriteString(strings.Repeat("=", filled))
+	if filled < barWidth {
+		b.WriteByte('>')
+		b.WriteString(strings.Repeat(" ", barWidth-filled-1))
+	}
+	b.WriteByte(']')
+
+	fmt.Fprintf(&b, " %3.0f%%  %d/%d files  %s / %s  %s/s",
+		ratio*100, s.Done+s.Failed, s.Files,
+		utils.FormatBytes(s.Transferred), utils.FormatBytes(s.Size),
+		utils.FormatBytes(int64(s.Throughput())))
+	if eta := s.ETA(); eta > 0 {
+		fmt.Fprintf(&b, "  ETA %s", eta.Round(time.Second))
+	}
+	if s.Failed > 0 {
+		fmt.Fprintf(&b, "  %d failed", s.Failed)
+	}
+	if s.Retries > 0 {
+		fmt.Fprintf(&b, "  %d retries", s.Retries)
+	}
+	return b.String()
+}
+
+// fileName shortens the path, or the key when there is none, to its base
+func fileName(f FileStats) string {
+	if f.Path != "" {
+		return filepath.Base(f.Path)
+	}
+	return f.Key
+}
@@ -0,0 +1,247 @@
+// Package soss embeds the encrypted transfer engine of the soss command in
+// other Go programs.
+//
+// A Controller is built from a client per storage type and runs the same
+// operations as the commands, it returns their results instead of printing
+// them:
+//
+//	ctrl := soss.New(
+//		soss.WithS3Client(soss.ClientTypeS3, soss.NewS3Client(endpoint, id, secret)),
+//		soss.WithBucket("backups"),
+//	)
+//	report, err := ctrl.Upload(ctx, soss.UploadOptions{
+//		S3ClientType: soss.ClientTypeS3,
+//		EncryptKey:   key,
+//		Paths:        []string{"/data"},
+//	})
+//
+// A Controller is safe for concurrent use. The endpoint and bucket of the
+// options apply to that call only, calls to different buckets can run at the
+// same time on one Controller.
+package soss
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/linlanniao/soss/internal"
+	"github.com/linlanniao/soss/internal/controller"
+	"github.com/linlanniao/soss/internal/filehandler"
+	"github.com/linlanniao/soss/internal/s3clients/localclient"
+	"github.com/linlanniao/soss/internal/s3clients/ossclient"
+	"github.com/linlanniao/soss/internal/s3clients/retryclient"
+	"github.com/linlanniao/soss/internal/s3clients/s3client"
+	"github.com/linlanniao/soss/pkg/bandwidth"
+	"github.com/linlanniao/soss/pkg/progress"
+)
+
+type (
+	Controller = controller.Controller
+	Option     = controller.Option
+
+	// Client is a storage backend, see NewOSSClient, NewS3Client and NewLocalClient
+	Client     = internal.IS3Client
+	ClientType = controller.S3ClientType
+	Object     = internal.S3Object
+	// File is the content of a file a Client uploads or downloads, it's
+	// compressed and encrypted by the Controller
+	File     = internal.File
+	FileMeta = internal.FileMeta
+
+	ListOptions          = controller.ListOptions
+	UploadOptions        = controller.UploadOptions
+	DownloadOptions      = controller.DownloadOptions
+	RemoveOptions        = controller.RemoveOptions
+	CopyOptions          = controller.CopyOptions
+	SyncOptions          = controller.SyncOptions
+	PullOptions          = controller.PullOptions
+	VerifyOptions        = controller.VerifyOptions
+	MigrateOptions       = controller.MigrateOptions
+	BackupOptions        = controller.BackupOptions
+	SnapshotsOptions     = controller.SnapshotsOptions
+	RestoreOptions       = controller.RestoreOptions
+	TrashOptions         = controller.TrashOptions
+	TrashRestoreOptions  = controller.TrashRestoreOptions
+	TrashEmptyOptions    = controller.TrashEmptyOptions
+	ScrubOptions         = controller.ScrubOptions
+	PruneOptions         = controller.PruneOptions
+	RetentionPolicy      = controller.RetentionPolicy
+	DiffSnapshotsOptions = controller.DiffSnapshotsOptions
+	// MigrateLocation is a backend, bucket and prefix of a migration, see ParseLocation
+	MigrateLocation = controller.MigrateLocation
+	// MetaOptions are the file attributes restored along with the content
+	MetaOptions = internal.MetaOptions
+
+	TransferReport = controller.TransferReport
+	TransferResult = controller.TransferResult
+	BatchError     = controller.BatchError
+	CopyItem       = controller.CopyItem
+	SyncItem       = controller.SyncItem
+	MigrateItem    = controller.MigrateItem
+	VerifyResult   = controller.VerifyResult
+	Snapshot       = controller.Snapshot
+	SnapshotFile   = controller.SnapshotFile
+	SnapshotDiff   = controller.SnapshotDiff
+	SnapshotChange = controller.SnapshotChange
+	TrashBatch     = controller.TrashBatch
+	ScrubReport    = controller.ScrubReport
+	PrunePlan      = controller.PrunePlan
+	BackupSet      = controller.BackupSet
+	SyncAction     = controller.SyncAction
+	ConflictPolicy = controller.ConflictPolicy
+	VerifyStatus   = controller.VerifyStatus
+
+	// Replica is a bucket objects are copied to, see WithReplicas and WithErasure
+	Replica     = controller.Replica
+	ReplicaMode = controller.ReplicaMode
+	ErasureSet  = controller.ErasureSet
+
+	// Observer is told about every file of the transfers, see WithObserver
+	Observer = controller.Observer
+
+	RetryPolicy = retryclient.Policy
+)
+
+const (
+	ClientTypeOSS   = controller.S3ClientTypeOSS
+	ClientTypeS3    = controller.S3ClientTypeS3
+	ClientTypeLocal = controller.S3ClientTypeLocal
+)
+
+const (
+	SyncActionUpload   = controller.SyncActionUpload
+	SyncActionDelete   = controller.SyncActionDelete
+	SyncActionSkip     = controller.SyncActionSkip
+	SyncActionDownload = controller.SyncActionDownload
+	SyncActionRemove   = controller.SyncActionRemove
+	SyncActionConflict = controller.SyncActionConflict
+)
+
+const (
+	ConflictPolicySkip      = controller.ConflictPolicySkip
+	ConflictPolicyOverwrite = controller.ConflictPolicyOverwrite
+	ConflictPolicyKeepBoth  = controller.ConflictPolicyKeepBoth
+	ConflictPolicyNewerWins = controller.ConflictPolicyNewerWins
+)
+
+const (
+	VerifyStatusOK            = controller.VerifyStatusOK
+	VerifyStatusNoChecksum    = controller.VerifyStatusNoChecksum
+	VerifyStatusCorrupt       = controller.VerifyStatusCorrupt
+	VerifyStatusUndecryptable = controller.VerifyStatusUndecryptable
+	VerifyStatusWrongKey      = controller.VerifyStatusWrongKey
+	VerifyStatusError         = controller.VerifyStatusError
+)
+
+const (
+	ReplicaModeQuorum = controller.ReplicaModeQuorum
+	ReplicaModeAll    = controller.ReplicaModeAll
+)
+
+const (
+	SnapshotChangeAdded    = controller.SnapshotChangeAdded
+	SnapshotChangeRemoved  = controller.SnapshotChangeRemoved
+	SnapshotChangeModified = controller.SnapshotChangeModified
+
+	// SnapshotLatest resolves to the most recent snapshot
+	SnapshotLatest = controller.SnapshotLatest
+)
+
+// New returns a controller reading and writing local files through the
+// default file handler, it logs nothing unless WithLogger is given. At least
+// one client must be given with WithS3Client.
+func New(opts ...Option) *Controller {
+	defaults := []Option{
+		controller.WithFileHandler(filehandler.NewFileHandler()),
+		controller.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}
+	return controller.NewController(append(defaults, opts...)...)
+}
+
+// IsPartialFailure reports whether err is a batch in which only some files failed
+func IsPartialFailure(err error) bool {
+	return controller.IsPartialFailure(err)
+}
+
+// ParseLocation parses a migration location, e.g. oss://bucket/prefix
+func ParseLocation(s string) (MigrateLocation, error) {
+	return controller.ParseLocation(s)
+}
+
+func NewOSSClient(endpoint, accessKey, secretKey string) Client {
+	return ossclient.NewClient(endpoint, accessKey, secretKey)
+}
+
+// NewS3Client returns a client of an S3 compatible service, e.g. MinIO
+func NewS3Client(endpoint, accessKey, secretKey string) Client {
+	return s3client.NewClient(endpoint, accessKey, secretKey)
+}
+
+// NewLocalClient returns a client storing objects below a local directory,
+// the endpoint of the operations
+func NewLocalClient() Client {
+	return localclient.NewClient()
+}
+
+// WithRetry wraps client to retry the requests that fail with a transient error
+func WithRetry(client Client, policy RetryPolicy) Client {
+	return retryclient.NewClient(client, policy)
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return retryclient.DefaultPolicy()
+}
+
+func WithS3Client(t ClientType, client Client) Option {
+	return controller.WithS3Client(t, client)
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return controller.WithLogger(logger)
+}
+
+func WithEndpoint(endpoint string) Option {
+	return controller.WithEndpoint(endpoint)
+}
+
+func WithBucket(bucket string) Option {
+	return controller.WithBucket(bucket)
+}
+
+func WithCompression() Option {
+	return controller.WithCompression()
+}
+
+func WithTrash() Option {
+	return controller.WithTrash()
+}
+
+func WithJobs(n int) Option {
+	return controller.WithJobs(n)
+}
+
+func WithMemoryLimit(bytes int64) Option {
+	return controller.WithMemoryLimit(bytes)
+}
+
+func WithBandwidth(limiter *bandwidth.Limiter) Option {
+	return controller.WithBandwidth(limiter)
+}
+
+func WithProgress(sink progress.Sink) Option {
+	return controller.WithProgress(sink)
+}
+
+func WithObserver(o *Observer) Option {
+	return controller.WithObserver(o)
+}
+
+// WithReplicas copies every uploaded object to the replicas as well, see ReplicaMode
+func WithReplicas(mode ReplicaMode, replicas ...*Replica) Option {
+	return controller.WithReplicas(mode, replicas...)
+}
+
+// WithErasure stores uploaded objects as erasure coded shards in the targets of the set
+func WithErasure(set *ErasureSet) Option {
+	return controller.WithErasure(set)
+}
@@ -0,0 +1,147 @@
+package soss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello soss"), 0644))
+
+	ctrl := New(
+		WithS3Client(ClientTypeLocal, NewLocalClient()),
+		WithEndpoint(t.TempDir()),
+		WithBucket("bucket"),
+	)
+
+	report, err := ctrl.Upload(ctx, UploadOptions{
+		S3ClientType: ClientTypeLocal, Prefix: "data", EncryptKey: "secret", Paths: []string{src},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, report.Results(), 1)
+
+	objs, err := ctrl.List(ctx, ListOptions{S3ClientType: ClientTypeLocal, Prefix: "data"})
+	assert.NoError(t, err)
+	if assert.Len(t, objs, 1) {
+		assert.Equal(t, "data/a.txt", objs[0].Key)
+	}
+
+	out := t.TempDir()
+	report, err = ctrl.Download(ctx, DownloadOptions{
+		S3ClientType: ClientTypeLocal, OutputDir: out, DecryptKey: "secret", S3keys: []string{"data/a.txt"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, report.Results(), 1)
+
+	content, err := os.ReadFile(filepath.Join(out, "data", "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello soss", string(content))
+}
+
+func TestLocal_ConcurrentBuckets(t *testing.T) {
+	ctx := context.Background()
+	ctrl := New(
+		WithS3Client(ClientTypeLocal, NewLocalClient()),
+		WithEndpoint(t.TempDir()),
+		WithBucket("default"),
+	)
+
+	buckets := []string{"a", "b", "c", "d"}
+	var wg sync.WaitGroup
+	for _, bucket := range buckets {
+		src := t.TempDir()
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("%s-%d.txt", bucket, i)
+			assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte("content of "+name), 0644))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ctrl.Upload(ctx, UploadOptions{
+				S3ClientType: ClientTypeLocal, Bucket: bucket, Prefix: "data", EncryptKey: "secret", Paths: []string{src},
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// every upload went to its own bucket, the default one is untouched
+	for _, bucket := range buckets {
+		objs, err := ctrl.List(ctx, ListOptions{S3ClientType: ClientTypeLocal, Bucket: bucket, Prefix: "data/"})
+		assert.NoError(t, err)
+		assert.Len(t, objs, 5)
+		for _, obj := range objs {
+			assert.Contains(t, obj.Key, "data/"+bucket+"-")
+		}
+	}
+	objs, err := ctrl.List(ctx, ListOptions{S3ClientType: ClientTypeLocal, Prefix: "data/"})
+	assert.NoError(t, err)
+	assert.Empty(t, objs)
+}
+
+// TestEmbed builds testdata/embed, a module outside soss that can only import
+// pkg/soss, against every exported method of the controller
+func TestEmbed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+
+	src, err := os.ReadFile(filepath.Join("testdata", "embed", "embed.go"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a new method must be added to the module as well
+	methods := make([]string, 0)
+	for _, m := range regexp.MustCompile(`\(\*soss\.Controller\)\.(\w+)`).FindAllSubmatch(src, -1) {
+		methods = append(methods, string(m[1]))
+	}
+	exported := make([]string, 0)
+	ctrlType := reflect.TypeOf(&Controller{})
+	for i := 0; i < ctrlType.NumMethod(); i++ {
+		exported = append(exported, ctrlType.Method(i).Name)
+	}
+	assert.ElementsMatch(t, exported, methods)
+
+	// the module is copied out of the tree, it resolves soss from the tree
+	// and its dependencies from the module cache
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if !assert.NoError(t, err) {
+		return
+	}
+	mod, err := os.ReadFile(filepath.Join("testdata", "embed", "go.mod"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir := t.TempDir()
+	mod = bytes.Replace(mod, []byte("=> ../../../.."), []byte("=> "+root), 1)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), mod, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "embed.go"), src, 0644))
+
+	cmd := exec.Command(goBin, "vet", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+}
@@ -0,0 +1,88 @@
+// Package embed is a module outside soss, it only compiles when every
+// exported method of the controller and the types of its options and results
+// are reachable through pkg/soss
+package embed
+
+import (
+	"context"
+
+	"github.com/linlanniao/soss/pkg/soss"
+)
+
+var (
+	_ func(*soss.Controller, context.Context, soss.ListOptions) ([]*soss.Object, error)                                                    = (*soss.Controller).List
+	_ func(*soss.Controller, context.Context, soss.UploadOptions) (*soss.TransferReport, error)                                            = (*soss.Controller).Upload
+	_ func(*soss.Controller, context.Context, soss.DownloadOptions) (*soss.TransferReport, error)                                          = (*soss.Controller).Download
+	_ func(*soss.Controller, context.Context, soss.RemoveOptions) ([]*soss.Object, error)                                                  = (*soss.Controller).Remove
+	_ func(*soss.Controller, context.Context, soss.CopyOptions) ([]*soss.CopyItem, error)                                                  = (*soss.Controller).Copy
+	_ func(*soss.Controller, context.Context, soss.SyncOptions) ([]*soss.SyncItem, error)                                                  = (*soss.Controller).Sync
+	_ func(*soss.Controller, context.Context, soss.PullOptions) ([]*soss.SyncItem, error)                                                  = (*soss.Controller).Pull
+	_ func(*soss.Controller, context.Context, soss.VerifyOptions) ([]*soss.VerifyResult, error)                                            = (*soss.Controller).Verify
+	_ func(*soss.Controller, context.Context, soss.ScrubOptions) (*soss.ScrubReport, error)                                                = (*soss.Controller).Scrub
+	_ func(*soss.Controller, context.Context, soss.MigrateOptions) ([]*soss.MigrateItem, error)                                            = (*soss.Controller).Migrate
+	_ func(*soss.Controller, context.Context, soss.PruneOptions) (*soss.PrunePlan, error)                                                  = (*soss.Controller).Prune
+	_ func(*soss.Controller, context.Context, soss.BackupOptions) (*soss.Snapshot, error)                                                  = (*soss.Controller).Backup
+	_ func(*soss.Controller, context.Context, soss.SnapshotsOptions) ([]*soss.Snapshot, error)                                             = (*soss.Controller).Snapshots
+	_ func(*soss.Controller, context.Context, soss.RestoreOptions) (*soss.TransferReport, error)                                           = (*soss.Controller).Restore
+	_ func(*soss.Controller, context.Context, soss.DiffSnapshotsOptions) ([]*soss.SnapshotDiff, error)                                     = (*soss.Controller).DiffSnapshots
+	_ func(*soss.Controller, context.Context, soss.TrashOptions) ([]*soss.TrashBatch, error)                                               = (*soss.Controller).TrashList
+	_ func(*soss.Controller, context.Context, soss.TrashRestoreOptions) ([]string, error)                                                  = (*soss.Controller).TrashRestore
+	_ func(*soss.Controller, context.Context, soss.TrashEmptyOptions) ([]*soss.Object, error)                                              = (*soss.Controller).TrashEmpty
+	_ func(*soss.Controller, context.Context, string, string, string, string, string, soss.MetaOptions, soss.Client, *soss.TransferReport) = (*soss.Controller).UploadDirectoryOrFile
+)
+
+// the options and results name their fields through soss as well
+var (
+	_ = soss.PruneOptions{Policy: soss.RetentionPolicy{KeepDaily: 7}}
+	_ = soss.PrunePlan{Sets: []*soss.BackupSet{{Keep: true}}}
+	_ = soss.ScrubReport{Failures: []*soss.VerifyResult{{Status: soss.VerifyStatusCorrupt}}}
+	_ = soss.Snapshot{Files: []*soss.SnapshotFile{{Meta: &soss.FileMeta{}}}}
+	_ = soss.SnapshotDiff{Change: soss.SnapshotChangeAdded}
+	_ = soss.DiffSnapshotsOptions{From: soss.SnapshotLatest}
+	_ = soss.PullOptions{Conflict: soss.ConflictPolicyKeepBoth}
+	_ = soss.SyncItem{Action: soss.SyncActionConflict}
+	_ = soss.File{Content: []byte{}}
+	_ = soss.Object{}
+)
+
+var (
+	_ = []soss.SyncAction{
+		soss.SyncActionUpload, soss.SyncActionDelete, soss.SyncActionSkip,
+		soss.SyncActionDownload, soss.SyncActionRemove, soss.SyncActionConflict,
+	}
+	_ = []soss.ConflictPolicy{
+		soss.ConflictPolicySkip, soss.ConflictPolicyOverwrite, soss.ConflictPolicyKeepBoth, soss.ConflictPolicyNewerWins,
+	}
+	_ = []soss.VerifyStatus{
+		soss.VerifyStatusOK, soss.VerifyStatusNoChecksum, soss.VerifyStatusCorrupt,
+		soss.VerifyStatusUndecryptable, soss.VerifyStatusWrongKey, soss.VerifyStatusError,
+	}
+	_ = []soss.SnapshotChange{soss.SnapshotChangeAdded, soss.SnapshotChangeRemoved, soss.SnapshotChangeModified}
+)
+
+// New builds a controller with every option of soss
+func New() (*soss.Controller, error) {
+	from, err := soss.ParseLocation("oss://bucket/data")
+	if err != nil {
+		return nil, err
+	}
+	client := soss.WithRetry(soss.NewLocalClient(), soss.DefaultRetryPolicy())
+	replica := &soss.Replica{ClientType: from.ClientType, Endpoint: "/nas", Bucket: from.Bucket, Client: client}
+	return soss.New(
+		soss.WithS3Client(soss.ClientTypeLocal, client),
+		soss.WithReplicas(soss.ReplicaModeQuorum, replica),
+		soss.WithJobs(4),
+	), nil
+}
+
+// NewErasure builds a controller storing objects as shards
+func NewErasure() *soss.Controller {
+	targets := make([]*soss.Replica, 3)
+	for i := range targets {
+		targets[i] = &soss.Replica{ClientType: soss.ClientTypeLocal, Endpoint: "/nas", Bucket: "b", Client: soss.NewLocalClient()}
+	}
+	return soss.New(
+		soss.WithS3Client(soss.ClientTypeLocal, soss.NewLocalClient()),
+		soss.WithErasure(&soss.ErasureSet{DataShards: 2, ParityShards: 1, Targets: targets}),
+	)
+}
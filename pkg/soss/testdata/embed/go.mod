@@ -0,0 +1,7 @@
+module example.com/embed
+
+go 1.22.1
+
+require github.com/linlanniao/soss v0.0.0
+
+replace github.com/linlanniao/soss => ../../../..
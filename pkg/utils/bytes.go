@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseBytes parses a size like "512K", "10M", "1.5G" or "2GiB", units are
+// powers of 1024 and a bare number is bytes
+func ParseBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "IB"), "B")
+
+	multiplier := 1.0
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			v = v[:n-1]
+		}
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(f * multiplier), nil
+}
+
+// FormatBytes formats a size in the largest power of 1024 unit below it,
+// e.g. "512 B", "1.5 KiB" or "10.0 MiB"
+func FormatBytes(n int64) string {
+	const units = "KMGTPE"
+	if n < 1<<10 && n > -1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	i := -1
+	for (f >= 1<<10 || f <= -1<<10) && i < len(units)-1 {
+		f /= 1 << 10
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, units[i])
+}
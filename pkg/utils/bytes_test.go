@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := map[string]int64{
+		"1024": 1024,
+		"512K": 512 << 10,
+		"10MB": 10 << 20,
+		"1.5G": 3 << 29,
+		"2GiB": 2 << 30,
+		"1t":   1 << 40,
+	}
+	for s, want := range tests {
+		got, err := ParseBytes(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+
+	for _, s := range []string{"", "big", "-1M", "10X"} {
+		_, err := ParseBytes(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:        "0 B",
+		1023:     "1023 B",
+		1536:     "1.5 KiB",
+		10 << 20: "10.0 MiB",
+		3 << 29:  "1.5 GiB",
+		1 << 40:  "1.0 TiB",
+		-2048:    "-2.0 KiB",
+	}
+	for n, want := range tests {
+		assert.Equal(t, want, FormatBytes(n), n)
+	}
+}
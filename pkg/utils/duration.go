@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration is time.ParseDuration with support for a "d" (24h) suffix, e.g. "30d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 0 {
+		return 0, &time.ParseError{Layout: "duration", Value: s, Message: ": invalid duration " + strconv.Quote(s)}
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest == "" {
+		return d, nil
+	}
+
+	r, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, err
+	}
+	return d + r, nil
+}
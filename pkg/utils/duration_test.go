@@ -0,0 +1,33 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/linlanniao/soss/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"1d12h", 36 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"0d", 0},
+	}
+	for _, tt := range cases {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := utils.ParseDuration(tt.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	for _, in := range []string{"", "d", "xd", "-1d", "1d2x"} {
+		_, err := utils.ParseDuration(in)
+		assert.Error(t, err, in)
+	}
+}